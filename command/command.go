@@ -28,6 +28,9 @@ func Command() {
 	app := kingpin.New("drone", "drone aws runner")
 	registerCompile(app)
 	registerExec(app)
+	registerPoolfile(app)
+	registerStore(app)
+	registerUserdata(app)
 	daemon.Register(app)
 	delegate.RegisterDelegate(app)
 	dlite.RegisterDlite(app)
@@ -11,7 +11,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/command/internal"
 	"github.com/drone-runners/drone-runner-aws/engine/compiler"
 	"github.com/drone-runners/drone-runner-aws/engine/linter"
@@ -82,7 +81,7 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 		return err
 	}
 
-	poolFile, err := config.ParseFile(c.Pool)
+	poolFile, err := poolfile.ParseFiles(c.Pool)
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("compile: unable to parse pool file")
@@ -148,7 +147,7 @@ func registerCompile(app *kingpin.Application) {
 		Default(".drone.yml").
 		FileVar(&c.Source)
 
-	cmd.Arg("pool", "file to seed the aws pool").
+	cmd.Arg("pool", "file, directory or glob of pool files to seed the aws pool").
 		Default("pool.yml").
 		StringVar(&c.Pool)
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"unicode"
 	utf8 "unicode/utf8"
@@ -16,18 +17,116 @@ import (
 
 type (
 	PoolFile struct {
-		Version   string     `json:"version" yaml:"version"`
-		Instances []Instance `json:"instances" yaml:"instances"`
+		Version      string        `json:"version" yaml:"version"`
+		Instances    []Instance    `json:"instances" yaml:"instances"`
+		VirtualPools []VirtualPool `json:"virtual_pools,omitempty" yaml:"virtual_pools,omitempty"`
+		// Include lists further pool files, directories or glob patterns to load, relative to this file.
+		Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+		// Defaults holds, per instance type, the settings every instance of that type inherits.
+		// They are merged into the instances when the file is parsed.
+		Defaults map[string]interface{} `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+		// HourlyCosts is the estimated cost per hour of an instance by its
+		// size, for the pools which do not set an hourly cost.
+		HourlyCosts map[string]float64 `json:"hourly_costs,omitempty" yaml:"hourly_costs,omitempty"`
+	}
+
+	// VirtualPool is a pool name that does not have instances of its own.
+	// Stages requesting it are spread over the real pools by weight.
+	VirtualPool struct {
+		Name  string         `json:"name" jsonschema:"required"`
+		Pools []WeightedPool `json:"pools" jsonschema:"required"`
+	}
+
+	WeightedPool struct {
+		Pool   string `json:"pool" jsonschema:"required"`
+		Weight int    `json:"weight"`
 	}
 
 	Instance struct {
-		Name     string         `json:"name"`
+		Name     string         `json:"name" jsonschema:"required"`
 		Default  bool           `json:"default"`
-		Type     string         `json:"type"`
+		Type     string         `json:"type"` // may be inherited from the extended instance
+		Extends  string         `json:"extends,omitempty" yaml:"extends,omitempty"`
 		Pool     int            `json:"pool"`
 		Limit    int            `json:"limit"`
 		Platform types.Platform `json:"platform,omitempty" yaml:"platform,omitempty"`
 		Spec     interface{}    `json:"spec,omitempty"`
+		// Prebaked skips downloading the lite engine and plugin binaries
+		// if the image already contains the expected version. Without
+		// checksums, the version is read from a file next to the binary,
+		// e.g. /usr/bin/lite-engine.version, which the image has to ship.
+		Prebaked bool `json:"prebaked,omitempty" yaml:"prebaked,omitempty"`
+		// LiteEngineVersion overrides the version in DRONE_LITE_ENGINE_PATH,
+		// or the whole path if it is a URL.
+		LiteEngineVersion string `json:"lite_engine_version,omitempty" yaml:"lite_engine_version,omitempty"`
+		// Proxy is the HTTP proxy used by the instances, for downloads, the
+		// package manager, Docker and the lite engine. NoProxy lists the
+		// hosts reached directly.
+		Proxy   string   `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+		NoProxy []string `json:"no_proxy,omitempty" yaml:"no_proxy,omitempty"`
+		// CABundle are PEM encoded certificates trusted by the instances.
+		CABundle string        `json:"ca_bundle,omitempty" yaml:"ca_bundle,omitempty"`
+		Mirrors  types.Mirrors `json:"mirrors,omitempty" yaml:"mirrors,omitempty"`
+		// UserDataFormat selects the built-in userdata of Linux instances,
+		// cloud-init (the default) or ignition for Fedora CoreOS and Flatcar.
+		UserDataFormat string `json:"userdata_format,omitempty" yaml:"userdata_format,omitempty"`
+		// UserDataParts are added to the userdata of Linux instances as a
+		// multipart MIME message, next to the cloud-config of the runner.
+		UserDataParts []types.UserDataPart `json:"userdata_parts,omitempty" yaml:"userdata_parts,omitempty"`
+		// UserDataGzip compresses the userdata of Linux instances, to stay
+		// below the size limit of the provider.
+		UserDataGzip bool `json:"userdata_gzip,omitempty" yaml:"userdata_gzip,omitempty"`
+		// HourlyCost is the estimated cost per hour of a running instance,
+		// HibernatedHourlyCost the cost of a hibernated one, e.g. its disk.
+		HourlyCost           float64 `json:"hourly_cost,omitempty" yaml:"hourly_cost,omitempty"`
+		HibernatedHourlyCost float64 `json:"hibernated_hourly_cost,omitempty" yaml:"hibernated_hourly_cost,omitempty"`
+		// RateLimit limits the calls of the pool to the cloud API and retries
+		// the calls which are throttled by the provider.
+		RateLimit RateLimit `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+		// Middleware wraps the calls of the pool to the cloud API.
+		Middleware Middleware `json:"middleware,omitempty" yaml:"middleware,omitempty"`
+	}
+
+	// RateLimit is a token bucket of Rate calls per second holding up to
+	// Burst calls. Calls failing with a transient error are retried Retries
+	// times, with exponential backoff and jitter. Creations are retried only
+	// when the driver knows no instance was launched, e.g. a throttled launch
+	// on amazon.
+	RateLimit struct {
+		Rate    float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+		Burst   int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+		Retries int     `json:"retries,omitempty" yaml:"retries,omitempty"`
+	}
+
+	// Middleware enables the logging of the calls to the cloud API, and limits
+	// their duration by method, e.g. create, with a Go duration like 5m.
+	Middleware struct {
+		Logging  bool              `json:"logging,omitempty" yaml:"logging,omitempty"`
+		Timeouts map[string]string `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+		// Chaos injects faults into the calls to the cloud API, for testing.
+		Chaos *Chaos `json:"chaos,omitempty" yaml:"chaos,omitempty"`
+	}
+
+	// Chaos are the faults injected by method, drawn from Seed if it is set.
+	Chaos struct {
+		Seed      int64       `json:"seed,omitempty" yaml:"seed,omitempty"`
+		Create    ChaosFaults `json:"create,omitempty" yaml:"create,omitempty"`
+		Destroy   ChaosFaults `json:"destroy,omitempty" yaml:"destroy,omitempty"`
+		Hibernate ChaosFaults `json:"hibernate,omitempty" yaml:"hibernate,omitempty"`
+		Start     ChaosFaults `json:"start,omitempty" yaml:"start,omitempty"`
+	}
+
+	// ChaosFaults are the probabilities, between 0 and 1, of a call failing,
+	// hanging until it times out, returning an instance without an IP address
+	// (create and start), failing after the instance is created (create) or
+	// destroying only half of the instances (destroy), and the latency added
+	// to every call as a Go duration.
+	ChaosFaults struct {
+		FailureRate   float64 `json:"failure_rate,omitempty" yaml:"failure_rate,omitempty"`
+		HangRate      float64 `json:"hang_rate,omitempty" yaml:"hang_rate,omitempty"`
+		NoAddressRate float64 `json:"no_address_rate,omitempty" yaml:"no_address_rate,omitempty"`
+		PartialRate   float64 `json:"partial_rate,omitempty" yaml:"partial_rate,omitempty"`
+		Latency       string  `json:"latency,omitempty" yaml:"latency,omitempty"`
 	}
 
 	// Amazon specifies the configuration for an AWS instance.
@@ -41,7 +140,7 @@ type (
 		Tags          map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
 		Type          string            `json:"type,omitempty" yaml:"type,omitempty"`
 		UserData      string            `json:"user_data,omitempty" yaml:"user_data,omitempty"`
-		UserDataPath  string            `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
+		UserDataPath  string            `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
 		Disk          disk              `json:"disk,omitempty" yaml:"disk,omitempty"`
 		Network       AmazonNetwork     `json:"network,omitempty" yaml:"network,omitempty"`
 		DeviceName    string            `json:"device_name,omitempty" yaml:"device_name,omitempty"`
@@ -53,13 +152,43 @@ type (
 	}
 
 	AmazonAccount struct {
-		AccessKeyID      string `json:"access_key_id,omitempty"  yaml:"access_key_id"`
-		AccessKeySecret  string `json:"access_key_secret,omitempty" yaml:"access_key_secret"`
-		SessionToken     string `json:"aws_session_token,omitempty" yaml:"aws_session_token"`
-		Region           string `json:"region,omitempty"`
-		Retries          int    `json:"retries,omitempty" yaml:"retries,omitempty"`
-		AvailabilityZone string `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
-		KeyPairName      string `json:"key_pair_name,omitempty" yaml:"key_pair_name,omitempty"`
+		AccessKeyID      string       `json:"access_key_id,omitempty"  yaml:"access_key_id"`
+		AccessKeySecret  string       `json:"access_key_secret,omitempty" yaml:"access_key_secret"`
+		SessionToken     string       `json:"aws_session_token,omitempty" yaml:"aws_session_token"`
+		Region           string       `json:"region,omitempty"`
+		Retries          int          `json:"retries,omitempty" yaml:"retries,omitempty"`
+		AvailabilityZone string       `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
+		KeyPairName      string       `json:"key_pair_name,omitempty" yaml:"key_pair_name,omitempty"`
+		Credentials      *Credentials `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	}
+
+	// Credentials configures where the secret values of an Amazon, Azure or
+	// DigitalOcean account are read from instead of the pool file. They are
+	// refreshed as they expire.
+	Credentials struct {
+		// Provider is one of file, env, http, assume_role or web_identity.
+		Provider string `json:"provider" yaml:"provider" jsonschema:"required"`
+		// Names maps each credential to the environment variable (env) or the
+		// secret name (http) holding it.
+		Names map[string]string `json:"names,omitempty" yaml:"names,omitempty"`
+		// Path is the file holding the credentials (file).
+		Path string `json:"path,omitempty" yaml:"path,omitempty"`
+		// Key is the credential held by the file, if the file is not an object of credentials (file).
+		Key string `json:"key,omitempty" yaml:"key,omitempty"`
+		// Endpoint, Token and SkipVerify configure the secret plugin endpoint (http).
+		Endpoint   string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+		Token      string `json:"token,omitempty" yaml:"token,omitempty"`
+		SkipVerify bool   `json:"skip_verify,omitempty" yaml:"skip_verify,omitempty"`
+		SecretPath string `json:"secret_path,omitempty" yaml:"secret_path,omitempty"`
+		// RoleARN, ExternalID, SessionName and WebIdentityTokenFile configure
+		// the AWS role to assume (assume_role, web_identity).
+		RoleARN              string `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+		ExternalID           string `json:"external_id,omitempty" yaml:"external_id,omitempty"`
+		SessionName          string `json:"session_name,omitempty" yaml:"session_name,omitempty"`
+		WebIdentityTokenFile string `json:"web_identity_token_file,omitempty" yaml:"web_identity_token_file,omitempty"`
+		// RefreshInterval is how often, in seconds, credentials without an
+		// expiry are read again. Defaults to 300.
+		RefreshInterval int `json:"refresh_interval,omitempty" yaml:"refresh_interval,omitempty"`
 	}
 
 	// AmazonNetwork provides AmazonNetwork settings.
@@ -76,10 +205,10 @@ type (
 			Username string `json:"username,omitempty"  yaml:"username"`
 			Password string `json:"password,omitempty"  yaml:"password"`
 		}
-		VMID          string `json:"vm_id,omitempty" yaml:"vm_id"`
+		VMID          string `json:"vm_id,omitempty" yaml:"vm_id" jsonschema:"required"`
 		RootDirectory string `json:"root_directory,omitempty" yaml:"root_directory"`
 		UserData      string `json:"user_data,omitempty" yaml:"user_data"`
-		UserDataPath  string `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
+		UserDataPath  string `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
 	}
 
 	// AnkaBuild specifies the configuration for an Anka instance.
@@ -88,11 +217,11 @@ type (
 			Username string `json:"username,omitempty"  yaml:"username"`
 			Password string `json:"password,omitempty"  yaml:"password"`
 		}
-		VMID          string `json:"vm_id,omitempty" yaml:"vm_id"`
+		VMID          string `json:"vm_id,omitempty" yaml:"vm_id" jsonschema:"required"`
 		RootDirectory string `json:"root_directory,omitempty" yaml:"root_directory"`
 		UserData      string `json:"user_data,omitempty" yaml:"user_data"`
-		UserDataPath  string `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
-		RegistryURL   string `json:"registry_url,omitempty" yaml:"registry_url"`
+		UserDataPath  string `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
+		RegistryURL   string `json:"registry_url,omitempty" yaml:"registry_url" jsonschema:"required"`
 		NodeID        string `json:"node_id,omitempty" yaml:"node_id"`
 		Tag           string `json:"tag,omitempty" yaml:"tag"`
 		AuthToken     string `json:"auth_token,omitempty" yaml:"auth_token"`
@@ -106,7 +235,7 @@ type (
 	}
 
 	NomadServer struct {
-		Address        string `json:"address" yaml:"address"`
+		Address        string `json:"address" yaml:"address" jsonschema:"required"`
 		Insecure       bool   `json:"insecure,omitempty" yaml:"insecure" default:"false"`
 		CaCertPath     string `json:"ca_cert_path,omitempty" yaml:"ca_cert_path"`
 		ClientKeyPath  string `json:"client_key_path,omitempty" yaml:"client_key_path"`
@@ -147,10 +276,11 @@ type (
 	}
 
 	AzureAccount struct {
-		SubscriptionID string `json:"subscription_id,omitempty"  yaml:"subscription_id,omitempty"`
-		ClientID       string `json:"client_id,omitempty"  yaml:"client_id,omitempty"`
-		ClientSecret   string `json:"client_secret,omitempty"  yaml:"client_secret,omitempty"`
-		TenantID       string `json:"tenant_id,omitempty"  yaml:"tenant_id,omitempty"`
+		SubscriptionID string       `json:"subscription_id,omitempty"  yaml:"subscription_id,omitempty" jsonschema:"required"`
+		ClientID       string       `json:"client_id,omitempty"  yaml:"client_id,omitempty" jsonschema:"required"`
+		ClientSecret   string       `json:"client_secret,omitempty"  yaml:"client_secret,omitempty"`
+		TenantID       string       `json:"tenant_id,omitempty"  yaml:"tenant_id,omitempty" jsonschema:"required"`
+		Credentials    *Credentials `json:"credentials,omitempty" yaml:"credentials,omitempty"`
 	}
 
 	AzureImage struct {
@@ -172,12 +302,13 @@ type (
 		Tags          []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
 		RootDirectory string              `json:"root_directory,omitempty" yaml:"root_directory"`
 		UserData      string              `json:"user_data,omitempty" yaml:"user_data,omitempty"`
-		UserDataPath  string              `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
+		UserDataPath  string              `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
 	}
 
 	DigitalOceanAccount struct {
-		PAT    string `json:"pat,omitempty" yaml:"pat"`
-		Region string `json:"region,omitempty" yaml:"region,omitempty"`
+		PAT         string       `json:"pat,omitempty" yaml:"pat"`
+		Region      string       `json:"region,omitempty" yaml:"region,omitempty"`
+		Credentials *Credentials `json:"credentials,omitempty" yaml:"credentials,omitempty"`
 	}
 
     // Hetzner specifies the configuration for a Hetzner instance.
@@ -190,11 +321,11 @@ type (
 		Tags          []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
 		RootDirectory string              `json:"root_directory,omitempty" yaml:"root_directory"`
 		UserData      string              `json:"user_data,omitempty" yaml:"user_data,omitempty"`
-		UserDataPath  string              `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
+		UserDataPath  string              `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
 	}
 
 	HetznerAccount struct {
-		Token  string `json:"token,omitempty" yaml:"token"`
+		Token  string `json:"token,omitempty" yaml:"token" jsonschema:"required"`
 		Region string `json:"region,omitempty" yaml:"region,omitempty"`
 	}
 
@@ -220,7 +351,7 @@ type (
 	}
 
 	GoogleAccount struct {
-		ProjectID           string   `json:"project_id,omitempty"  yaml:"project_id"`
+		ProjectID           string   `json:"project_id,omitempty"  yaml:"project_id" jsonschema:"required"`
 		JSONPath            string   `json:"json_path,omitempty"  yaml:"json_path"`
 		Scopes              []string `json:"scopes,omitempty"  yaml:"scopes,omitempty"`
 		ServiceAccountEmail string   `json:"service_account_email,omitempty"  yaml:"service_account_email,omitempty"`
@@ -239,7 +370,7 @@ type (
 		CPU           int64  `json:"cpu,omitempty" yaml:"cpu"`
 		VDiskPath     string `json:"v_disk_path,omitempty" yaml:"v_disk_path"`
 		UserData      string `json:"user_data,omitempty"`
-		UserDataPath  string `json:"user_data_Path,omitempty" yaml:"user_data_Path,omitempty"`
+		UserDataPath  string `json:"user_data_path,omitempty" yaml:"user_data_path,omitempty"`
 		StorePath     string `json:"store_path,omitempty" yaml:"store_path"`
 		RootDirectory string `json:"root_directory,omitempty" yaml:"root_directory"`
 	}
@@ -343,6 +474,8 @@ type EnvConfig struct {
 		ParallelWorkers         int                 `envconfig:"DLITE_PARALLEL_WORKERS" default:"100"`
 		PollIntervalMilliSecs   int                 `envconfig:"DLITE_POLL_INTERVAL_MILLISECS" default:"3000"`
 		PoolMapByAccount        PoolMapperByAccount `envconfig:"DLITE_POOL_MAP_BY_ACCOUNT_ID"`
+		PoolMapperFile          string              `envconfig:"DLITE_POOL_MAPPER_FILE"`
+		PoolMapperReloadSecs    int                 `envconfig:"DLITE_POOL_MAPPER_RELOAD_SECS" default:"30"`
 	}
 
 	Settings struct {
@@ -356,6 +489,11 @@ type EnvConfig struct {
 		HarnessTestBinaryURI string `envconfig:"DRONE_HARNESS_TEST_BINARY_URI"`
 		PluginBinaryURI      string `envconfig:"DRONE_PLUGIN_BINARY_URI" default:"https://github.com/drone/plugin/releases/download/v0.3.6-beta"`
 		PurgerTime           int64  `envconfig:"DRONE_PURGER_TIME_MINUTES" default:"30"`
+		// BinaryChecksums are the SHA-256 checksums of the lite engine, plugin
+		// and split_tests binaries by file name, e.g. lite-engine-linux-amd64:<sha256>.
+		// BinaryChecksumsURL is a file or URL of checksums in the format of sha256sum.
+		BinaryChecksums    map[string]string `envconfig:"DRONE_BINARY_CHECKSUMS"`
+		BinaryChecksumsURL string            `envconfig:"DRONE_BINARY_CHECKSUMS_URL"`
 	}
 	LiteEngine struct {
 		Path                string `envconfig:"DRONE_LITE_ENGINE_PATH" default:"https://github.com/harness/lite-engine/releases/download/v0.5.68/"`
@@ -396,6 +534,10 @@ type EnvConfig struct {
 	Database struct {
 		Driver     string `envconfig:"DRONE_DATABASE_DRIVER" default:"sqlite3"`
 		Datasource string `envconfig:"DRONE_DATABASE_DATASOURCE" default:"database.sqlite3"`
+		// EncryptionKeys and EncryptionKeyFile configure the keys used to
+		// encrypt the key material of instances, also in distributed mode.
+		EncryptionKeys    string `envconfig:"DRONE_DATABASE_ENCRYPTION_KEYS"`
+		EncryptionKeyFile string `envconfig:"DRONE_DATABASE_ENCRYPTION_KEY_FILE"`
 	}
 
 	DistributedMode struct {
@@ -404,6 +546,30 @@ type EnvConfig struct {
 		Enabled    bool   `envconfig:"DRONE_DISTRIBUTED_ENABLED" default:"true"`
 	}
 
+	// CA configures a runner-wide certificate authority that signs the
+	// certificates of instances. If disabled, a CA is generated per instance.
+	CA struct {
+		Enabled          bool   `envconfig:"DRONE_RUNNER_CA_ENABLED"`
+		CertFile         string `envconfig:"DRONE_RUNNER_CA_CERT_FILE" default:"ca.crt"`
+		KeyFile          string `envconfig:"DRONE_RUNNER_CA_KEY_FILE" default:"ca.key"`
+		KeyType          string `envconfig:"DRONE_RUNNER_CA_KEY_TYPE" default:"ecdsa"`
+		ValidityDays     int    `envconfig:"DRONE_RUNNER_CA_VALIDITY_DAYS" default:"3650"`
+		CertValidityDays int    `envconfig:"DRONE_RUNNER_CERT_VALIDITY_DAYS" default:"1080"`
+		RotateBeforeDays int    `envconfig:"DRONE_RUNNER_CA_ROTATE_BEFORE_DAYS" default:"30"`
+		ReloadSecs       int    `envconfig:"DRONE_RUNNER_CA_RELOAD_SECS" default:"60"`
+	}
+
+	// Tracing exports OpenTelemetry traces over OTLP/HTTP. The standard
+	// OTEL_EXPORTER_OTLP_* variables are honoured as well.
+	Tracing struct {
+		Enabled     bool              `envconfig:"DRONE_TRACING_ENABLED"`
+		Endpoint    string            `envconfig:"DRONE_TRACING_ENDPOINT"`
+		Insecure    bool              `envconfig:"DRONE_TRACING_INSECURE"`
+		Headers     map[string]string `envconfig:"DRONE_TRACING_HEADERS"`
+		ServiceName string            `envconfig:"DRONE_TRACING_SERVICE_NAME" default:"drone-runner-aws"`
+		SampleRatio float64           `envconfig:"DRONE_TRACING_SAMPLE_RATIO" default:"1"`
+	}
+
 	Tmate struct {
 		Enabled bool   `envconfig:"DRONE_TMATE_ENABLED" default:"true"`
 		Image   string `envconfig:"DRONE_TMATE_IMAGE"   default:"drone/drone-runner-docker:1"`
@@ -473,32 +639,48 @@ func FromEnviron() (EnvConfig, error) {
 	return config, nil
 }
 
+// specs maps an instance type to a constructor of its spec. The legacy
+// aliases, e.g. aws, are renamed to their instance type by migrateV1.
+var specs = map[string]func() interface{}{
+	string(types.Amazon):       func() interface{} { return new(Amazon) },
+	string(types.Anka):         func() interface{} { return new(Anka) },
+	string(types.AnkaBuild):    func() interface{} { return new(AnkaBuild) },
+	string(types.Azure):        func() interface{} { return new(Azure) },
+	string(types.DigitalOcean): func() interface{} { return new(DigitalOcean) },
+	string(types.Hetzner):      func() interface{} { return new(Hetzner) },
+	string(types.Google):       func() interface{} { return new(Google) },
+	string(types.VMFusion):     func() interface{} { return new(VMFusion) },
+	string(types.Noop):         func() interface{} { return new(Noop) },
+	string(types.Nomad):        func() interface{} { return new(Nomad) },
+}
+
+// NewSpec returns a pointer to an empty spec for the given instance type.
+func NewSpec(instanceType string) (interface{}, error) {
+	fn, ok := specs[instanceType]
+	if !ok {
+		return nil, fmt.Errorf("unknown instance type %s", instanceType)
+	}
+	return fn(), nil
+}
+
+// InstanceTypes returns the sorted list of instance types, without the
+// legacy aliases, which only version 1 pool files may use.
+func InstanceTypes() []string {
+	t := make([]string, 0, len(specs))
+	for k := range specs {
+		t = append(t, k)
+	}
+	sort.Strings(t)
+	return t
+}
+
 // Populates the Spec field of the Instance struct based on the Type field.
 func (s *Instance) populateSpec() error {
-	switch s.Type {
-	case string(types.Amazon), "aws":
-		s.Spec = new(Amazon)
-	case string(types.Anka):
-		s.Spec = new(Anka)
-	case string(types.AnkaBuild):
-		s.Spec = new(AnkaBuild)
-	case string(types.Azure):
-		s.Spec = new(Azure)
-	case string(types.DigitalOcean):
-		s.Spec = new(DigitalOcean)
-    case string(types.Hetzner):
-        s.Spec = new(Hetzner)
-	case string(types.Google), "gcp":
-		s.Spec = new(Google)
-	case string(types.VMFusion):
-		s.Spec = new(VMFusion)
-	case string(types.Noop):
-		s.Spec = new(Noop)
-	case string(types.Nomad):
-		s.Spec = new(Nomad)
-	default:
-		return fmt.Errorf("unknown instance type %s", s.Type)
+	spec, err := NewSpec(s.Type)
+	if err != nil {
+		return err
 	}
+	s.Spec = spec
 	return nil
 }
 
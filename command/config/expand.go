@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	keyDefaults  = "defaults"
+	keyInstances = "instances"
+	keyExtends   = "extends"
+	keyName      = "name"
+	keyType      = "type"
+	keyDefault   = "default"
+)
+
+// ExpandError is a problem found while applying defaults and extends.
+type ExpandError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ExpandError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ExpandErrors is the list of all problems found while applying defaults and extends.
+type ExpandErrors []*ExpandError
+
+func (e ExpandErrors) Error() string {
+	s := make([]string, len(e))
+	for i := range e {
+		s[i] = e[i].Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Render upgrades a pool file to the latest version, resolves its references
+// and expands its defaults and extends, returning the pool file as it is
+// going to be used.
+func Render(data []byte) ([]byte, error) {
+	return render(data, true)
+}
+
+// Expand upgrades a pool file to the latest version and expands its defaults
+// and extends like Render, but leaves its references as they are, so that the
+// secrets they resolve to are not revealed when it is printed.
+func Expand(data []byte) ([]byte, error) {
+	return render(data, false)
+}
+
+func render(data []byte, interpolate bool) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	if err := MigrateNode(&doc); err != nil {
+		return nil, err
+	}
+	if interpolate {
+		if errs := InterpolateNode(&doc); len(errs) > 0 {
+			return nil, errs
+		}
+	}
+	if errs := ExpandNode(&doc); len(errs) > 0 {
+		return nil, errs
+	}
+	if interpolate {
+		RetypeNode(&doc, reflect.TypeOf(PoolFile{}))
+	}
+	return encode(&doc)
+}
+
+// ExpandNode deep merges the defaults of each instance type and the instance
+// named by extends into every instance, in that order of precedence, and
+// removes the defaults section. Mappings are merged key by key, any other
+// value of the instance replaces the inherited one. The name, default and
+// extends keys are never inherited.
+func ExpandNode(doc *yamlv3.Node) ExpandErrors {
+	if doc.Kind == yamlv3.DocumentNode {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	e := &expander{
+		defaults: map[string]*yamlv3.Node{},
+		byName:   map[string]int{},
+		resolved: map[int]*yamlv3.Node{},
+		visiting: map[int]bool{},
+	}
+	if defaults := removeKey(doc, keyDefaults); defaults != nil && defaults.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(defaults.Content); i += 2 {
+			key := defaults.Content[i]
+			if _, err := NewSpec(key.Value); err != nil {
+				e.add(key, "defaults: %s", err)
+				continue
+			}
+			e.defaults[key.Value] = defaults.Content[i+1]
+		}
+	}
+
+	instances := valueOf(doc, keyInstances)
+	if instances == nil || instances.Kind != yamlv3.SequenceNode {
+		return e.errs
+	}
+	e.instances = instances.Content
+	for i, inst := range e.instances {
+		if name := valueOf(inst, keyName); name != nil {
+			if _, ok := e.byName[name.Value]; !ok {
+				e.byName[name.Value] = i
+			}
+		}
+	}
+	expanded := make([]*yamlv3.Node, len(e.instances))
+	for i := range e.instances {
+		expanded[i] = e.resolve(i)
+	}
+	instances.Content = expanded
+	return e.errs
+}
+
+type expander struct {
+	defaults  map[string]*yamlv3.Node
+	instances []*yamlv3.Node
+	byName    map[string]int
+	resolved  map[int]*yamlv3.Node
+	visiting  map[int]bool
+	errs      ExpandErrors
+}
+
+func (e *expander) add(n *yamlv3.Node, format string, args ...interface{}) {
+	e.errs = append(e.errs, &ExpandError{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve returns the expanded instance at index i.
+func (e *expander) resolve(i int) *yamlv3.Node {
+	if n, ok := e.resolved[i]; ok {
+		return n
+	}
+	inst := e.instances[i]
+	if inst.Kind != yamlv3.MappingNode {
+		return inst
+	}
+	e.visiting[i] = true
+	defer delete(e.visiting, i)
+
+	var base *yamlv3.Node
+	if extends := valueOf(inst, keyExtends); extends != nil {
+		parent, ok := e.byName[extends.Value]
+		switch {
+		case !ok:
+			e.add(extends, "instance extends unknown instance %q", extends.Value)
+		case e.visiting[parent]:
+			e.add(extends, "instance extends %q, which leads to a cycle", extends.Value)
+		default:
+			base = withoutKeys(e.resolve(parent), keyName, keyDefault)
+		}
+	}
+
+	typ := valueOf(inst, keyType)
+	if typ == nil {
+		typ = valueOf(base, keyType)
+	}
+	if typ != nil {
+		if defaults, ok := e.defaults[typ.Value]; ok {
+			base = merge(defaults, base)
+		}
+	}
+
+	n := merge(base, withoutKeys(inst, keyExtends))
+	e.resolved[i] = n
+	return n
+}
+
+// merge returns over deep merged on top of base. Neither node is modified.
+func merge(base, over *yamlv3.Node) *yamlv3.Node {
+	switch {
+	case base == nil:
+		return over
+	case over == nil:
+		return base
+	case base.Kind != yamlv3.MappingNode || over.Kind != yamlv3.MappingNode:
+		return over
+	}
+	out := *over
+	out.Content = nil
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, val := over.Content[i], over.Content[i+1]
+		out.Content = append(out.Content, key, merge(valueOf(base, key.Value), val))
+	}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		if indexOf(over, base.Content[i].Value) < 0 {
+			out.Content = append(out.Content, base.Content[i], base.Content[i+1])
+		}
+	}
+	return &out
+}
+
+func withoutKeys(n *yamlv3.Node, keys ...string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return n
+	}
+	out := *n
+	out.Content = nil
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !contains(keys, n.Content[i].Value) {
+			out.Content = append(out.Content, n.Content[i], n.Content[i+1])
+		}
+	}
+	return &out
+}
+
+func indexOf(n *yamlv3.Node, key string) int {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func valueOf(n *yamlv3.Node, key string) *yamlv3.Node {
+	if i := indexOf(n, key); i >= 0 {
+		return n.Content[i+1]
+	}
+	return nil
+}
+
+func removeKey(n *yamlv3.Node, key string) *yamlv3.Node {
+	i := indexOf(n, key)
+	if i < 0 {
+		return nil
+	}
+	val := n.Content[i+1]
+	n.Content = append(n.Content[:i], n.Content[i+2:]...)
+	return val
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
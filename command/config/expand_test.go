@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const inheritedPoolFile = `version: "1"
+defaults:
+  amazon:
+    limit: 10
+    spec:
+      account:
+        region: us-east-2
+        access_key_id: id
+        access_key_secret: secret
+      disk:
+        size: 32
+      tags:
+        team: ci
+instances:
+  - name: linux-base
+    type: amazon
+    default: true
+    pool: 1
+    spec:
+      ami: ami-base
+      size: t3.large
+      tags:
+        os: linux
+  - name: linux-us-east-2a
+    extends: linux-base
+    spec:
+      account:
+        availability_zone: us-east-2a
+      size: t3.xlarge
+  - name: linux-gpu
+    extends: linux-us-east-2a
+    limit: 2
+    spec:
+      disk:
+        size: 100
+`
+
+func TestParse_Expand(t *testing.T) {
+	pool, err := Parse(strings.NewReader(inheritedPoolFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Defaults) != 0 {
+		t.Errorf("want defaults to be removed, got %v", pool.Defaults)
+	}
+
+	gpu := pool.Instances[2]
+	spec := gpu.Spec.(*Amazon)
+	if gpu.Type != "amazon" || gpu.Default || gpu.Extends != "" || gpu.Pool != 1 || gpu.Limit != 2 {
+		t.Errorf("unexpected instance %+v", gpu)
+	}
+	for _, c := range []struct{ got, want string }{
+		{spec.Account.Region, "us-east-2"},
+		{spec.Account.AccessKeySecret, "secret"},
+		{spec.Account.AvailabilityZone, "us-east-2a"},
+		{spec.AMI, "ami-base"},
+		{spec.Size, "t3.xlarge"},
+		{spec.Tags["team"], "ci"},
+		{spec.Tags["os"], "linux"},
+	} {
+		if c.got != c.want {
+			t.Errorf("want %q, got %q", c.want, c.got)
+		}
+	}
+	if spec.Disk.Size != 100 {
+		t.Errorf("want disk size 100, got %d", spec.Disk.Size)
+	}
+
+	base := pool.Instances[0].Spec.(*Amazon)
+	if base.Account.AvailabilityZone != "" || base.Disk.Size != 32 || pool.Instances[0].Limit != 10 {
+		t.Errorf("want the extended instance to be unchanged, got %+v", base)
+	}
+}
+
+func TestParse_ExpandErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader(`defaults:
+  unknown: {}
+instances:
+  - name: a
+    extends: b
+  - name: b
+    extends: a
+  - name: c
+    extends: missing
+`))
+	var errs ExpandErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("want expand errors, got %v", err)
+	}
+	var lines []int
+	for _, e := range errs {
+		lines = append(lines, e.Line)
+	}
+	if len(errs) != 3 || lines[0] != 2 || lines[1] != 7 || lines[2] != 9 {
+		t.Errorf("unexpected errors:\n%s", errs)
+	}
+}
+
+func TestExpand_Unresolved(t *testing.T) {
+	t.Setenv("TEST_AWS_SECRET", "do-not-print")
+	out, err := Expand([]byte(`version: "1"
+defaults:
+  amazon:
+    spec:
+      account:
+        access_key_secret: ${TEST_AWS_SECRET}
+        aws_session_token: ${file:/etc/drone/token}
+instances:
+  - name: linux
+    type: amazon
+    spec:
+      ami: ami-base
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "do-not-print") || strings.Contains(string(out), "defaults") {
+		t.Errorf("want the defaults expanded without resolving the references, got:\n%s", out)
+	}
+	for _, ref := range []string{"${TEST_AWS_SECRET}", "${file:/etc/drone/token}", "ami-base"} {
+		if !strings.Contains(string(out), ref) {
+			t.Errorf("want %s in the expanded pool file, got:\n%s", ref, out)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// referencePattern matches ${NAME}, ${NAME:-default}, ${file:/path} and the
+// escaped form $${...} which is left as ${...}.
+var referencePattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+const filePrefix = "file:"
+
+// uninterpolatedKeys are the keys whose values are never interpolated, as
+// they hold scripts which commonly use ${VAR} themselves.
+var uninterpolatedKeys = map[string]bool{
+	"user_data":      true,
+	"user_data_path": true,
+}
+
+// InterpolationError is a reference in the pool file that could not be resolved.
+type InterpolationError struct {
+	Line      int
+	Column    int
+	Reference string
+	Reason    string
+}
+
+func (e *InterpolationError) Error() string {
+	return fmt.Sprintf("line %d: unable to resolve ${%s}: %s", e.Line, e.Reference, e.Reason)
+}
+
+// InterpolationErrors is the list of all unresolved references in a pool file.
+type InterpolationErrors []*InterpolationError
+
+func (e InterpolationErrors) Error() string {
+	s := make([]string, len(e))
+	for i := range e {
+		s[i] = e[i].Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// InterpolateNode resolves the references in the scalar values of the YAML
+// node tree in place and returns the ones that could not be resolved:
+//
+//	${NAME}            the value of the environment variable NAME
+//	${NAME:-default}   the value of NAME, or default if NAME is unset or empty
+//	${file:/path}      the contents of the file, without trailing newlines
+//	$${NAME}           the literal text ${NAME}
+//
+// Keys, comments and the values of user_data and user_data_path are never
+// interpolated. The values substituted are strings, RetypeNode turns those
+// of numeric and boolean fields back into numbers and booleans.
+func InterpolateNode(n *yamlv3.Node) InterpolationErrors {
+	var errs InterpolationErrors
+	interpolateNode(n, &errs)
+	return errs
+}
+
+func interpolateNode(n *yamlv3.Node, errs *InterpolationErrors) {
+	switch n.Kind {
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		for _, c := range n.Content {
+			interpolateNode(c, errs)
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if uninterpolatedKeys[n.Content[i].Value] {
+				continue
+			}
+			interpolateNode(n.Content[i+1], errs)
+		}
+	case yamlv3.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return
+		}
+		n.Value = referencePattern.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			name := ref[2 : len(ref)-1]
+			value, err := resolve(name)
+			if err != nil {
+				*errs = append(*errs, &InterpolationError{Line: n.Line, Column: n.Column, Reference: name, Reason: err.Error()})
+			}
+			return value
+		})
+	}
+}
+
+// RetypeNode resolves the plain string scalars of the numeric and boolean
+// fields of t again, so that e.g. "pool: ${POOL_SIZE:-2}" is an integer once
+// interpolated, while "pat: ${PAT}" stays a string whatever its value. The
+// spec of an instance is typed by its type, so the node tree must be expanded.
+func RetypeNode(n *yamlv3.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch n.Kind {
+	case yamlv3.DocumentNode:
+		for _, c := range n.Content {
+			RetypeNode(c, t)
+		}
+	case yamlv3.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, c := range n.Content {
+				RetypeNode(c, t.Elem())
+			}
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			switch t.Kind() {
+			case reflect.Map:
+				RetypeNode(n.Content[i+1], t.Elem())
+			case reflect.Struct:
+				if ft := fieldType(n, t, n.Content[i].Value); ft != nil {
+					RetypeNode(n.Content[i+1], ft)
+				}
+			}
+		}
+	case yamlv3.ScalarNode:
+		if n.Style != 0 || n.Tag != "!!str" {
+			return
+		}
+		switch t.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			n.Tag = ""
+		}
+	}
+}
+
+// fieldType returns the type of the field of the struct t with the JSON name,
+// nil if there is none. The spec of an instance has the type of its type key.
+func fieldType(n *yamlv3.Node, t reflect.Type, name string) reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if typ := fieldType(n, ft, name); typ != nil {
+					return typ
+				}
+			}
+			continue
+		}
+		if tag != name {
+			continue
+		}
+		if t == reflect.TypeOf(Instance{}) && name == "spec" {
+			typ := valueOf(n, "type")
+			if typ == nil {
+				return nil
+			}
+			spec, err := NewSpec(typ.Value)
+			if err != nil {
+				return nil
+			}
+			return reflect.TypeOf(spec)
+		}
+		return f.Type
+	}
+	return nil
+}
+
+func resolve(ref string) (string, error) {
+	if strings.HasPrefix(ref, filePrefix) {
+		path := strings.TrimPrefix(ref, filePrefix)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	name, def, hasDefault := strings.Cut(ref, ":-")
+	if name == "" {
+		return "", fmt.Errorf("empty variable name")
+	}
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		return value, nil
+	}
+	if hasDefault {
+		return def, nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse_Interpolate(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_AWS_KEY_ID", "from-env")
+	t.Setenv("TEST_EMPTY", "")
+
+	pool, err := Parse(strings.NewReader(`version: "1"
+instances:
+  - name: ${TEST_NAME:-linux-amd64}
+    type: amazon
+    pool: ${TEST_POOL:-2}
+    limit: 10
+    spec:
+      account:
+        region: ${TEST_EMPTY:-us-east-2}
+        access_key_id: ${TEST_AWS_KEY_ID}
+        access_key_secret: ${file:` + secret + `}
+      ami: $${NOT_INTERPOLATED}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inst := pool.Instances[0]
+	spec := inst.Spec.(*Amazon)
+	for _, c := range []struct{ got, want string }{
+		{inst.Name, "linux-amd64"},
+		{spec.Account.Region, "us-east-2"},
+		{spec.Account.AccessKeyID, "from-env"},
+		{spec.Account.AccessKeySecret, "from-file"},
+		{spec.AMI, "${NOT_INTERPOLATED}"},
+	} {
+		if c.got != c.want {
+			t.Errorf("want %q, got %q", c.want, c.got)
+		}
+	}
+	if inst.Pool != 2 {
+		t.Errorf("want pool size 2, got %d", inst.Pool)
+	}
+}
+
+func TestParse_Unresolved(t *testing.T) {
+	_, err := Parse(strings.NewReader(`instances:
+  - name: a
+    type: digitalocean
+    spec:
+      account:
+        pat: ${TEST_UNSET_PAT}
+      region: ${file:/does/not/exist}
+`))
+	var errs InterpolationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("want interpolation errors, got %v", err)
+	}
+	if len(errs) != 2 || errs[0].Line != 6 || errs[0].Reference != "TEST_UNSET_PAT" || errs[1].Line != 7 {
+		t.Errorf("unexpected errors:\n%s", errs)
+	}
+}
+
+func TestParse_InterpolateTypes(t *testing.T) {
+	t.Setenv("TEST_PAT", "123456")
+	t.Setenv("TEST_DISK_SIZE", "100")
+	t.Setenv("TEST_HIBERNATE", "true")
+
+	pool, err := Parse(strings.NewReader(`version: "1"
+defaults:
+  amazon:
+    spec:
+      disk:
+        size: ${TEST_DISK_SIZE}
+instances:
+  - name: do
+    type: digitalocean
+    spec:
+      account:
+        pat: ${TEST_PAT}
+  - name: aws
+    type: amazon
+    spec:
+      ami: ${TEST_PAT}
+  - name: noop
+    type: noop
+    spec:
+      hibernate: ${TEST_HIBERNATE}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.Instances[0].Spec.(*DigitalOcean).Account.PAT; got != "123456" {
+		t.Errorf("want a numeric value of a string field kept as a string, got %q", got)
+	}
+	amazon := pool.Instances[1].Spec.(*Amazon)
+	if amazon.AMI != "123456" || amazon.Disk.Size != 100 {
+		t.Errorf("want the ami %q and disk size 100, got %q and %d", "123456", amazon.AMI, amazon.Disk.Size)
+	}
+	if !pool.Instances[2].Spec.(*Noop).Hibernate {
+		t.Errorf("want a boolean field interpolated as a boolean")
+	}
+}
+
+func TestParse_UserDataNotInterpolated(t *testing.T) {
+	userdata := `#!/bin/sh
+echo "${TEST_UNSET_VAR}" $${HOME}`
+	pool, err := Parse(strings.NewReader(`instances:
+  - name: do
+    type: digitalocean
+    spec:
+      user_data: |
+        ` + strings.ReplaceAll(userdata, "\n", "\n        ") + `
+      user_data_path: /etc/drone/${TEST_UNSET_VAR}.sh
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := pool.Instances[0].Spec.(*DigitalOcean)
+	if spec.UserData != userdata+"\n" {
+		t.Errorf("want the user data unchanged, got %q", spec.UserData)
+	}
+	if spec.UserDataPath != "/etc/drone/${TEST_UNSET_VAR}.sh" {
+		t.Errorf("want the user data path unchanged, got %q", spec.UserDataPath)
+	}
+}
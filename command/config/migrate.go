@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Pool file versions. Files without a version are treated as Version1.
+const (
+	// Version1 is the original format. It spells the user data path key
+	// user_data_Path and accepts aws and gcp as instance types.
+	Version1 = "1"
+	// Version2 spells the key user_data_path and only accepts the canonical
+	// instance types amazon and google.
+	Version2 = "2"
+
+	LatestVersion = Version2
+)
+
+const keyVersion = "version"
+
+// migration upgrades a pool file from one version to the next.
+type migration struct {
+	next    string
+	migrate func(root *yamlv3.Node)
+}
+
+var migrations = map[string]migration{
+	Version1: {next: Version2, migrate: migrateV1},
+	Version2: {},
+}
+
+// legacyTypes maps the instance type aliases of Version1 to their canonical names.
+var legacyTypes = map[string]string{
+	"aws": "amazon",
+	"gcp": "google",
+}
+
+// legacyKeys maps the keys of Version1 to their Version2 spelling.
+var legacyKeys = map[string]string{
+	"user_data_Path": "user_data_path",
+}
+
+// SupportedVersions returns the pool file versions that can be loaded.
+func SupportedVersions() []string {
+	versions := make([]string, 0, len(migrations))
+	for v := range migrations {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// VersionOf returns the version of a pool file, or an empty string if it
+// cannot be read.
+func VersionOf(data []byte) string {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return ""
+	}
+	return versionOf(doc.Content[0])
+}
+
+func versionOf(root *yamlv3.Node) string {
+	if v := valueOf(root, keyVersion); v != nil && v.Value != "" {
+		return v.Value
+	}
+	return Version1
+}
+
+// Migrate rewrites a pool file to the latest version. Comments, references
+// and inheritance are kept as they are.
+func Migrate(data []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	if err := MigrateNode(&doc); err != nil {
+		return nil, err
+	}
+	return encode(&doc)
+}
+
+func encode(doc *yamlv3.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2) //nolint:gomnd
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// MigrateNode upgrades the YAML node tree of a pool file in place to the
+// latest version. It fails if the version of the file is not supported.
+func MigrateNode(doc *yamlv3.Node) error {
+	root := doc
+	if root.Kind == yamlv3.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil
+		}
+		root = root.Content[0]
+	}
+	if root.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	version := versionOf(root)
+	for version != LatestVersion {
+		m, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("unsupported pool file version %q, supported versions are %s",
+				version, strings.Join(SupportedVersions(), ", "))
+		}
+		m.migrate(root)
+		version = m.next
+	}
+
+	if v := valueOf(root, keyVersion); v != nil {
+		v.Value, v.Tag, v.Style = version, "!!str", yamlv3.DoubleQuotedStyle
+		return nil
+	}
+	root.Content = append([]*yamlv3.Node{
+		{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: keyVersion},
+		{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: version, Style: yamlv3.DoubleQuotedStyle},
+	}, root.Content...)
+	return nil
+}
+
+// migrateV1 renames the legacy instance types and keys.
+func migrateV1(root *yamlv3.Node) {
+	if instances := valueOf(root, keyInstances); instances != nil && instances.Kind == yamlv3.SequenceNode {
+		for _, inst := range instances.Content {
+			if typ := valueOf(inst, keyType); typ != nil {
+				if canonical, ok := legacyTypes[typ.Value]; ok {
+					typ.Value = canonical
+				}
+			}
+			renameKeys(inst)
+		}
+	}
+	if defaults := valueOf(root, keyDefaults); defaults != nil && defaults.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(defaults.Content); i += 2 {
+			if canonical, ok := legacyTypes[defaults.Content[i].Value]; ok {
+				defaults.Content[i].Value = canonical
+			}
+			renameKeys(defaults.Content[i+1])
+		}
+	}
+}
+
+func renameKeys(n *yamlv3.Node) {
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if key, ok := legacyKeys[n.Content[i].Value]; ok {
+				n.Content[i].Value = key
+			}
+			renameKeys(n.Content[i+1])
+		}
+	case yamlv3.SequenceNode:
+		for _, c := range n.Content {
+			renameKeys(c)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const legacyPoolFile = `# pools of the ci cluster
+instances:
+  - name: linux
+    type: aws
+    spec:
+      account:
+        region: ${AWS_REGION:-us-east-2}
+      user_data_Path: /etc/runner/linux.yml
+  - name: windows
+    type: gcp
+    spec:
+      project_id: ci
+      user_data_Path: /etc/runner/windows.yml
+`
+
+func TestMigrate(t *testing.T) {
+	out, err := Migrate([]byte(legacyPoolFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		`version: "2"`,
+		"# pools of the ci cluster",
+		"type: amazon",
+		"type: google",
+		"user_data_path: /etc/runner/linux.yml",
+		"${AWS_REGION:-us-east-2}",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "user_data_Path") {
+		t.Errorf("want legacy keys to be renamed in:\n%s", got)
+	}
+}
+
+func TestParse_Legacy(t *testing.T) {
+	pool, err := Parse(strings.NewReader(legacyPoolFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Version != LatestVersion {
+		t.Errorf("want version %s, got %s", LatestVersion, pool.Version)
+	}
+	amazon, ok := pool.Instances[0].Spec.(*Amazon)
+	if !ok || pool.Instances[0].Type != "amazon" || amazon.UserDataPath != "/etc/runner/linux.yml" {
+		t.Errorf("unexpected instance %+v", pool.Instances[0])
+	}
+	google, ok := pool.Instances[1].Spec.(*Google)
+	if !ok || pool.Instances[1].Type != "google" || google.UserDataPath != "/etc/runner/windows.yml" {
+		t.Errorf("unexpected instance %+v", pool.Instances[1])
+	}
+}
+
+func TestParse_UnsupportedVersion(t *testing.T) {
+	_, err := Parse(strings.NewReader("version: \"3\"\ninstances: []\n"))
+	if err == nil || !strings.Contains(err.Error(), `unsupported pool file version "3", supported versions are 1, 2`) {
+		t.Errorf("want unsupported version error, got %v", err)
+	}
+}
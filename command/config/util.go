@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"reflect"
 
 	"github.com/ghodss/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 func ParseFile(rawFile string) (*PoolFile, error) {
@@ -22,13 +24,33 @@ func ParseFile(rawFile string) (*PoolFile, error) {
 	return inst, nil
 }
 
-// Parse parses the configuration from io.Reader r.
+// Parse parses the configuration from io.Reader r, resolving the environment
+// variable and file references in its values and expanding defaults and extends.
 func Parse(r io.Reader) (*PoolFile, error) {
 	b, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	b, err = yaml.YAMLToJSON(b)
+	b, err = Render(b)
+	if err != nil {
+		return nil, err
+	}
+	return decode(b)
+}
+
+// Decode decodes a pool file from its YAML node tree, once it is upgraded,
+// its references are resolved and its defaults and extends are expanded.
+func Decode(doc *yamlv3.Node) (*PoolFile, error) {
+	RetypeNode(doc, reflect.TypeOf(PoolFile{}))
+	b, err := encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return decode(b)
+}
+
+func decode(b []byte) (*PoolFile, error) {
+	b, err := yaml.YAMLToJSON(b)
 	if err != nil {
 		return nil, err
 	}
@@ -18,7 +18,9 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/match"
 	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/environ/provider"
 	"github.com/drone/runner-go/handler/router"
@@ -72,6 +74,13 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		println("daemon: received signal, terminating process")
 		cancel()
 	})
+
+	// export traces, if enabled.
+	shutdownTracing, err := tracing.Setup(ctx, &env)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(nocontext) //nolint:errcheck
 	// we check that we have the following 2 env variables
 	if env.Client.Host == "" {
 		logrus.Fatalln("daemon: missing required environment variable DRONE_RUNNER_HOST")
@@ -96,7 +105,11 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		),
 	)
 
-	store, _, err := database.ProvideStore(env.Database.Driver, env.Database.Datasource)
+	keys, err := encrypt.Load(env.Database.EncryptionKeys, env.Database.EncryptionKeyFile)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Unable to load the database encryption keys")
+	}
+	store, _, err := database.ProvideStore(env.Database.Driver, env.Database.Datasource, keys)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
 	}
@@ -122,6 +135,18 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 			Fatalln("daemon: unable to add to the pool")
 	}
 
+	err = poolManager.AddCertificateAuthority(&env)
+	if err != nil {
+		logrus.WithError(err).
+			Fatalln("daemon: unable to set up the certificate authority")
+	}
+
+	err = poolManager.AddChecksums(&env)
+	if err != nil {
+		logrus.WithError(err).
+			Fatalln("daemon: unable to load the binary checksums")
+	}
+
 	if poolManager.Count() == 0 {
 		logrus.Fatalln("daemon: no instance pools found... aborting")
 	}
@@ -343,7 +368,7 @@ func Register(app *kingpin.Application) {
 	cmd.Flag("envfile", "load the environment variable file").
 		Default("").
 		StringVar(&c.envFile)
-	cmd.Flag("pool", "file to seed the pool").
+	cmd.Flag("pool", "file, directory or glob of pool files to seed the pool").
 		Default("").
 		StringVar(&c.poolFile)
 }
@@ -7,6 +7,7 @@ package command
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -22,6 +23,7 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
 	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/envsubst"
 	"github.com/drone/runner-go/environ"
@@ -54,19 +56,93 @@ type execCommand struct {
 	Debug         bool
 	Trace         bool
 	Dump          bool
+	Output        string
 }
 
-func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its complex but not too bad.
+// exitError annotates an error with the exit code of the exec command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func configError(err error) error {
+	return &exitError{code: exitCodeConfig, err: err}
+}
+
+func (c *execCommand) run(*kingpin.ParseContext) error {
+	var events *eventWriter
+	if c.Output == outputJSON {
+		events = newEventWriter(os.Stdout)
+	}
+
+	state, code, err := c.exec(events)
+
+	status := ""
+	if state != nil {
+		status = state.Stage.Status
+	}
+	events.emit(&execEvent{
+		Type:     eventPipelineFinished,
+		Status:   status,
+		ExitCode: &code,
+		Error:    errString(err),
+	})
+
+	if code != exitCodeSuccess {
+		entry := logrus.WithField("exit_code", code)
+		if err != nil {
+			entry = entry.WithError(err)
+		}
+		entry.Errorln("exec: pipeline errored/failed/killed")
+		os.Exit(code)
+	}
+	return nil
+}
+
+// exec executes the pipeline and returns its final state together with the
+// exit code of the failure class, if any.
+func (c *execCommand) exec(events *eventWriter) (*pipeline.State, int, error) {
+	state, eng, err := c.execute(events)
+	code, err := exitCode(state, eng, err)
+	return state, code, err
+}
+
+// exitCode maps the outcome of the pipeline to the exit code of its failure
+// class, returning the error which caused it, if any.
+func exitCode(state *pipeline.State, eng *eventEngine, err error) (int, error) {
+	var ee *exitError
+	switch {
+	case errors.As(err, &ee):
+		return ee.code, ee.err
+	case eng != nil && eng.setupErr != nil:
+		return exitCodeProvision, eng.setupErr
+	case err != nil:
+		return exitCodeInternal, err
+	}
+	switch state.Stage.Status {
+	case drone.StatusKilled:
+		return exitCodeCanceled, nil
+	case drone.StatusError:
+		return exitCodeInternal, nil
+	case drone.StatusFailing:
+		return exitCodeFailure, nil
+	}
+	return exitCodeSuccess, nil
+}
+
+func (c *execCommand) execute(events *eventWriter) (*pipeline.State, *eventEngine, error) { //nolint:gocyclo // its complex but not too bad.
 	const runnerName = "exec"
 
 	rawsource, err := io.ReadAll(c.Source)
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 	// load the environment configuration from the environment
 	envConfig, err := config.FromEnviron()
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 	envs := environ.Combine(
 		c.Environ,
@@ -92,20 +168,20 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	// evaluates string replacement expressions and returns an update configuration.
 	env, err := envsubst.Eval(string(rawsource), subf)
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 
 	// parse and lint the configuration.
 	mnfst, err := manifest.ParseString(env)
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 
 	// a configuration can contain multiple pipelines.
 	// get a specific pipeline resource for execution.
 	res, err := resource.Lookup(c.Stage.Name, mnfst)
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 
 	// configures the pipeline timeout.
@@ -122,19 +198,26 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	configPool, confErr := poolfile.ConfigPoolFile(c.PoolFile, &envConfig)
 	if confErr != nil {
 		logrus.WithError(confErr).
-			Fatalln("exec: unable to load pool file, or use an in memory pool file")
+			Errorln("exec: unable to load pool file, or use an in memory pool file")
+		return nil, nil, configError(confErr)
 	}
 
 	pools, err := poolfile.ProcessPool(configPool, runnerName)
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("exec: unable to process pool file")
-		return err
+		return nil, nil, configError(err)
+	}
+	keys, err := encrypt.Load(envConfig.Database.EncryptionKeys, envConfig.Database.EncryptionKeyFile)
+	if err != nil {
+		logrus.WithError(err).Errorln("Unable to load the database encryption keys")
+		return nil, nil, err
 	}
 	// use a single instance db, as we only need one machine
-	store, _, err := database.ProvideStore(database.SingleInstance, "")
+	store, _, err := database.ProvideStore(database.SingleInstance, "", keys)
 	if err != nil {
-		logrus.WithError(err).Fatalln("Unable to start the database")
+		logrus.WithError(err).Errorln("Unable to start the database")
+		return nil, nil, err
 	}
 
 	if c.LiteEngineURL != "" {
@@ -146,7 +229,7 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	poolManager := drivers.New(ctx, store, &envConfig)
 	err = poolManager.Add(pools...)
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 
 	// compile the pipeline to an intermediate representation.
@@ -164,7 +247,7 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	lint.PoolManager = poolManager
 	err = lint.Lint(res, c.Repo)
 	if err != nil {
-		return err
+		return nil, nil, configError(err)
 	}
 
 	// set the pools into the compiler
@@ -248,33 +331,36 @@ func (c *execCommand) run(*kingpin.ParseContext) error { //nolint:gocyclo // its
 	)
 	engineInstance, err := engine.New(engine.Opts{Repopulate: false}, poolManager, &envConfig)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	eng := &eventEngine{Engine: engineInstance, events: events}
+
+	var streamer pipeline.Streamer = console.New(c.Pretty)
+	if events != nil {
+		streamer = &eventStreamer{events: events}
 	}
 
 	err = runtime.NewExecer(
 		pipeline.NopReporter(),
-		console.New(c.Pretty),
+		streamer,
 		pipeline.NopUploader(),
-		engineInstance,
+		eng,
 		c.Procs,
 	).Exec(ctx, spec, state)
 
 	if c.Dump {
-		dump(state)
-	}
-	if err != nil {
-		return err
-	}
-	switch state.Stage.Status {
-	case drone.StatusError, drone.StatusFailing, drone.StatusKilled:
-		logrus.WithError(err).
-			Fatalln("exec: pipeline errored/failed/killed")
+		// keep stdout for the events, one per line
+		out := io.Writer(os.Stdout)
+		if events != nil {
+			out = os.Stderr
+		}
+		dump(out, state)
 	}
-	return nil
+	return state, eng, err
 }
 
-func dump(v interface{}) {
-	enc := json.NewEncoder(os.Stdout)
+func dump(w io.Writer, v interface{}) {
+	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	_ = enc.Encode(v)
 }
@@ -291,7 +377,7 @@ func registerExec(app *kingpin.Application) {
 		Default(".drone.yml").
 		FileVar(&c.Source)
 
-	cmd.Flag("pool", "file to seed the pool").
+	cmd.Flag("pool", "file, directory or glob of pool files to seed the pool").
 		StringVar(&c.PoolFile)
 
 	cmd.Flag("secrets", "secret parameters").
@@ -315,12 +401,16 @@ func registerExec(app *kingpin.Application) {
 	cmd.Flag("trace", "enable trace logging").
 		BoolVar(&c.Trace)
 
-	cmd.Flag("dump", "dump the pipeline state to stdout").
+	cmd.Flag("dump", "dump the pipeline state to stdout, or to stderr with --output json").
 		BoolVar(&c.Dump)
 
 	cmd.Flag("lite-engine-url", "web url for the lite-engine binaries").
 		StringVar(&c.LiteEngineURL)
 
+	cmd.Flag("output", "output format, text or json. json emits a stream of events, one per line").
+		Default(outputText).
+		EnumVar(&c.Output, outputText, outputJSON)
+
 	cmd.Flag("pretty", "pretty print the output").
 		Default(
 			fmt.Sprint(
@@ -0,0 +1,177 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/engine"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/pipeline/runtime"
+)
+
+// output formats of the exec command.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// exit codes of the exec command, one per failure class.
+const (
+	exitCodeSuccess   = 0
+	exitCodeFailure   = 1 // a pipeline step failed
+	exitCodeConfig    = 2 // the pipeline, the pool file or the flags are invalid
+	exitCodeProvision = 3 // an instance could not be provisioned or set up
+	exitCodeCanceled  = 4 // the pipeline was canceled or timed out
+	exitCodeInternal  = 5 // a step could not be executed
+)
+
+// event types emitted with --output json.
+const (
+	eventInstanceSetup    = "instance_setup"
+	eventStepStarted      = "step_started"
+	eventStepOutput       = "step_output"
+	eventStepFinished     = "step_finished"
+	eventPipelineFinished = "pipeline_finished"
+)
+
+// execEvent is a single line of the JSON event stream.
+type execEvent struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Pool       string    `json:"pool,omitempty"`
+	InstanceID string    `json:"instance_id,omitempty"`
+	InstanceIP string    `json:"instance_ip,omitempty"`
+	Step       string    `json:"step,omitempty"`
+	Line       string    `json:"line,omitempty"`
+	DurationMS *int64    `json:"duration_ms,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	OOMKilled  bool      `json:"oom_killed,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// eventWriter writes events as JSON lines. A nil eventWriter discards them.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *eventWriter) emit(e *execEvent) {
+	if w == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	w.mu.Lock()
+	_ = w.enc.Encode(e)
+	w.mu.Unlock()
+}
+
+func durationMS(d time.Duration) *int64 {
+	ms := d.Milliseconds()
+	return &ms
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// eventEngine wraps the engine to time the instance setup and the steps and to
+// remember whether the setup failed.
+type eventEngine struct {
+	runtime.Engine
+	events   *eventWriter
+	setupErr error
+}
+
+func (e *eventEngine) Setup(ctx context.Context, specv runtime.Spec) error {
+	start := time.Now()
+	err := e.Engine.Setup(ctx, specv)
+	e.setupErr = err
+
+	spec := specv.(*engine.Spec)
+	e.events.emit(&execEvent{
+		Type:       eventInstanceSetup,
+		Pool:       spec.CloudInstance.PoolName,
+		InstanceID: spec.CloudInstance.ID,
+		InstanceIP: spec.CloudInstance.IP,
+		DurationMS: durationMS(time.Since(start)),
+		Error:      errString(err),
+	})
+	return err
+}
+
+func (e *eventEngine) Run(ctx context.Context, spec runtime.Spec, step runtime.Step, output io.Writer) (*runtime.State, error) {
+	e.events.emit(&execEvent{Type: eventStepStarted, Step: step.GetName()})
+
+	start := time.Now()
+	state, err := e.Engine.Run(ctx, spec, step, output)
+
+	event := &execEvent{
+		Type:       eventStepFinished,
+		Step:       step.GetName(),
+		DurationMS: durationMS(time.Since(start)),
+		Error:      errString(err),
+	}
+	if state != nil {
+		code := state.ExitCode
+		event.ExitCode = &code
+		event.OOMKilled = state.OOMKilled
+	}
+	e.events.emit(event)
+	return state, err
+}
+
+// eventStreamer emits the step logs as step output events, one per line.
+type eventStreamer struct {
+	events *eventWriter
+}
+
+func (s *eventStreamer) Stream(_ context.Context, _ *pipeline.State, name string) io.WriteCloser {
+	return &lineWriter{events: s.events, step: name}
+}
+
+type lineWriter struct {
+	events *eventWriter
+	step   string
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		w.emit(line[:i])
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	if w.buf.Len() > 0 {
+		w.emit(w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
+
+func (w *lineWriter) emit(line string) {
+	w.events.emit(&execEvent{Type: eventStepOutput, Step: w.step, Line: line})
+}
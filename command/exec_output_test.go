@@ -0,0 +1,116 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// decodeEvents returns the events of the JSON lines written to buf.
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []execEvent {
+	t.Helper()
+	var events []execEvent
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var e execEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("want a JSON event per line, got %q: %s", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestEventWriter(t *testing.T) {
+	var nop *eventWriter
+	nop.emit(&execEvent{Type: eventStepStarted})
+
+	buf := new(bytes.Buffer)
+	w := newEventWriter(buf)
+	code := 2
+	w.emit(&execEvent{Type: eventStepStarted, Step: "build"})
+	w.emit(&execEvent{Type: eventPipelineFinished, Status: drone.StatusFailing, ExitCode: &code})
+
+	events := decodeEvents(t, buf)
+	if len(events) != 2 {
+		t.Fatalf("want 2 events, got %d", len(events))
+	}
+	if events[0].Type != eventStepStarted || events[0].Step != "build" || events[0].Time.IsZero() {
+		t.Errorf("want a timed step started event, got %+v", events[0])
+	}
+	if events[1].ExitCode == nil || *events[1].ExitCode != 2 || events[1].Status != drone.StatusFailing {
+		t.Errorf("want the exit code and the status, got %+v", events[1])
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := &lineWriter{events: newEventWriter(buf), step: "build"}
+	for _, s := range []string{"go build", " ./...\ngo test\n", "\n", "done"} {
+		if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("want %d bytes written, got %d, %v", len(s), n, err)
+		}
+	}
+	if got := len(decodeEvents(t, bytes.NewBuffer(buf.Bytes()))); got != 3 {
+		t.Errorf("want the unterminated line held back until close, got %d events", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"go build ./...", "go test", "", "done"}
+	events := decodeEvents(t, buf)
+	if len(events) != len(want) {
+		t.Fatalf("want %d lines, got %d", len(want), len(events))
+	}
+	for i, e := range events {
+		if e.Type != eventStepOutput || e.Step != "build" || e.Line != want[i] {
+			t.Errorf("want output line %q of build, got %+v", want[i], e)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	stateOf := func(status string) *pipeline.State {
+		return &pipeline.State{Stage: &drone.Stage{Status: status}}
+	}
+	errSetup := errors.New("no instance")
+	errRun := errors.New("step not executed")
+	tests := []struct {
+		name  string
+		state *pipeline.State
+		eng   *eventEngine
+		err   error
+		code  int
+		want  error
+	}{
+		{name: "success", state: stateOf(drone.StatusPassing), code: exitCodeSuccess},
+		{name: "failed step", state: stateOf(drone.StatusFailing), code: exitCodeFailure},
+		{name: "killed", state: stateOf(drone.StatusKilled), code: exitCodeCanceled},
+		{name: "errored", state: stateOf(drone.StatusError), code: exitCodeInternal},
+		{name: "invalid config", err: configError(errRun), code: exitCodeConfig, want: errRun},
+		{name: "setup failed", eng: &eventEngine{setupErr: errSetup}, err: errRun, code: exitCodeProvision, want: errSetup},
+		{name: "internal", eng: &eventEngine{}, err: errRun, code: exitCodeInternal, want: errRun},
+		{name: "setup failed before any step", state: stateOf(drone.StatusError), eng: &eventEngine{setupErr: errSetup}, code: exitCodeProvision, want: errSetup},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := exitCode(test.state, test.eng, test.err)
+			if code != test.code {
+				t.Errorf("want exit code %d, got %d", test.code, code)
+			}
+			if !errors.Is(err, test.want) {
+				t.Errorf("want error %v, got %v", test.want, err)
+			}
+		})
+	}
+}
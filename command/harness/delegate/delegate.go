@@ -10,10 +10,12 @@ import (
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/httprender"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	errors "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/metric"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
 	loghistory "github.com/drone/runner-go/logger/history"
 	"github.com/drone/runner-go/server"
 	"github.com/drone/signal"
@@ -38,6 +40,7 @@ func (c *delegateCommand) delegateListener() http.Handler {
 	mux := chi.NewMux()
 
 	mux.Use(harness.Middleware)
+	mux.Use(tracing.Middleware)
 
 	mux.Post("/pool_owner", c.handlePoolOwner)
 	mux.Post("/setup", c.handleSetup)
@@ -56,7 +59,7 @@ func RegisterDelegate(app *kingpin.Application) {
 		Action(c.run)
 	cmd.Flag("envfile", "load the environment variable file").
 		StringVar(&c.envFile)
-	cmd.Flag("pool", "file to seed the pool").
+	cmd.Flag("pool", "file, directory or glob of pool files to seed the pool").
 		StringVar(&c.poolFile)
 }
 
@@ -98,7 +101,18 @@ func (c *delegateCommand) run(*kingpin.ParseContext) error {
 		cancel()
 	})
 
-	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.Database.Driver, c.env.Database.Datasource)
+	// export traces, if enabled.
+	shutdownTracing, err := tracing.Setup(ctx, &c.env)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background()) //nolint:errcheck
+
+	keys, err := encrypt.Load(c.env.Database.EncryptionKeys, c.env.Database.EncryptionKeyFile)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Unable to load the database encryption keys")
+	}
+	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.Database.Driver, c.env.Database.Datasource, keys)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
 	}
@@ -106,14 +120,20 @@ func (c *delegateCommand) run(*kingpin.ParseContext) error {
 	c.stageOwnerStore = stageOwnerStore
 	c.poolManager = drivers.New(ctx, instanceStore, &c.env)
 
+	// Initialize metrics
+	c.registerMetrics(instanceStore)
+	c.poolManager.AddMetrics(c.metrics)
+
 	_, err = harness.SetupPool(ctx, &c.env, c.poolManager, c.poolFile)
 	defer harness.Cleanup(&c.env, c.poolManager, true, true) //nolint: errcheck
 	if err != nil {
 		return err
 	}
 
-	// Initialize metrics
-	c.registerMetrics(instanceStore)
+	if err = harness.SetupPoolMapper(ctx, &c.env); err != nil {
+		logrus.WithError(err).Error("could not setup pool mapper")
+		return err
+	}
 
 	hook := loghistory.New()
 	logrus.AddHook(hook)
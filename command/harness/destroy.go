@@ -10,6 +10,7 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	ierrors "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/metric"
 	"github.com/drone-runners/drone-runner-aws/store"
@@ -19,6 +20,7 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -33,7 +35,11 @@ type VMCleanupRequest struct {
 	Context        Context `json:"context,omitempty"`
 }
 
-func HandleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerStore, env *config.EnvConfig, poolManager drivers.IManager, metrics *metric.Metrics) error {
+func HandleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerStore, env *config.EnvConfig, poolManager drivers.IManager, metrics *metric.Metrics) (err error) {
+	ctx, span := tracing.Start(tracing.WithStage(ctx, r.StageRuntimeID), "HandleDestroy",
+		tracing.KeyStage.String(r.StageRuntimeID), tracing.KeyTask.String(r.Context.TaskID))
+	defer func() { tracing.End(span, err) }()
+
 	if r.StageRuntimeID == "" {
 		return ierrors.NewBadRequestError("mandatory field 'stage_runtime_id' in the request body is empty")
 	}
@@ -88,7 +94,10 @@ func HandleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerS
 }
 
 func handleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerStore, env *config.EnvConfig,
-	poolManager drivers.IManager, metrics *metric.Metrics, retryCount int, logr *logrus.Entry) (*types.Instance, error) {
+	poolManager drivers.IManager, metrics *metric.Metrics, retryCount int, logr *logrus.Entry) (_ *types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "handleDestroy", attribute.Int("runner.retry", retryCount))
+	defer func() { tracing.End(span, err) }()
+
 	logr = logr.WithField("retry_count", retryCount)
 	entity, err := s.Find(ctx, r.StageRuntimeID)
 	if err != nil || entity == nil {
@@ -109,6 +118,7 @@ func handleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerS
 		return nil, fmt.Errorf("instance with stage runtime ID %s not found", r.StageRuntimeID)
 	}
 
+	span.SetAttributes(tracing.KeyPool.String(poolID), tracing.KeyInstance.String(inst.ID))
 	logr = logr.
 		WithField("instance_id", inst.ID).
 		WithField("instance_name", inst.Name)
@@ -119,7 +129,8 @@ func handleDestroy(ctx context.Context, r *VMCleanupRequest, s store.StageOwnerS
 		logr.WithError(err).Errorln("could not create lite engine client for invoking cleanup")
 	} else {
 		// Attempting to call lite engine destroy
-		resp, destroyErr := client.Destroy(context.Background(),
+		// not cancelled with the request, but still part of its trace.
+		resp, destroyErr := client.Destroy(context.WithoutCancel(ctx),
 			&api.DestroyRequest{LogDrone: false, LogKey: r.LogKey, LiteEnginePath: oshelp.GetLiteEngineLogsPath(inst.OS), StageRuntimeID: r.StageRuntimeID})
 		if destroyErr != nil {
 			// we can continue even if lite engine destroy does not happen successfully. This is because
@@ -7,8 +7,10 @@ import (
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/command/harness"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	"github.com/drone-runners/drone-runner-aws/metric"
 	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
 	"github.com/drone-runners/drone-runner-aws/types"
 	loghistory "github.com/drone/runner-go/logger/history"
 	"github.com/drone/runner-go/server"
@@ -43,7 +45,7 @@ func RegisterDlite(app *kingpin.Application) {
 		Action(c.run)
 	cmd.Flag("envfile", "load the environment variable file").
 		StringVar(&c.envFile)
-	cmd.Flag("pool", "file to seed the pool").
+	cmd.Flag("pool", "file, directory or glob of pool files to seed the pool").
 		StringVar(&c.poolFile)
 }
 
@@ -53,6 +55,9 @@ func parseTags(pf *config.PoolFile) []string {
 	for i := range pf.Instances {
 		tags = append(tags, pf.Instances[i].Name)
 	}
+	for i := range pf.VirtualPools {
+		tags = append(tags, pf.VirtualPools[i].Name)
+	}
 	return tags
 }
 
@@ -108,6 +113,13 @@ func (c *dliteCommand) run(*kingpin.ParseContext) error {
 		cancel()
 	})
 
+	// export traces, if enabled.
+	shutdownTracing, err := tracing.Setup(ctx, &c.env)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background()) //nolint:errcheck
+
 	// Initialize metrics
 	c.registerMetrics()
 
@@ -128,6 +140,11 @@ func (c *dliteCommand) run(*kingpin.ParseContext) error {
 		}
 	}
 
+	if err = harness.SetupPoolMapper(ctx, &c.env); err != nil {
+		logrus.WithError(err).Error("could not setup pool mapper")
+		return err
+	}
+
 	// Update running count from all the stores
 	c.metrics.UpdateRunningCount(ctx)
 
@@ -189,11 +206,16 @@ func (c *dliteCommand) run(*kingpin.ParseContext) error {
 }
 
 func (c *dliteCommand) setupPool(ctx context.Context) (*config.PoolFile, error) {
-	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.Database.Driver, c.env.Database.Datasource)
+	keys, err := encrypt.Load(c.env.Database.EncryptionKeys, c.env.Database.EncryptionKeyFile)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Unable to load the database encryption keys")
+	}
+	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.Database.Driver, c.env.Database.Datasource, keys)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
 	}
 	c.poolManager = drivers.NewManager(ctx, instanceStore, stageOwnerStore, &c.env)
+	c.poolManager.AddMetrics(c.metrics)
 	poolConfig, err := harness.SetupPool(ctx, &c.env, c.poolManager, c.poolFile)
 	if err != nil {
 		logrus.WithError(err).Error("could not setup pool")
@@ -209,12 +231,17 @@ func (c *dliteCommand) setupPool(ctx context.Context) (*config.PoolFile, error)
 
 func (c *dliteCommand) setupDistributedPool(ctx context.Context) (*config.PoolFile, error) {
 	logrus.Infoln("Starting postgres database")
-	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.DistributedMode.Driver, c.env.DistributedMode.Datasource)
+	keys, err := encrypt.Load(c.env.Database.EncryptionKeys, c.env.Database.EncryptionKeyFile)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Unable to load the database encryption keys")
+	}
+	instanceStore, stageOwnerStore, err := database.ProvideStore(c.env.DistributedMode.Driver, c.env.DistributedMode.Datasource, keys)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
 		return nil, err
 	}
 	c.distributedPoolManager = drivers.NewDistributedManager(drivers.NewManager(ctx, instanceStore, stageOwnerStore, &c.env))
+	c.distributedPoolManager.AddMetrics(c.metrics)
 	poolConfig, err := harness.SetupPool(ctx, &c.env, c.distributedPoolManager, c.poolFile)
 	if err != nil {
 		logrus.WithError(err).Error("could not setup distributed pool")
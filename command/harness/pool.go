@@ -28,6 +28,12 @@ func SetupPool(ctx context.Context, env *config.EnvConfig, poolManager drivers.I
 		return configPool, err
 	}
 
+	err = setupVirtualPools(configPool, poolManager)
+	if err != nil {
+		logrus.WithError(err).Errorln("unable to add virtual pools")
+		return configPool, err
+	}
+
 	err = poolManager.PingDriver(ctx)
 	if err != nil {
 		logrus.WithError(err).
@@ -42,6 +48,20 @@ func SetupPool(ctx context.Context, env *config.EnvConfig, poolManager drivers.I
 		return configPool, err
 	}
 
+	err = poolManager.AddCertificateAuthority(env)
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("unable to set up the certificate authority")
+		return configPool, err
+	}
+
+	err = poolManager.AddChecksums(env)
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("unable to load the binary checksums")
+		return configPool, err
+	}
+
 	// setup lifetimes of instances
 	busyMaxAge := time.Hour * time.Duration(env.Settings.BusyMaxAge) // includes time required to setup an instance
 	freeMaxAge := time.Hour * time.Duration(env.Settings.FreeMaxAge)
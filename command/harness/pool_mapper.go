@@ -1,13 +1,134 @@
 package harness
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/poolmapper"
 	"github.com/sirupsen/logrus"
 )
 
+var poolMapper *poolmapper.Mapper
+
+// SetupPoolMapper loads the pool mapping rules if a rules file is configured
+// and keeps reloading them in the background whenever the file changes.
+func SetupPoolMapper(ctx context.Context, env *config.EnvConfig) error {
+	if env.Dlite.PoolMapperFile == "" {
+		return nil
+	}
+	m, err := poolmapper.New(env.Dlite.PoolMapperFile)
+	if err != nil {
+		return err
+	}
+	poolMapper = m
+
+	interval := time.Duration(env.Dlite.PoolMapperReloadSecs) * time.Second
+	if interval > 0 {
+		go m.Watch(ctx, interval)
+	}
+	logrus.WithField("path", env.Dlite.PoolMapperFile).Infoln("loaded pool mapping rules")
+	return nil
+}
+
+// fetchPool returns the pool a setup request for inputPool should use. Rules from the
+// pool mapper file take precedence, then the per account mapping from the env config.
+// If neither matches, the input pool is returned.
+func fetchPool(r *SetupVMRequest, inputPool string, env *config.EnvConfig, poolManager drivers.IManager) string {
+	in := &poolmapper.Input{
+		Pool:          inputPool,
+		AccountID:     GetAccountID(&r.Context, r.Tags),
+		OrgID:         getOrgID(&r.Context, r.Tags),
+		ProjectID:     getProjectID(&r.Context, r.Tags),
+		PipelineID:    getPipelineID(&r.Context, r.Tags),
+		ResourceClass: r.ResourceClass,
+		Tags:          r.Tags,
+	}
+	exists := func(pool string) bool {
+		_, virtual := poolManager.VirtualPool(pool)
+		return virtual || poolManager.Exists(pool)
+	}
+	pool, rule, ok := poolMapper.Map(in, exists)
+	if ok {
+		logrus.WithField("old_pool", inputPool).
+			WithField("updated_pool", pool).
+			WithField("rule", rule).
+			Info("Updated the pool")
+	} else {
+		pool = fetchPoolByAccount(r.SetupRequest.LogConfig.AccountID, inputPool, env.Dlite.PoolMapByAccount)
+	}
+	return resolveVirtualPool(pool, poolManager)
+}
+
+// setupVirtualPools validates the virtual pools of the pool file and registers them
+// with the pool manager. Each virtual pool must only reference pools known to the
+// pool manager, not other virtual pools, so that they cannot form a cycle.
+func setupVirtualPools(pf *config.PoolFile, poolManager drivers.IManager) error {
+	names := make(map[string]bool, len(pf.VirtualPools))
+	for _, vp := range pf.VirtualPools {
+		names[vp.Name] = true
+	}
+	m := make(map[string][]drivers.WeightedPool, len(pf.VirtualPools))
+	for _, vp := range pf.VirtualPools {
+		if vp.Name == "" {
+			return fmt.Errorf("virtual pool: name is empty")
+		}
+		if _, ok := m[vp.Name]; ok || poolManager.Exists(vp.Name) {
+			return fmt.Errorf("virtual pool %q: name is already in use", vp.Name)
+		}
+		if len(vp.Pools) == 0 {
+			return fmt.Errorf("virtual pool %q: no pools defined", vp.Name)
+		}
+		total := 0
+		targets := make([]drivers.WeightedPool, 0, len(vp.Pools))
+		for _, p := range vp.Pools {
+			if names[p.Pool] {
+				return fmt.Errorf("virtual pool %q: pool %q is a virtual pool", vp.Name, p.Pool)
+			}
+			if !poolManager.Exists(p.Pool) {
+				return fmt.Errorf("virtual pool %q: pool %q not found", vp.Name, p.Pool)
+			}
+			if p.Weight < 0 {
+				return fmt.Errorf("virtual pool %q: pool %q has a negative weight", vp.Name, p.Pool)
+			}
+			total += p.Weight
+			targets = append(targets, drivers.WeightedPool{Pool: p.Pool, Weight: p.Weight})
+		}
+		if total == 0 {
+			return fmt.Errorf("virtual pool %q: sum of the weights is zero", vp.Name)
+		}
+		m[vp.Name] = targets
+	}
+	poolManager.AddVirtualPools(m)
+	return nil
+}
+
+// resolveVirtualPool returns one of the real pools of a virtual pool picked by weight.
+// Pools which are not virtual are returned as they are.
+func resolveVirtualPool(pool string, poolManager drivers.IManager) string {
+	pools, ok := poolManager.VirtualPool(pool)
+	if !ok {
+		return pool
+	}
+	targets := make([]poolmapper.Target, 0, len(pools))
+	for _, p := range pools {
+		targets = append(targets, poolmapper.Target{Pool: p.Pool, Weight: p.Weight})
+	}
+	v, ok := poolmapper.Pick(targets, true, poolManager.Exists)
+	if !ok {
+		return pool
+	}
+	logrus.WithField("virtual_pool", pool).
+		WithField("pool", v).
+		Traceln("resolved virtual pool")
+	return v
+}
+
 // if pool mapping is defined in env config, it figures out the mapped pool name & returns it
 // else returns the input pool
-func fetchPool(accountID, inputPool string, p config.PoolMapperByAccount) string {
+func fetchPoolByAccount(accountID, inputPool string, p config.PoolMapperByAccount) string {
 	if accountID == "" {
 		return inputPool
 	}
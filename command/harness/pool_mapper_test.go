@@ -0,0 +1,143 @@
+package harness
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+)
+
+// newPoolManager returns a pool manager with pools of the names, without
+// drivers.
+func newPoolManager(t *testing.T, names ...string) *drivers.Manager {
+	t.Helper()
+	m := drivers.NewManager(context.Background(), nil, nil, &config.EnvConfig{})
+	for _, name := range names {
+		if err := m.Add(drivers.Pool{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestSetupVirtualPools(t *testing.T) {
+	pool := func(name string, weight int) config.WeightedPool {
+		return config.WeightedPool{Pool: name, Weight: weight}
+	}
+	tests := []struct {
+		name  string
+		pools []config.VirtualPool
+		err   string
+	}{
+		{
+			name:  "valid",
+			pools: []config.VirtualPool{{Name: "ubuntu", Pools: []config.WeightedPool{pool("aws", 95), pool("gcp", 5)}}},
+		},
+		{
+			name:  "empty name",
+			pools: []config.VirtualPool{{Pools: []config.WeightedPool{pool("aws", 1)}}},
+			err:   "name is empty",
+		},
+		{
+			name:  "name of a pool",
+			pools: []config.VirtualPool{{Name: "aws", Pools: []config.WeightedPool{pool("gcp", 1)}}},
+			err:   `virtual pool "aws": name is already in use`,
+		},
+		{
+			name: "name of another virtual pool",
+			pools: []config.VirtualPool{
+				{Name: "ubuntu", Pools: []config.WeightedPool{pool("aws", 1)}},
+				{Name: "ubuntu", Pools: []config.WeightedPool{pool("gcp", 1)}},
+			},
+			err: `virtual pool "ubuntu": name is already in use`,
+		},
+		{
+			name:  "no pools",
+			pools: []config.VirtualPool{{Name: "ubuntu"}},
+			err:   "no pools defined",
+		},
+		{
+			name:  "unknown pool",
+			pools: []config.VirtualPool{{Name: "ubuntu", Pools: []config.WeightedPool{pool("azure", 1)}}},
+			err:   `pool "azure" not found`,
+		},
+		{
+			name:  "itself",
+			pools: []config.VirtualPool{{Name: "ubuntu", Pools: []config.WeightedPool{pool("ubuntu", 1)}}},
+			err:   `pool "ubuntu" is a virtual pool`,
+		},
+		{
+			name: "cycle",
+			pools: []config.VirtualPool{
+				{Name: "ubuntu", Pools: []config.WeightedPool{pool("linux", 1)}},
+				{Name: "linux", Pools: []config.WeightedPool{pool("ubuntu", 1)}},
+			},
+			err: `pool "linux" is a virtual pool`,
+		},
+		{
+			name:  "negative weight",
+			pools: []config.VirtualPool{{Name: "ubuntu", Pools: []config.WeightedPool{pool("aws", -1), pool("gcp", 2)}}},
+			err:   "negative weight",
+		},
+		{
+			name:  "zero weights",
+			pools: []config.VirtualPool{{Name: "ubuntu", Pools: []config.WeightedPool{pool("aws", 0)}}},
+			err:   "sum of the weights is zero",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newPoolManager(t, "aws", "gcp")
+			err := setupVirtualPools(&config.PoolFile{VirtualPools: test.pools}, m)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := m.VirtualPool("ubuntu"); !ok {
+					t.Errorf("want the virtual pool registered")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("want error %q, got %v", test.err, err)
+			}
+			if _, ok := m.VirtualPool(test.pools[0].Name); ok {
+				t.Errorf("want no virtual pool registered after an error")
+			}
+		})
+	}
+}
+
+func TestResolveVirtualPool(t *testing.T) {
+	m := newPoolManager(t, "aws", "gcp", "azure")
+	err := setupVirtualPools(&config.PoolFile{VirtualPools: []config.VirtualPool{
+		{Name: "ubuntu", Pools: []config.WeightedPool{{Pool: "aws", Weight: 3}, {Pool: "gcp", Weight: 1}, {Pool: "azure", Weight: 0}}},
+	}}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pool string
+		want map[string]bool
+	}{
+		{pool: "ubuntu", want: map[string]bool{"aws": true, "gcp": true}},
+		{pool: "aws", want: map[string]bool{"aws": true}},
+		{pool: "unknown", want: map[string]bool{"unknown": true}},
+	}
+	for _, test := range tests {
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			got := resolveVirtualPool(test.pool, m)
+			if !test.want[got] {
+				t.Fatalf("want %s to resolve to one of %v, got %s", test.pool, test.want, got)
+			}
+			counts[got]++
+		}
+		if test.pool == "ubuntu" && (counts["aws"] < 600 || counts["aws"] > 900) {
+			t.Errorf("want about three quarters of ubuntu resolved to aws, got %d in 1000", counts["aws"])
+		}
+	}
+}
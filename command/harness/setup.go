@@ -16,6 +16,8 @@ import (
 	"github.com/drone-runners/drone-runner-aws/engine/resource"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/redact"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	errors "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/types"
@@ -24,6 +26,7 @@ import (
 	"github.com/harness/lite-engine/logger"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type SetupVMRequest struct {
@@ -45,6 +48,10 @@ type SetupVMResponse struct {
 
 var (
 	healthCheckTimeout = 5 * time.Minute
+	// transientRetries is the number of extra attempts made on the same pool
+	// when provisioning fails with a transient error.
+	transientRetries   = 1
+	transientRetryWait = 5 * time.Second
 	freeAccount        = "free"
 	noContext          = context.Background()
 	freeCI             = "freeCI"
@@ -53,7 +60,11 @@ var (
 // HandleSetup tries to setup an instance in any of the pools given in the setup request.
 // It calls handleSetup internally for each pool instance trying to complete a setup.
 func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore, env *config.EnvConfig, poolManager drivers.IManager,
-	metrics *metric.Metrics) (*SetupVMResponse, string, error) {
+	metrics *metric.Metrics) (_ *SetupVMResponse, _ string, err error) {
+	ctx, span := tracing.Start(tracing.WithStage(ctx, r.ID), "HandleSetup",
+		tracing.KeyStage.String(r.ID), tracing.KeyPool.String(r.PoolID), tracing.KeyTask.String(r.CorrelationID))
+	defer func() { tracing.End(span, err) }()
+
 	stageRuntimeID := r.ID
 	if stageRuntimeID == "" {
 		return nil, "", errors.NewBadRequestError("mandatory field 'id' in the request body is empty")
@@ -103,12 +114,16 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 	}
 
 	logr = AddContext(logr, &r.Context, r.Tags)
+	logr.WithField("request", redact.ForSetupRequest(&r.SetupRequest).Value(r)).Traceln("received setup request")
 
 	pools := []string{}
 	pools = append(pools, r.PoolID)
 	pools = append(pools, r.FallbackPoolIDs...)
 
-	var selectedPool, selectedPoolDriver string
+	// firstPool is the concrete pool the requested pool resolved to. It is used
+	// as the pool label of the metrics, so that the real pools behind a virtual
+	// pool can be compared.
+	var firstPool, selectedPool, selectedPoolDriver string
 	var poolErr error
 	var instance *types.Instance
 	foundPool := false
@@ -125,16 +140,44 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 	}
 
 	// try to provision an instance with fallbacks
+pools:
 	for idx, p := range pools {
 		if idx > 0 {
 			fallback = true
 		}
-		pool := fetchPool(r.SetupRequest.LogConfig.AccountID, p, env.Dlite.PoolMapByAccount)
-		logr.WithField("pool_id", pool).Traceln("starting the setup process")
-		instance, poolErr = handleSetup(ctx, logr, r, env, poolManager, pool, owner)
-		if poolErr != nil {
-			logr.WithField("pool_id", pool).WithError(poolErr).Errorln("could not setup instance")
-			continue
+		pool := fetchPool(r, p, env, poolManager)
+		if idx == 0 {
+			firstPool = pool
+		}
+		for attempt := 0; ; attempt++ {
+			logr.WithField("pool_id", pool).WithField("attempt", attempt).Traceln("starting the setup process")
+			instance, poolErr = handleSetup(ctx, logr, r, env, poolManager, metrics, pool, owner)
+			if poolErr == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				// the request is canceled, every other pool would fail the same way
+				poolErr = ctx.Err()
+				break pools
+			}
+			class := errors.ClassOf(poolErr)
+			logr.WithField("pool_id", pool).
+				WithField("error_class", class).
+				WithError(poolErr).Errorln("could not setup instance")
+			switch setupActionFor(class) {
+			case setupRetry:
+				if attempt >= transientRetries {
+					continue pools
+				}
+				if !sleepContext(ctx, transientRetryWait) {
+					poolErr = ctx.Err()
+					break pools
+				}
+			case setupFailFast:
+				break pools
+			default:
+				continue pools
+			}
 		}
 		selectedPool = pool
 		foundPool = true
@@ -143,7 +186,7 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 	}
 
 	setupTime := time.Since(st) // amount of time it took to provision an instance
-	platform, _, driver := poolManager.Inspect(r.PoolID)
+	platform, _, driver := poolManager.Inspect(firstPool)
 
 	// If a successful fallback happened and we have an instance setup, record it
 	if foundPool && instance != nil { // check for instance != nil just in case
@@ -161,20 +204,22 @@ func HandleSetup(ctx context.Context, r *SetupVMRequest, s store.StageOwnerStore
 			// fallback metric records the first pool ID which was tried and the associated driver.
 			// We don't record final pool which was used as this metric is only used to get data about
 			// which drivers and pools are causing fallbacks.
-			metrics.PoolFallbackCount.WithLabelValues(r.PoolID, instance.OS, instance.Arch, driver, metric.True, strconv.FormatBool(poolManager.IsDistributed()), owner).Inc()
+			metrics.PoolFallbackCount.WithLabelValues(firstPool, instance.OS, instance.Arch, driver, metric.True, strconv.FormatBool(poolManager.IsDistributed()), owner).Inc()
 		}
-		metrics.WaitDurationCount.WithLabelValues(r.PoolID, instance.OS, instance.Arch,
+		metrics.WaitDurationCount.WithLabelValues(firstPool, instance.OS, instance.Arch,
 			driver, metric.ConvertBool(fallback), strconv.FormatBool(poolManager.IsDistributed()), owner).Observe(setupTime.Seconds())
 	} else {
-		metrics.FailedCount.WithLabelValues(r.PoolID, platform.OS, platform.Arch, driver, strconv.FormatBool(poolManager.IsDistributed()), owner).Inc()
-		metrics.BuildCount.WithLabelValues(r.PoolID, platform.OS, platform.Arch, driver, strconv.FormatBool(poolManager.IsDistributed()), "", owner).Inc()
+		metrics.FailedCount.WithLabelValues(firstPool, platform.OS, platform.Arch, driver, strconv.FormatBool(poolManager.IsDistributed()), owner,
+			string(errors.ClassOf(poolErr))).Inc()
+		metrics.BuildCount.WithLabelValues(firstPool, platform.OS, platform.Arch, driver, strconv.FormatBool(poolManager.IsDistributed()), "", owner).Inc()
 		if fallback {
-			metrics.PoolFallbackCount.WithLabelValues(r.PoolID, platform.OS, platform.Arch, driver, metric.False, strconv.FormatBool(poolManager.IsDistributed()), owner).Inc()
+			metrics.PoolFallbackCount.WithLabelValues(firstPool, platform.OS, platform.Arch, driver, metric.False, strconv.FormatBool(poolManager.IsDistributed()), owner).Inc()
 		}
 		return nil, "", fmt.Errorf("could not provision a VM from the pool: %w", poolErr)
 	}
 
 	metrics.BuildCount.WithLabelValues(selectedPool, instance.OS, instance.Arch, string(instance.Provider), strconv.FormatBool(poolManager.IsDistributed()), instance.Zone, owner).Inc()
+	span.SetAttributes(attribute.String("runner.pool.selected", selectedPool), tracing.KeyInstance.String(instance.ID))
 	resp := &SetupVMResponse{InstanceID: instance.ID, IPAddress: instance.Address}
 
 	logr.WithField("selected_pool", selectedPool).
@@ -198,10 +243,14 @@ func handleSetup(
 	r *SetupVMRequest,
 	env *config.EnvConfig,
 	poolManager drivers.IManager,
-	pool, owner string) (*types.Instance, error) {
+	metrics *metric.Metrics,
+	pool, owner string) (_ *types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "handleSetup", tracing.KeyPool.String(pool))
+	defer func() { tracing.End(span, err) }()
+
 	// check if the pool exists in the pool manager.
 	if !poolManager.Exists(pool) {
-		return nil, fmt.Errorf("could not find pool: %s", pool)
+		return nil, errors.NewProvisionError(errors.ErrorClassConfig, fmt.Errorf("could not find pool: %s", pool))
 	}
 
 	stageRuntimeID := r.ID
@@ -224,6 +273,7 @@ func handleSetup(
 		WithField("instance_name", instance.Name)
 
 	logr.Traceln("successfully provisioned VM in pool")
+	span.SetAttributes(tracing.KeyInstance.String(instance.ID))
 
 	instanceID := instance.ID
 	instanceName := instance.Name
@@ -246,9 +296,8 @@ func handleSetup(
 					Infof("serial console output: %s", out[len(out)-int(l):])
 			}
 		}
-		err = poolManager.Destroy(context.Background(), pool, instanceID)
-		if err != nil {
-			logr.WithError(err).Errorln("failed to cleanup instance on setup failure")
+		if derr := poolManager.Destroy(context.Background(), pool, instanceID); derr != nil {
+			logr.WithError(derr).Errorln("failed to cleanup instance on setup failure")
 		}
 	}
 
@@ -260,6 +309,13 @@ func handleSetup(
 		}
 	}
 
+	// the lite engine of an instance without an IP address is unreachable,
+	// there is no point in waiting for its health check.
+	if instance.Address == "" {
+		go cleanUpInstanceFn(true)
+		return nil, errors.NewProvisionError(errors.ErrorClassHealthCheck, fmt.Errorf("instance %s has no IP address", instance.ID))
+	}
+
 	instance.Stage = stageRuntimeID
 	instance.Updated = time.Now().Unix()
 	err = poolManager.Update(ctx, instance)
@@ -278,17 +334,20 @@ func handleSetup(
 		env.LiteEngine.EnableMock, env.LiteEngine.MockStepTimeoutSecs)
 	if err != nil {
 		go cleanUpInstanceFn(false)
-		return nil, fmt.Errorf("failed to create LE client: %w", err)
+		return nil, errors.NewProvisionError(errors.ErrorClassCertificate, fmt.Errorf("failed to create LE client: %w", err))
 	}
 
 	// try the healthcheck api on the lite-engine until it responds ok
 	logr.Traceln("running healthcheck and waiting for an ok response")
 	performDNSLookup := drivers.ShouldPerformDNSLookup(ctx, instance.Platform.OS)
 
+	healthStart := time.Now()
 	if _, err = client.RetryHealth(ctx, healthCheckTimeout, performDNSLookup); err != nil {
 		go cleanUpInstanceFn(true)
-		return nil, fmt.Errorf("failed to call lite-engine retry health: %w", err)
+		return nil, errors.NewProvisionError(errors.ErrorClassHealthCheck, fmt.Errorf("failed to call lite-engine retry health: %w", err))
 	}
+	_, _, driver := poolManager.Inspect(pool)
+	metrics.ObserveInstance(metric.PhaseHealthy, pool, driver, instance.Zone, time.Since(healthStart))
 
 	logr.Traceln("retry health check complete")
 
@@ -306,3 +365,38 @@ func handleSetup(
 
 	return instance, nil
 }
+
+type setupAction int
+
+const (
+	setupFallback setupAction = iota
+	setupRetry
+	setupFailFast
+)
+
+// setupActionFor decides what HandleSetup does after a pool failed with an error
+// of the given class. Errors that would fail identically on every pool fail the
+// setup straight away, transient errors are retried on the same pool first and
+// everything else falls back to the next pool.
+func setupActionFor(class errors.ErrorClass) setupAction {
+	switch class {
+	case errors.ErrorClassBadRequest, errors.ErrorClassCertificate:
+		return setupFailFast
+	case errors.ErrorClassTransient:
+		return setupRetry
+	default:
+		return setupFallback
+	}
+}
+
+// sleepContext waits for d and reports whether the context is still alive.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
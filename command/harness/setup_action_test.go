@@ -0,0 +1,30 @@
+package harness
+
+import (
+	"testing"
+
+	errors "github.com/drone-runners/drone-runner-aws/internal/types"
+)
+
+func TestSetupActionFor(t *testing.T) {
+	tests := []struct {
+		class  errors.ErrorClass
+		action setupAction
+	}{
+		{class: errors.ErrorClassBadRequest, action: setupFailFast},
+		{class: errors.ErrorClassCertificate, action: setupFailFast},
+		{class: errors.ErrorClassTransient, action: setupRetry},
+		{class: errors.ErrorClassCapacity, action: setupFallback},
+		{class: errors.ErrorClassQuota, action: setupFallback},
+		{class: errors.ErrorClassAuth, action: setupFallback},
+		{class: errors.ErrorClassHealthCheck, action: setupFallback},
+		{class: errors.ErrorClassConfig, action: setupFallback},
+		{class: errors.ErrorClassUnknown, action: setupFallback},
+	}
+
+	for _, test := range tests {
+		if got, want := setupActionFor(test.class), test.action; got != want {
+			t.Errorf("Want action %d for class %s, got %d", want, test.class, got)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/noop"
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/store/database/ldb"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// newCloud returns an in-memory cloud which creates instances instantly.
+func newCloud(t *testing.T) drivers.Driver {
+	t.Helper()
+	driver, err := noop.New(noop.WithRootDirectory(), noop.WithoutWaits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+// eventually waits for the condition, which may depend on the instances
+// cleaned up in the background.
+func eventually(t *testing.T, msg string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out: %s", msg)
+		}
+	}
+}
+
+func TestHandleSetup_Chaos(t *testing.T) {
+	// the transient failures fall back straight away, rather than being
+	// retried on the primary pool, which may have been replenished meanwhile
+	defer func(retries int) { transientRetries = retries }(transientRetries)
+	transientRetries = 0
+
+	tests := []struct {
+		name       string
+		faults     map[string]drivers.Faults
+		middleware []drivers.Middleware
+		hibernated bool
+		canceled   bool
+	}{
+		{
+			name:   "failed creates",
+			faults: map[string]drivers.Faults{"Create": {FailureRate: 1}},
+		},
+		{
+			name:   "instances without an address",
+			faults: map[string]drivers.Faults{"Create": {NoAddressRate: 1}},
+		},
+		{
+			name:       "hung creates",
+			faults:     map[string]drivers.Faults{"Create": {HangRate: 1}},
+			middleware: []drivers.Middleware{drivers.Timeouts(map[string]time.Duration{"Create": 50 * time.Millisecond})},
+		},
+		{
+			name:       "failed starts of hibernated instances",
+			faults:     map[string]drivers.Faults{"Start": {FailureRate: 1}},
+			hibernated: true,
+		},
+		{
+			name:       "started instances without an address",
+			faults:     map[string]drivers.Faults{"Start": {NoAddressRate: 1}},
+			hibernated: true,
+		},
+		{
+			name:     "creates hung until the request is canceled",
+			faults:   map[string]drivers.Faults{"Create": {HangRate: 1}},
+			canceled: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := leveldb.Open(storage.NewMemStorage(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			env := &config.EnvConfig{}
+			env.Runner.Name = "runner"
+			env.LiteEngine.EnableMock = true
+			stageOwnerStore := ldb.NewStageOwnerStore(db)
+			m := drivers.NewManager(ctx, ldb.NewInstanceStore(db), stageOwnerStore, env)
+
+			platform := types.Platform{OS: "linux", Arch: "amd64"}
+			primary := drivers.NewChaosDriver(newCloud(t), test.faults, 1)
+			fallback := drivers.NewChaosDriver(newCloud(t), nil, 1)
+			err = m.Add(
+				drivers.Pool{Name: "primary", MaxSize: 10, Platform: platform, Driver: primary, Middleware: test.middleware},
+				drivers.Pool{Name: "fallback", MaxSize: 10, Platform: platform, Driver: fallback},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.hibernated {
+				inst, err := primary.Create(ctx, &types.InstanceCreateOpts{PoolName: "primary", Platform: platform})
+				if err != nil {
+					t.Fatal(err)
+				}
+				inst.IsHibernated = true
+				if err := m.GetInstanceStore().Create(ctx, inst); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			metrics := &metric.Metrics{
+				BuildCount:        metric.BuildCount(),
+				FailedCount:       metric.FailedBuildCount(),
+				PoolFallbackCount: metric.PoolFallbackCount(),
+				WaitDurationCount: metric.WaitDurationCount(),
+			}
+			r := &SetupVMRequest{ID: "stage", PoolID: "primary", FallbackPoolIDs: []string{"fallback"}}
+			setupCtx := ctx
+			if test.canceled {
+				var cancel context.CancelFunc
+				setupCtx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+				defer cancel()
+			}
+			resp, _, err := HandleSetup(setupCtx, r, stageOwnerStore, env, m, metrics)
+			if test.canceled {
+				// the fallback pool is not tried with the canceled context
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("want the error of the context, got %v", err)
+				}
+				if got := fallback.Instances(); len(got) != 0 {
+					t.Errorf("want no instance of the fallback pool, got %v", got)
+				}
+				if got := testutil.CollectAndCount(metrics.PoolFallbackCount); got != 0 {
+					t.Errorf("want no fallback counted, got %d series", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inst, err := m.Find(ctx, resp.InstanceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inst.Pool != "fallback" || inst.State != types.StateInUse {
+				t.Errorf("want an instance in use of the fallback pool, got %s of %s", inst.State, inst.Pool)
+			}
+			if got := testutil.ToFloat64(metrics.PoolFallbackCount); got != 1 {
+				t.Errorf("want a fallback counted, got %v", got)
+			}
+
+			// the failed instance of the primary pool is destroyed in the background
+			eventually(t, "instances of the primary pool left in use", func() bool {
+				busy, _ := m.GetInstanceStore().List(ctx, "primary", &types.QueryParams{Status: types.StateInUse})
+				return len(busy) == 0 && len(primary.Leaked(ctx, m.GetInstanceStore())) == 0
+			})
+			if ids := fallback.Leaked(ctx, m.GetInstanceStore()); len(ids) != 0 {
+				t.Errorf("want no leaked instances, got %v", ids)
+			}
+
+			primary.Heal()
+			eventually(t, "instances left after cleaning the pools", func() bool {
+				_ = m.CleanPools(ctx, true, true)
+				list, _ := m.GetInstanceStore().List(ctx, "", nil)
+				return len(list) == 0 && len(primary.Instances()) == 0 && len(fallback.Instances()) == 0
+			})
+		})
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/internal/redact"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	ierrors "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/metric"
 	"github.com/drone-runners/drone-runner-aws/store"
@@ -22,6 +24,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ExecuteVMRequest struct {
@@ -45,7 +48,12 @@ func HandleStep(ctx context.Context,
 	env *config.EnvConfig,
 	poolManager drivers.IManager,
 	metrics *metric.Metrics,
-	async bool) (*api.PollStepResponse, error) {
+	async bool) (_ *api.PollStepResponse, err error) {
+	ctx, span := tracing.Start(tracing.WithStage(ctx, r.StageRuntimeID), "HandleStep",
+		tracing.KeyStage.String(r.StageRuntimeID), tracing.KeyStep.String(r.StartStepRequest.ID), tracing.KeyTask.String(r.CorrelationID),
+		attribute.Bool("runner.step.async", async))
+	defer func() { tracing.End(span, err) }()
+
 	if r.ID == "" && r.IPAddress == "" {
 		return nil, ierrors.NewBadRequestError("either parameter 'id' or 'ip_address' must be provided")
 	}
@@ -92,6 +100,7 @@ func HandleStep(ctx context.Context,
 	}
 
 	logr = logr.WithField("ip", inst.Address)
+	span.SetAttributes(tracing.KeyPool.String(poolID), tracing.KeyInstance.String(inst.ID))
 
 	client, err := lehelper.GetClient(inst, poolManager.GetTLSServerName(), inst.Port, env.LiteEngine.EnableMock, env.LiteEngine.MockStepTimeoutSecs)
 	if err != nil {
@@ -127,12 +136,15 @@ func HandleStep(ctx context.Context,
 			}
 		}
 	}
+	redactor := redact.ForStartStepRequest(&r.StartStepRequest)
+	logr.WithField("request", redactor.Value(&r.StartStepRequest)).Traceln("calling LE.RetryStartStep")
+
 	startStepResponse, err := client.RetryStartStep(ctx, &r.StartStepRequest)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call LE.RetryStartStep: %w", err)
 	}
 
-	logr.WithField("startStepResponse", startStepResponse).Traceln("LE.StartStep complete")
+	logr.WithField("startStepResponse", redactor.Value(startStepResponse)).Traceln("LE.StartStep complete")
 
 	pollResponse := &api.PollStepResponse{}
 
@@ -143,7 +155,7 @@ func HandleStep(ctx context.Context,
 		}
 	}
 
-	logr.WithField("pollResponse", pollResponse).Traceln("completed LE.RetryPollStep")
+	logr.WithField("pollResponse", redactor.Value(pollResponse)).Traceln("completed LE.RetryPollStep")
 	if len(pollResponse.Envs) > 0 {
 		envState().Add(r.StageRuntimeID, pollResponse.Envs)
 	}
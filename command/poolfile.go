@@ -0,0 +1,117 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type poolfileCommand struct {
+	Path  string
+	Write bool
+}
+
+func (c *poolfileCommand) validate(*kingpin.ParseContext) error {
+	err := poolfile.ValidateFile(c.Path)
+	var verrs poolfile.ValidationErrors
+	switch {
+	case errors.As(err, &verrs):
+		for _, verr := range verrs {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", verr.File, verr.Line, verr.Column, verr.Message)
+		}
+		return fmt.Errorf("%s: found %d error(s)", c.Path, len(verrs))
+	case err != nil:
+		return err
+	}
+	fmt.Printf("%s: ok\n", c.Path)
+	return nil
+}
+
+func (c *poolfileCommand) render(*kingpin.ParseContext) error {
+	files, err := poolfile.Files(c.Path)
+	if err != nil {
+		return err
+	}
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		out, err := config.Expand(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Printf("# %s\n%s", file, out)
+	}
+	return nil
+}
+
+func (c *poolfileCommand) migrate(*kingpin.ParseContext) error {
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+	if version := config.VersionOf(data); version == config.LatestVersion {
+		fmt.Fprintf(os.Stderr, "%s: already at version %s\n", c.Path, version)
+	}
+	out, err := config.Migrate(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Path, err)
+	}
+	if !c.Write {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.Path, out, info.Mode())
+}
+
+func (c *poolfileCommand) schema(*kingpin.ParseContext) error {
+	dump(os.Stdout, poolfile.Schema())
+	return nil
+}
+
+func registerPoolfile(app *kingpin.Application) {
+	c := new(poolfileCommand)
+
+	cmd := app.Command("poolfile", "pool file utilities")
+
+	validate := cmd.Command("validate", "validate a pool file").
+		Action(c.validate)
+	validate.Arg("pool", "pool file, directory or glob").
+		Default("pool.yml").
+		StringVar(&c.Path)
+
+	render := cmd.Command("render", "print a pool file with defaults and extends expanded, and references such as ${VAR} or ${file:/path} left unresolved").
+		Action(c.render)
+	render.Arg("pool", "pool file, directory or glob").
+		Default("pool.yml").
+		StringVar(&c.Path)
+
+	migrate := cmd.Command("migrate", "upgrade a pool file to the latest version").
+		Action(c.migrate)
+	migrate.Arg("pool", "pool file location").
+		Default("pool.yml").
+		StringVar(&c.Path)
+	migrate.Flag("write", "rewrite the file instead of printing the result").
+		Short('w').
+		BoolVar(&c.Write)
+
+	cmd.Command("schema", "print the JSON Schema of the pool file").
+		Action(c.schema)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
 	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/signal"
@@ -134,8 +135,12 @@ func (c *setupCommand) run(*kingpin.ParseContext) error { //nolint
 		),
 	)
 
+	keys, err := encrypt.Load(env.Database.EncryptionKeys, env.Database.EncryptionKeyFile)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Unable to load the database encryption keys")
+	}
 	// use a single instance db, as we only need one machine
-	store, _, err := database.ProvideStore(database.SingleInstance, "")
+	store, _, err := database.ProvideStore(database.SingleInstance, "", keys)
 	if err != nil {
 		logrus.WithError(err).Fatalln("Unable to start the database")
 	}
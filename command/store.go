@@ -0,0 +1,73 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/store/database"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type storeCommand struct {
+	envFile     string
+	distributed bool
+}
+
+// rotateKey encrypts the key material of all instances with the primary
+// encryption key. It is run after a new primary key was added, before the
+// previous keys are removed.
+func (c *storeCommand) rotateKey(*kingpin.ParseContext) error {
+	err := godotenv.Load(c.envFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	env, err := config.FromEnviron()
+	if err != nil {
+		return err
+	}
+	keys, err := encrypt.Load(env.Database.EncryptionKeys, env.Database.EncryptionKeyFile)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return errors.New("store: no encryption keys configured, set DRONE_DATABASE_ENCRYPTION_KEYS or DRONE_DATABASE_ENCRYPTION_KEY_FILE")
+	}
+
+	driver, datasource := env.Database.Driver, env.Database.Datasource
+	if c.distributed {
+		driver, datasource = env.DistributedMode.Driver, env.DistributedMode.Datasource
+	}
+	instanceStore, _, err := database.ProvideStore(driver, datasource, nil)
+	if err != nil {
+		return err
+	}
+	updated, err := encrypt.Migrate(nocontext, instanceStore, keys, true)
+	if err != nil {
+		return fmt.Errorf("store: encrypted %d instance(s) before failing: %w", updated, err)
+	}
+	fmt.Printf("encrypted %d instance(s) with key %s\n", updated, keys.Primary())
+	return nil
+}
+
+func registerStore(app *kingpin.Application) {
+	c := new(storeCommand)
+
+	cmd := app.Command("store", "instance store utilities")
+
+	rotate := cmd.Command("rotate-key", "encrypt the key material of all instances with the primary encryption key").
+		Action(c.rotateKey)
+	rotate.Flag("envfile", "load the environment variable file").
+		Default("").
+		StringVar(&c.envFile)
+	rotate.Flag("distributed", "use the database of the distributed mode").
+		BoolVar(&c.distributed)
+}
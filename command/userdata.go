@@ -0,0 +1,86 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/poolfile"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type userdataCommand struct {
+	envFile  string
+	poolFile string
+	pool     string
+	unmasked bool
+}
+
+// render prints the userdata a new instance of the pool is created with.
+func (c *userdataCommand) render(*kingpin.ParseContext) error {
+	err := godotenv.Load(c.envFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	env, err := config.FromEnviron()
+	if err != nil {
+		return err
+	}
+	// keep the output to the userdata.
+	logrus.SetOutput(os.Stderr)
+	logrus.SetLevel(logrus.WarnLevel)
+
+	configPool, err := poolfile.ConfigPoolFile(c.poolFile, &env)
+	if err != nil {
+		return err
+	}
+	pools, err := poolfile.ProcessPool(configPool, env.Runner.Name)
+	if err != nil {
+		return err
+	}
+	poolManager := drivers.New(nocontext, nil, &env)
+	if err = poolManager.Add(pools...); err != nil {
+		return err
+	}
+	if err = poolManager.AddTmate(&env); err != nil {
+		return err
+	}
+	if err = poolManager.AddChecksums(&env); err != nil {
+		return err
+	}
+
+	userdata, err := poolManager.Userdata(nocontext, c.pool, poolManager.GetTLSServerName(), !c.unmasked)
+	if err != nil {
+		return err
+	}
+	fmt.Println(userdata)
+	return nil
+}
+
+func registerUserdata(app *kingpin.Application) {
+	c := new(userdataCommand)
+
+	cmd := app.Command("userdata", "userdata utilities")
+
+	render := cmd.Command("render", "print the userdata of a new instance of a pool, with secrets masked").
+		Action(c.render)
+	render.Flag("envfile", "load the environment variable file").
+		Default("").
+		StringVar(&c.envFile)
+	render.Flag("poolfile", "file, directory or glob of pool files").
+		Default("").
+		StringVar(&c.poolFile)
+	render.Flag("pool", "name of the pool").
+		Required().
+		StringVar(&c.pool)
+	render.Flag("unmasked", "print the secrets").
+		BoolVar(&c.unmasked)
+}
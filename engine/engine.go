@@ -17,6 +17,7 @@ import (
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/internal/redact"
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/runner-go/pipeline/runtime"
@@ -135,7 +136,7 @@ func (e *Engine) Setup(ctx context.Context, specv runtime.Spec) error {
 		setupRequest.MountDockerSocket = &b
 	}
 
-	logr.WithField("request", fmt.Sprintf("%+v", setupRequest)).Traceln("Calling LE.Setup")
+	logr.WithField("request", redact.ForSetupRequest(setupRequest).Value(setupRequest)).Traceln("Calling LE.Setup")
 	setupResponse, err := client.Setup(ctx, setupRequest)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to call LE.Setup")
@@ -257,6 +258,8 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		WorkingDir: step.WorkingDir,
 	}
 
+	redactor := redact.ForStep(&step.Step)
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 
@@ -293,7 +296,7 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		return nil, err
 	}
 
-	logr.WithField("startStepResponse", startStepResponse).
+	logr.WithField("startStepResponse", redactor.Value(startStepResponse)).
 		Traceln("LE.StartStep complete")
 
 	pollResponse, err := client.RetryPollStep(ctx, &leapi.PollStepRequest{ID: req.ID}, timeoutStep)
@@ -302,7 +305,7 @@ func (e *Engine) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		return nil, err
 	}
 
-	logr.WithField("pollResponse", pollResponse).
+	logr.WithField("pollResponse", redactor.Value(pollResponse)).
 		Traceln("completed LE.RetryPollStep")
 
 	wg.Wait()
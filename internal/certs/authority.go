@@ -0,0 +1,268 @@
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthorityOptions configures a runner-wide certificate authority.
+type AuthorityOptions struct {
+	// CertFile and KeyFile hold the PEM encoded CA certificate and private
+	// key. If neither exists a CA is generated and written to them.
+	CertFile string
+	KeyFile  string
+	// KeyType is used for generated CAs and for instance certificates.
+	KeyType KeyType
+	// Validity of generated CAs.
+	Validity time.Duration
+	// CertValidity of instance certificates, capped at the expiry of the CA.
+	CertValidity time.Duration
+	// RotateBefore is how long before it expires the CA is replaced by a
+	// newly generated one. Zero disables rotation. A CA supplied by the
+	// operator is never overwritten, a warning is logged instead.
+	RotateBefore time.Duration
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval time.Duration
+}
+
+// Authority is a long-lived CA that signs the certificates of instances, so
+// that a CA does not have to be generated for each instance and its private
+// key does not have to be stored with the instance.
+//
+// Instances keep the CA certificate they were created with, so replacing the
+// CA, either by rotation or by updating the files, only affects instances
+// created afterwards.
+type Authority struct {
+	opts AuthorityOptions
+
+	mu      sync.Mutex
+	cert    *x509.Certificate
+	key     crypto.Signer
+	modTime time.Time
+	checked time.Time
+	warned  bool
+	now     func() time.Time
+}
+
+// NewAuthority loads the CA from the files in opts, generating it if the
+// files do not exist.
+func NewAuthority(opts AuthorityOptions) (*Authority, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("certs: the ca certificate and key files are required")
+	}
+	if opts.KeyType == "" {
+		opts.KeyType = KeyECDSAP256
+	}
+	if opts.Validity <= 0 {
+		opts.Validity = DefaultCAValidity
+	}
+	if opts.CertValidity <= 0 {
+		opts.CertValidity = DefaultCertValidity
+	}
+	if opts.RotateBefore >= opts.Validity {
+		return nil, errors.New("certs: the ca has to be rotated before it expires, not as soon as it is generated")
+	}
+	a := &Authority{opts: opts, now: time.Now}
+
+	_, certErr := os.Stat(opts.CertFile)
+	_, keyErr := os.Stat(opts.KeyFile)
+	switch {
+	case errors.Is(certErr, fs.ErrNotExist) && errors.Is(keyErr, fs.ErrNotExist):
+		if err := a.rotate(); err != nil {
+			return nil, err
+		}
+	case certErr != nil:
+		return nil, fmt.Errorf("certs: %w", certErr)
+	case keyErr != nil:
+		return nil, fmt.Errorf("certs: %w", keyErr)
+	default:
+		if err := a.load(); err != nil {
+			return nil, err
+		}
+	}
+	a.checked = a.now()
+	return a, nil
+}
+
+// Generate returns a certificate for tlsServerName signed by the CA, and the
+// CA certificate.
+func (a *Authority) Generate(runnerName, tlsServerName string) (*types.InstanceCreateOpts, error) {
+	a.mu.Lock()
+	now := a.now()
+	a.refresh(now)
+	ca, caKey := a.cert, a.key
+	a.mu.Unlock()
+
+	// the key is generated without the lock, as an rsa key may take a while.
+	tlsCert, err := newCert(tlsServerName, ca, caKey, a.opts.KeyType, a.opts.CertValidity, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tls certificate: %w", err)
+	}
+	return &types.InstanceCreateOpts{
+		CACert:     encodeCert(ca.Raw),
+		TLSCert:    tlsCert.Cert,
+		TLSKey:     tlsCert.Key,
+		RunnerName: runnerName,
+	}, nil
+}
+
+// Certificate returns the current CA certificate.
+func (a *Authority) Certificate() *x509.Certificate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cert
+}
+
+// refresh reloads the CA if its files changed, and rotates it if it is about
+// to expire and was generated by a runner. Failures are logged and the
+// current CA is kept.
+func (a *Authority) refresh(now time.Time) {
+	if now.Sub(a.checked) >= a.opts.ReloadInterval {
+		a.checked = now
+		if modTime, err := a.lastModified(); err != nil {
+			logrus.WithError(err).Warnln("certs: unable to check the ca files")
+		} else if !modTime.Equal(a.modTime) {
+			if err := a.load(); err != nil {
+				logrus.WithError(err).Errorln("certs: unable to reload the ca, using the current one")
+			} else {
+				logrus.WithField("expires", a.cert.NotAfter).Infoln("certs: reloaded the ca")
+			}
+		}
+	}
+	if a.opts.RotateBefore > 0 && !now.Before(a.cert.NotAfter.Add(-a.opts.RotateBefore)) {
+		if !generated(a.cert) {
+			if !a.warned {
+				a.warned = true
+				logrus.WithField("expires", a.cert.NotAfter).
+					WithField("file", a.opts.CertFile).
+					Warnln("certs: the ca is about to expire, it was not generated by the runner and has to be replaced by the operator")
+			}
+			return
+		}
+		expires := a.cert.NotAfter
+		if err := a.rotate(); err != nil {
+			logrus.WithError(err).Errorln("certs: unable to rotate the ca, using the current one")
+			return
+		}
+		logrus.WithField("previous_expires", expires).
+			WithField("expires", a.cert.NotAfter).
+			Infoln("certs: rotated the ca")
+	}
+}
+
+// load reads the CA from its files.
+func (a *Authority) load() error {
+	modTime, err := a.lastModified()
+	if err != nil {
+		return err
+	}
+	certPEM, err := os.ReadFile(a.opts.CertFile)
+	if err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	keyPEM, err := os.ReadFile(a.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("certs: invalid ca %s: %w", a.opts.CertFile, err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("certs: invalid ca %s: %w", a.opts.CertFile, err)
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("certs: %s is not a ca certificate", a.opts.CertFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("certs: unsupported ca key %s", a.opts.KeyFile)
+	}
+	a.cert, a.key, a.modTime, a.warned = cert, key, modTime, false
+	return nil
+}
+
+// generated reports whether the CA was generated by a runner, rather than
+// supplied by the operator.
+func generated(cert *x509.Certificate) bool {
+	return cert.Subject.CommonName == caCommonName && bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
+
+// rotate generates a new CA and writes it to its files. It must only replace
+// a CA generated by a runner.
+func (a *Authority) rotate() error {
+	cert, key, err := newCA(a.opts.KeyType, a.opts.Validity, a.now())
+	if err != nil {
+		return fmt.Errorf("certs: failed to generate ca: %w", err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	// a runner reading the files in between sees a mismatched pair, fails
+	// to load it and keeps its current CA until the next check.
+	if err := writeFile(a.opts.KeyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeFile(a.opts.CertFile, encodeCert(cert.Raw), 0644); err != nil {
+		return err
+	}
+	modTime, err := a.lastModified()
+	if err != nil {
+		return err
+	}
+	a.cert, a.key, a.modTime = cert, key, modTime
+	return nil
+}
+
+// lastModified returns the latest modification time of the CA files.
+func (a *Authority) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{a.opts.CertFile, a.opts.KeyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("certs: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// writeFile replaces a file atomically.
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+"-*")
+	if err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("certs: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	return nil
+}
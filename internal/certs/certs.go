@@ -1,27 +1,186 @@
 package certs
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// KeyType is the algorithm and size of a generated private key.
+type KeyType string
 
-	"github.com/harness/lite-engine/cli/certs"
+// Supported key types.
+const (
+	KeyECDSAP256 KeyType = "ecdsa-p256"
+	KeyECDSAP384 KeyType = "ecdsa-p384"
+	KeyRSA2048   KeyType = "rsa-2048"
+	KeyRSA4096   KeyType = "rsa-4096"
 )
 
+const (
+	// DefaultCAValidity is the validity of generated runner CAs.
+	DefaultCAValidity = 3650 * 24 * time.Hour
+	// DefaultCertValidity is the validity of instance certificates.
+	DefaultCertValidity = 1080 * 24 * time.Hour
+
+	// organization name of the certificates, the same as the one used by lite-engine.
+	organization = "drone.vm.generated"
+	serialLimit  = 128
+	// notBefore is set slightly in the past to account for time
+	// skew in the VMs, otherwise the certs sometimes are not yet valid.
+	clockSkew = 5 * time.Minute
+)
+
+// ParseKeyType returns the key type named s. ecdsa and rsa are
+// short for ecdsa-p256 and rsa-2048.
+func ParseKeyType(s string) (KeyType, error) {
+	switch kt := KeyType(strings.ToLower(s)); kt {
+	case "", "ecdsa":
+		return KeyECDSAP256, nil
+	case "rsa":
+		return KeyRSA2048, nil
+	case KeyECDSAP256, KeyECDSAP384, KeyRSA2048, KeyRSA4096:
+		return kt, nil
+	}
+	return "", fmt.Errorf("unsupported key type %q, has to be one of ecdsa, %s, %s, rsa, %s, %s",
+		s, KeyECDSAP256, KeyECDSAP384, KeyRSA2048, KeyRSA4096)
+}
+
+// Certificate stores a PEM encoded certificate and private key.
+type Certificate struct {
+	Cert []byte
+	Key  []byte
+}
+
+// Generate creates a new CA and a certificate for tlsServerName signed by it.
+// The CA private key is discarded, it is not needed once the certificate is
+// signed.
 func Generate(runnerName, tlsServerName string) (*types.InstanceCreateOpts, error) {
-	ca, err := certs.GenerateCA()
+	ca, caKey, err := newCA(KeyECDSAP256, DefaultCertValidity, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ca certificate: %w", err)
 	}
-	tlsCert, err := certs.GenerateCert(tlsServerName, ca)
+	tlsCert, err := newCert(tlsServerName, ca, caKey, KeyECDSAP256, DefaultCertValidity, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tls certificate: %w", err)
 	}
 	return &types.InstanceCreateOpts{
-		CACert:     ca.Cert,
-		CAKey:      ca.Key,
+		CACert:     encodeCert(ca.Raw),
 		TLSCert:    tlsCert.Cert,
 		TLSKey:     tlsCert.Key,
 		RunnerName: runnerName,
 	}, nil
 }
+
+// caCommonName is the common name of the CAs generated by the runner.
+const caCommonName = "drone runner ca"
+
+// newCA returns a self-signed CA certificate and its private key.
+func newCA(kt KeyType, validity time.Duration, now time.Time) (*x509.Certificate, crypto.Signer, error) {
+	template, err := newTemplate(validity, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.Subject.CommonName = caCommonName
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	key, err := newKey(kt)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// newCert returns a certificate for host signed by ca. It is used by the
+// lite engine as its server certificate and by the runner as its client
+// certificate. The certificate does not outlive the CA.
+func newCert(host string, ca *x509.Certificate, caKey crypto.Signer, kt KeyType, validity time.Duration, now time.Time) (*Certificate, error) {
+	template, err := newTemplate(validity, now)
+	if err != nil {
+		return nil, err
+	}
+	if template.NotAfter.After(ca.NotAfter) {
+		template.NotAfter = ca.NotAfter
+	}
+	template.DNSNames = []string{host}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if strings.HasPrefix(string(kt), "rsa") {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	key, err := newKey(kt)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Cert: encodeCert(der), Key: keyPEM}, nil
+}
+
+func newTemplate(validity time.Duration, now time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialLimit))
+	if err != nil {
+		return nil, err
+	}
+	notBefore := now.Add(-clockSkew).Truncate(time.Minute)
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{organization}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+func newKey(kt KeyType) (crypto.Signer, error) {
+	switch kt {
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", kt)
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
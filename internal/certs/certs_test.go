@@ -0,0 +1,271 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// verify checks that the instance certificate is signed by the CA returned
+// with it, and can be used by both the server and the client at the given time.
+func verify(t *testing.T, opts *types.InstanceCreateOpts, host string, at time.Time) *x509.Certificate {
+	t.Helper()
+	if _, err := tls.X509KeyPair(opts.TLSCert, opts.TLSKey); err != nil {
+		t.Fatalf("invalid key pair: %s", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(opts.CACert) {
+		t.Fatalf("invalid ca certificate")
+	}
+	block, _ := pem.Decode(opts.TLSCert)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, CurrentTime: at, KeyUsages: []x509.ExtKeyUsage{usage}})
+		if err != nil {
+			t.Errorf("unable to verify the certificate: %s", err)
+		}
+	}
+	return cert
+}
+
+func TestGenerate(t *testing.T) {
+	opts, err := Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, opts, "drone", time.Now())
+	if opts.RunnerName != "runner" {
+		t.Errorf("want runner name runner, got %s", opts.RunnerName)
+	}
+}
+
+func TestParseKeyType(t *testing.T) {
+	tests := map[string]KeyType{
+		"":           KeyECDSAP256,
+		"ecdsa":      KeyECDSAP256,
+		"ECDSA-P384": KeyECDSAP384,
+		"rsa":        KeyRSA2048,
+		"rsa-4096":   KeyRSA4096,
+	}
+	for s, want := range tests {
+		if got, err := ParseKeyType(s); err != nil || got != want {
+			t.Errorf("%q: want %s, got %s, %v", s, want, got, err)
+		}
+	}
+	if _, err := ParseKeyType("ed25519"); err == nil {
+		t.Errorf("want an error for an unsupported key type")
+	}
+}
+
+func TestAuthority(t *testing.T) {
+	dir := t.TempDir()
+	opts := AuthorityOptions{
+		CertFile: filepath.Join(dir, "ca.crt"),
+		KeyFile:  filepath.Join(dir, "ca.key"),
+		KeyType:  KeyRSA2048,
+	}
+	a, err := NewAuthority(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(opts.KeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("want the ca key to be written with mode 0600, got %v", err)
+	}
+	if _, ok := a.key.(*rsa.PrivateKey); !ok {
+		t.Errorf("want an rsa ca key, got %T", a.key)
+	}
+
+	first, err := a.Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := verify(t, first, "drone", time.Now())
+	if cert.NotAfter.After(a.Certificate().NotAfter) {
+		t.Errorf("want the certificate to expire with the ca")
+	}
+	second, _ := a.Generate("runner", "drone")
+	if string(first.CACert) != string(second.CACert) || string(first.TLSCert) == string(second.TLSCert) {
+		t.Errorf("want new certificates signed by the same ca")
+	}
+
+	// a second runner loads the persisted ca.
+	b, err := NewAuthority(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Certificate().Equal(a.Certificate()) {
+		t.Errorf("want the ca to be loaded from its files")
+	}
+}
+
+func TestAuthority_Reload(t *testing.T) {
+	dir := t.TempDir()
+	opts := AuthorityOptions{
+		CertFile:       filepath.Join(dir, "ca.crt"),
+		KeyFile:        filepath.Join(dir, "ca.key"),
+		ReloadInterval: time.Minute,
+	}
+	a, err := NewAuthority(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	previous := a.Certificate()
+
+	// replace the files, e.g. by the operator.
+	replaced, err := NewAuthority(AuthorityOptions{CertFile: filepath.Join(dir, "new.crt"), KeyFile: filepath.Join(dir, "new.key"), KeyType: KeyECDSAP384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range map[string]string{"new.crt": "ca.crt", "new.key": "ca.key"} {
+		if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	future := now.Add(time.Second)
+	_ = os.Chtimes(opts.CertFile, future, future)
+
+	if _, err := a.Generate("runner", "drone"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Certificate().Equal(previous) {
+		t.Errorf("want the ca to be kept until the reload interval passed")
+	}
+	now = now.Add(time.Minute)
+	opts2, err := a.Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Certificate().Equal(replaced.Certificate()) {
+		t.Errorf("want the replaced ca to be loaded")
+	}
+	if _, ok := a.key.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("want an ecdsa ca key, got %T", a.key)
+	}
+	verify(t, opts2, "drone", now)
+
+	// an invalid file keeps the current ca.
+	if err := os.WriteFile(opts.CertFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := a.Generate("runner", "drone"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Certificate().Equal(replaced.Certificate()) {
+		t.Errorf("want the current ca to be kept if the files are invalid")
+	}
+}
+
+func TestAuthority_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	opts := AuthorityOptions{
+		CertFile:     filepath.Join(dir, "ca.crt"),
+		KeyFile:      filepath.Join(dir, "ca.key"),
+		Validity:     48 * time.Hour,
+		RotateBefore: 24 * time.Hour,
+	}
+	a, err := NewAuthority(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	before, err := a.Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(24 * time.Hour)
+	after, err := a.Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before.CACert) == string(after.CACert) {
+		t.Fatalf("want the ca to be rotated before it expires")
+	}
+	verify(t, after, "drone", now)
+
+	// instances created before the rotation keep their ca.
+	verify(t, before, "drone", now)
+
+	// the rotated ca is persisted.
+	b, err := NewAuthority(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Certificate().Equal(a.Certificate()) {
+		t.Errorf("want the rotated ca to be written to its files")
+	}
+
+	opts.RotateBefore = opts.Validity
+	if _, err := NewAuthority(opts); err == nil {
+		t.Errorf("want an error if the ca is rotated as soon as it is generated")
+	}
+}
+
+func TestAuthority_RotateOperatorCA(t *testing.T) {
+	dir := t.TempDir()
+	opts := AuthorityOptions{
+		CertFile:     filepath.Join(dir, "ca.crt"),
+		KeyFile:      filepath.Join(dir, "ca.key"),
+		Validity:     48 * time.Hour,
+		RotateBefore: 24 * time.Hour,
+	}
+
+	// a ca supplied by the operator, expiring within the rotation window.
+	template, err := newTemplate(time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Subject.CommonName = "corporate ca"
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign
+	key, err := newKey(KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(opts.KeyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(opts.CertFile, encodeCert(der), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthority(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := a.Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(created.CACert) != string(encodeCert(der)) {
+		t.Errorf("want the ca of the operator kept although it is about to expire")
+	}
+	if b, _ := os.ReadFile(opts.CertFile); string(b) != string(encodeCert(der)) {
+		t.Errorf("want the ca files of the operator left untouched")
+	}
+	verify(t, created, "drone", time.Now())
+}
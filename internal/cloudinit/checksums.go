@@ -0,0 +1,147 @@
+package cloudinit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+)
+
+// LoadChecksums returns the SHA-256 checksums of the binaries downloaded by
+// the userdata, keyed by file name, e.g. lite-engine-linux-amd64. They are
+// read from location, a file or an http(s) URL in the format of sha256sum,
+// and from values, which take precedence.
+func LoadChecksums(ctx context.Context, values map[string]string, location string) (map[string]string, error) {
+	checksums := map[string]string{}
+	if location != "" {
+		data, err := readLocation(ctx, location)
+		if err != nil {
+			return nil, fmt.Errorf("checksums: %w", err)
+		}
+		if checksums, err = ParseChecksums(data); err != nil {
+			return nil, fmt.Errorf("checksums: %s: %w", location, err)
+		}
+	}
+	for name, sum := range values {
+		sum = strings.ToLower(strings.TrimSpace(sum))
+		if !validChecksum(sum) {
+			return nil, fmt.Errorf("checksums: invalid sha256 checksum for %s", name)
+		}
+		checksums[name] = sum
+	}
+	return checksums, nil
+}
+
+// ParseChecksums parses checksums in the format of sha256sum, one
+// "<checksum>  <file>" per line. Paths are reduced to their file names.
+func ParseChecksums(data []byte) (map[string]string, error) {
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want a checksum and a file name", line)
+		}
+		sum := strings.ToLower(fields[0])
+		if !validChecksum(sum) {
+			return nil, fmt.Errorf("line %d: invalid sha256 checksum", line)
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		name = name[strings.LastIndex(name, "/")+1:]
+		checksums[name] = sum
+	}
+	return checksums, scanner.Err()
+}
+
+func validChecksum(sum string) bool {
+	b, err := hex.DecodeString(sum)
+	return err == nil && len(b) == 32
+}
+
+func readLocation(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", location, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// LiteEngineChecksum returns the checksum of the lite engine binary, or an
+// empty string if it is not known.
+func (p Params) LiteEngineChecksum() string {
+	return p.Checksums["lite-engine-"+p.Platform.OS+"-"+p.Platform.Arch+p.exe()]
+}
+
+// PluginChecksum returns the checksum of the plugin binary, or an empty
+// string if it is not known.
+func (p Params) PluginChecksum() string {
+	return p.Checksums["plugin-"+p.Platform.OS+"-"+p.Platform.Arch+p.exe()]
+}
+
+// SplitTestsChecksum returns the checksum of the split_tests binary, or an
+// empty string if it is not known.
+func (p Params) SplitTestsChecksum() string {
+	return p.Checksums["split_tests-"+p.Platform.OS+"_"+p.Platform.Arch]
+}
+
+func (p Params) exe() string {
+	if p.Platform.OS == oshelp.OSWindows {
+		return ".exe"
+	}
+	return ""
+}
+
+// verifyLinux returns a command verifying the checksum of a downloaded
+// file, which is removed and the script aborted if it does not match. The
+// failure is written to the console so that it shows up in the console logs
+// of the instance. It returns an empty string if the checksum is not known.
+func verifyLinux(checksum, path string) string {
+	return verifyShell("sha256sum -c -", checksum, path)
+}
+
+// verifyMac is verifyLinux for macOS, which has shasum instead of sha256sum.
+func verifyMac(checksum, path string) string {
+	return verifyShell("shasum -a 256 -c -", checksum, path)
+}
+
+func verifyShell(command, checksum, path string) string {
+	if checksum == "" {
+		return ""
+	}
+	return fmt.Sprintf(`echo "%s  %s" | %s || { echo "[DRONE] sha256 checksum verification failed for %s" | tee /dev/console >&2; rm -f %s; exit 1; }`,
+		checksum, path, command, path, path)
+}
+
+// verifyWindows is verifyLinux for PowerShell.
+func verifyWindows(checksum, path string) string {
+	if checksum == "" {
+		return ""
+	}
+	return fmt.Sprintf(`if ((Get-FileHash -Algorithm SHA256 -Path "%s").Hash -ne "%s") { Write-Host "[DRONE] sha256 checksum verification failed for %s"; Remove-Item -Force "%s"; exit 1 }`,
+		path, checksum, path, path)
+}
@@ -30,13 +30,32 @@ type Params struct {
 	PluginBinaryURI      string
 	Tmate                types.Tmate
 	IsHosted             bool
+	// Checksums are the SHA-256 checksums of the downloaded binaries by
+	// file name, they are verified before the binaries are executed.
+	Checksums map[string]string
+	// Prebaked uses the lite engine and plugin binaries of the image if
+	// they are of the expected version, instead of downloading them. The
+	// version is checked with the checksums if set, otherwise against the
+	// <binary>.version file, which is written after a successful download
+	// and has to be shipped by images built without the runner.
+	Prebaked bool
+	// Network configures the proxy, trusted certificates and mirrors.
+	Network types.Network
 }
 
 var funcs = map[string]interface{}{
 	"base64": func(src string) string {
 		return base64.StdEncoding.EncodeToString([]byte(src))
 	},
-	"trim": strings.TrimSpace,
+	"trim":             strings.TrimSpace,
+	"verify":           verifyLinux,
+	"verifyMac":        verifyMac,
+	"verifyWindows":    verifyWindows,
+	"installed":        installedLinux,
+	"installedMac":     installedMac,
+	"installedWindows": installedWindows,
+	"indent":           indent,
+	"lower":            strings.ToLower,
 }
 
 const certsDir = "/tmp/certs/"
@@ -94,6 +113,20 @@ chmod 0600 {{ .CertPath }}
 
 echo {{ .TLSKey | base64 }} | base64 -d >> {{ .KeyPath }}
 chmod 0600 {{ .KeyPath }}
+{{ if .Network.CABundle }}
+if command -v update-ca-certificates > /dev/null; then
+echo {{ .Network.CABundle | base64 }} | base64 -d > /usr/local/share/ca-certificates/drone-ca-bundle.crt
+update-ca-certificates
+else
+echo {{ .Network.CABundle | base64 }} | base64 -d > /etc/pki/ca-trust/source/anchors/drone-ca-bundle.crt
+update-ca-trust extract
+fi
+{{ end }}
+{{ range $name, $value := .ProxyEnvironment }}
+export {{ $name }}={{ $value }} {{ lower $name }}={{ $value }}
+echo "{{ $name }}={{ $value }}" >> /etc/environment
+echo "{{ lower $name }}={{ $value }}" >> /etc/environment
+{{ end }}
 
 echo "setting up swap space"
 fallocate -l 30G /swapfile
@@ -103,28 +136,40 @@ swapon /swapfile
 echo "done setting up swap space"
 
 echo "downloading lite engine binary"
-/usr/bin/wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineUsrBinPath + ` || /usr/bin/wget --retry-connrefused --tries=10 --waitretry=10 -nv --debug ` + liteEngineUsrBinPath + `
+{{ if .Prebaked }}{{ installed .LiteEngineChecksum .LiteEngineVersion "/usr/bin/lite-engine" }} || {{ end }}/usr/bin/wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineUsrBinPath + ` || /usr/bin/wget --retry-connrefused --tries=10 --waitretry=10 -nv --debug ` + liteEngineUsrBinPath + `{{ if .Prebaked }} && echo "{{ .LiteEngineVersion }}" > /usr/bin/lite-engine.version{{ end }}
 echo "done downloading lite engine binary"
+{{ verify .LiteEngineChecksum "/usr/bin/lite-engine" }}
 chmod 777 /usr/bin/lite-engine
 touch $HOME/.env
 cp "/etc/environment" $HOME/.env
 echo "SKIP_PREPARE_SERVER=true" >> $HOME/.env;
 
 {{ if .PluginBinaryURI }}
-wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + pluginUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + pluginUsrBinPath + `
+{{ if .Prebaked }}{{ installed .PluginChecksum .PluginVersion "/usr/bin/plugin" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + pluginUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + pluginUsrBinPath + `{{ if .Prebaked }} && echo "{{ .PluginVersion }}" > /usr/bin/plugin.version{{ end }}
+{{ verify .PluginChecksum "/usr/bin/plugin" }}
 chmod 777 /usr/bin/plugin
 {{ end }}
 
 {{ if .HarnessTestBinaryURI }}
 wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + splitTestsUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + splitTestsUsrBinPath + `
+{{ verify .SplitTestsChecksum "/usr/bin/split_tests" }}
 chmod 777 /usr/bin/split_tests
 {{ end }}
 
 {{ if eq .Platform.Arch "amd64" }}
-curl -fL https://github.com/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64 > /usr/bin/envman
+curl -fL {{ .GitHub }}/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64 > /usr/bin/envman
 chmod 777 /usr/bin/envman
 {{ end }}
 
+{{ with .DockerProxyConfig }}
+mkdir -p /etc/systemd/system/docker.service.d
+echo {{ base64 . }} | base64 -d > /etc/systemd/system/docker.service.d/http-proxy.conf
+systemctl daemon-reload
+{{ end }}
+{{ with .DockerDaemonConfig }}
+mkdir -p /etc/docker
+echo {{ base64 . }} | base64 -d > /etc/docker/daemon.json
+{{ end }}
 systemctl disable docker.service
 update-alternatives --set iptables /usr/sbin/iptables-legacy
 echo "restarting docker"
@@ -141,12 +186,12 @@ search ." >> /etc/resolv.conf
 {{ if .Tmate.Enabled }}
 mkdir /addon
 {{ if eq .Platform.Arch "amd64" }}
-wget -nv https://github.com/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-amd64.tar.xz  -O /addon/tmate.xz
+wget -nv {{ .GitHub }}/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-amd64.tar.xz  -O /addon/tmate.xz
 tar -xf /addon/tmate.xz -C /addon/
 chmod 777  /addon/tmate-1.0-static-linux-amd64/tmate
 mv  /addon/tmate-1.0-static-linux-amd64/tmate /addon/tmate
 {{ else if eq .Platform.Arch "arm64" }}
-wget -nv https://github.com/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-arm64v8.tar.xz -O /addon/tmate.xz
+wget -nv {{ .GitHub }}/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-arm64v8.tar.xz -O /addon/tmate.xz
 tar -xf /addon/tmate.xz -C /addon/
 chmod 777  /addon/tmate-1.0-static-linux-arm64v8/tmate
 mv  /addon/tmate-1.0-static-linux-arm64v8/tmate /addon/tmate
@@ -170,14 +215,27 @@ chmod 0600 {{ .CertPath }}
 
 echo {{ .TLSKey | base64 }} | base64 -d >> {{ .KeyPath }}
 chmod 0600 {{ .KeyPath }}
+{{ if .Network.CABundle }}
+echo {{ .Network.CABundle | base64 }} | base64 -d > /tmp/certs/drone-ca-bundle.pem
+(cd /tmp/certs && split -p "-----BEGIN CERTIFICATE" drone-ca-bundle.pem drone-ca-cert- && for cert in drone-ca-cert-*; do security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain "$cert"; done)
+{{ end }}
+{{ range $name, $value := .ProxyEnvironment }}
+export {{ $name }}={{ $value }} {{ lower $name }}={{ $value }}
+{{ end }}
 
-/usr/local/bin/wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineUsrLocalBinPath + ` || /usr/local/bin/wget --retry-connrefused --tries=10 --waitretry=10 ` + liteEngineUsrLocalBinPath + `
+{{ if .Prebaked }}{{ installedMac .LiteEngineChecksum .LiteEngineVersion "/usr/local/bin/lite-engine" }} || {{ end }}/usr/local/bin/wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineUsrLocalBinPath + ` || /usr/local/bin/wget --retry-connrefused --tries=10 --waitretry=10 ` + liteEngineUsrLocalBinPath + `{{ if .Prebaked }} && echo "{{ .LiteEngineVersion }}" > /usr/local/bin/lite-engine.version{{ end }}
+{{ verifyMac .LiteEngineChecksum "/usr/local/bin/lite-engine" }}
 chmod 777 /usr/local/bin/lite-engine
 touch $HOME/.env
 echo "SKIP_PREPARE_SERVER=true" >> .env;
+{{ range $name, $value := .ProxyEnvironment }}
+echo "{{ $name }}={{ $value }}" >> $HOME/.env
+echo "{{ lower $name }}={{ $value }}" >> $HOME/.env
+{{ end }}
 
 {{ if .PluginBinaryURI }}
-wget {{ .PluginBinaryURI }}/plugin-{{ .Platform.OS }}-{{ .Platform.Arch }}  -O /usr/bin/plugin
+{{ if .Prebaked }}{{ installedMac .PluginChecksum .PluginVersion "/usr/bin/plugin" }} || {{ end }}wget {{ .PluginBinaryURI }}/plugin-{{ .Platform.OS }}-{{ .Platform.Arch }}  -O /usr/bin/plugin{{ if .Prebaked }} && echo "{{ .PluginVersion }}" > /usr/bin/plugin.version{{ end }}
+{{ verifyMac .PluginChecksum "/usr/bin/plugin" }}
 chmod 777 /usr/bin/plugin
 {{ end }}
 
@@ -196,18 +254,31 @@ chmod 0600 {{ .CertPath }}
 
 echo {{ .TLSKey | base64 }} | base64 -d >> {{ .KeyPath }}
 chmod 0600 {{ .KeyPath }}
+{{ if .Network.CABundle }}
+echo {{ .Network.CABundle | base64 }} | base64 -d > /tmp/certs/drone-ca-bundle.pem
+(cd /tmp/certs && split -p "-----BEGIN CERTIFICATE" drone-ca-bundle.pem drone-ca-cert- && for cert in drone-ca-cert-*; do security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain "$cert"; done)
+{{ end }}
+{{ range $name, $value := .ProxyEnvironment }}
+export {{ $name }}={{ $value }} {{ lower $name }}={{ $value }}
+{{ end }}
 
-wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineHomebrewBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + liteEngineHomebrewBinPath + `
+{{ if .Prebaked }}{{ installedMac .LiteEngineChecksum .LiteEngineVersion "/opt/homebrew/bin/lite-engine" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineHomebrewBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + liteEngineHomebrewBinPath + `{{ if .Prebaked }} && echo "{{ .LiteEngineVersion }}" > /opt/homebrew/bin/lite-engine.version{{ end }}
+{{ verifyMac .LiteEngineChecksum "/opt/homebrew/bin/lite-engine" }}
 chmod 777 /opt/homebrew/bin/lite-engine
 touch $HOME/.env
 echo "SKIP_PREPARE_SERVER=true" >> .env;
+{{ range $name, $value := .ProxyEnvironment }}
+echo "{{ $name }}={{ $value }}" >> $HOME/.env
+echo "{{ lower $name }}={{ $value }}" >> $HOME/.env
+{{ end }}
 
 {{ if .PluginBinaryURI }}
-wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + pluginUsrLocalBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + pluginUsrLocalBinPath + `
+{{ if .Prebaked }}{{ installedMac .PluginChecksum .PluginVersion "/usr/local/bin/plugin" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + pluginUsrLocalBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + pluginUsrLocalBinPath + `{{ if .Prebaked }} && echo "{{ .PluginVersion }}" > /usr/local/bin/plugin.version{{ end }}
+{{ verifyMac .PluginChecksum "/usr/local/bin/plugin" }}
 chmod 777 /usr/local/bin/plugin
 {{ end }}
 
-curl -fL https://github.com/bitrise-io/envman/releases/download/2.4.2/envman-Darwin-arm64 > /usr/local/bin/envman
+curl -fL {{ .GitHub }}/bitrise-io/envman/releases/download/2.4.2/envman-Darwin-arm64 > /usr/local/bin/envman
 chmod 777 /usr/local/bin/envman
 
 /opt/homebrew/bin/lite-engine server --env-file $HOME/.env > $HOME/lite-engine.log 2>&1 &
@@ -284,11 +355,31 @@ func LinuxBash(params *Params) (payload string) {
 
 const ubuntuScript = `
 #cloud-config
+{{- if .Network.CABundle }}
+ca_certs:
+  trusted:
+  - |
+{{ indent 4 .Network.CABundle }}
+{{- end }}
 apt:
+{{- if .Network.Proxy }}
+  http_proxy: {{ .Network.Proxy }}
+  https_proxy: {{ .Network.Proxy }}
+{{- end }}
+{{- if .Network.Mirrors.Apt }}
+  primary:
+  - arches: [default]
+    uri: {{ .Network.Mirrors.Apt }}
+{{- end }}
   sources:
     docker.list:
-      source: deb [arch={{ .Platform.Arch }}] https://download.docker.com/linux/ubuntu $RELEASE stable
-      keyid: 9DC858229FC7DD38854AE2D88D81803C0EBFCD88
+      source: deb [arch={{ .Platform.Arch }}] {{ .DockerRepository }} $RELEASE stable
+{{- if .Network.Mirrors.DockerKey }}
+      key: |
+{{ indent 8 .Network.Mirrors.DockerKey }}
+{{- else }}
+      keyid: {{ .DockerKeyID }}
+{{- end }}
 packages:
 - wget
 - docker-ce
@@ -305,21 +396,45 @@ write_files:
   permissions: '0600'
   encoding: b64
   content: {{ .TLSKey | base64 }}
+{{- with .DockerProxyConfig }}
+- path: /etc/systemd/system/docker.service.d/http-proxy.conf
+  encoding: b64
+  content: {{ base64 . }}
+{{- end }}
+{{- with .DockerDaemonConfig }}
+- path: /etc/docker/daemon.json
+  encoding: b64
+  content: {{ base64 . }}
+{{- end }}
 runcmd:
+{{- range $name, $value := .ProxyEnvironment }}
+- 'export {{ $name }}={{ $value }} {{ lower $name }}={{ $value }}'
+- 'echo "{{ $name }}={{ $value }}" >> /etc/environment'
+- 'echo "{{ lower $name }}={{ $value }}" >> /etc/environment'
+{{- end }}
 - 'set -x'
 - 'ufw allow 9079'
-- 'wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 -nv --debug ` + liteEngineUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 -nv --debug ` + liteEngineUsrBinPath + `'
+- '{{ if .Prebaked }}{{ installed .LiteEngineChecksum .LiteEngineVersion "/usr/bin/lite-engine" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 -nv --debug ` + liteEngineUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 -nv --debug ` + liteEngineUsrBinPath + `{{ if .Prebaked }} && echo "{{ .LiteEngineVersion }}" > /usr/bin/lite-engine.version{{ end }}'
+{{ with verify .LiteEngineChecksum "/usr/bin/lite-engine" }}
+- '{{ . }}'
+{{ end }}
 - 'chmod 777 /usr/bin/lite-engine'
 {{ if .HarnessTestBinaryURI }}
 - 'wget -nv "{{ .HarnessTestBinaryURI }}/{{ .Platform.Arch }}/{{ .Platform.OS }}/bin/split_tests-{{ .Platform.OS }}_{{ .Platform.Arch }}" -O /usr/bin/split_tests'
+{{ with verify .SplitTestsChecksum "/usr/bin/split_tests" }}
+- '{{ . }}'
+{{ end }}
 - 'chmod 777 /usr/bin/split_tests'
 {{ end }}
 {{ if .PluginBinaryURI }}
-- 'wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 -nv ` + pluginUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 -nv ` + pluginUsrBinPath + `'
+- '{{ if .Prebaked }}{{ installed .PluginChecksum .PluginVersion "/usr/bin/plugin" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 -nv ` + pluginUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 -nv ` + pluginUsrBinPath + `{{ if .Prebaked }} && echo "{{ .PluginVersion }}" > /usr/bin/plugin.version{{ end }}'
+{{ with verify .PluginChecksum "/usr/bin/plugin" }}
+- '{{ . }}'
+{{ end }}
 - 'chmod 777 /usr/bin/plugin'
 {{ end }}
 {{ if eq .Platform.Arch "amd64" }}
-- 'curl -fL https://github.com/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64 > /usr/bin/envman'
+- 'curl -fL {{ .GitHub }}/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64 > /usr/bin/envman'
 - 'chmod 777 /usr/bin/envman'
 {{ end }}
 - 'touch /root/.env'
@@ -328,13 +443,13 @@ runcmd:
 {{ if .Tmate.Enabled }}
 - 'mkdir /addon'
 {{ if eq .Platform.Arch "amd64" }}
-- 'wget -nv https://github.com/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-amd64.tar.xz  -O /addon/tmate.xz' 
+- 'wget -nv {{ .GitHub }}/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-amd64.tar.xz  -O /addon/tmate.xz' 
 - 'tar -xf /addon/tmate.xz -C /addon/'
 - 'chmod 777  /addon/tmate-1.0-static-linux-amd64/tmate'
 - 'mv  /addon/tmate-1.0-static-linux-amd64/tmate /addon/tmate'
 - 'rm -rf /addon/tmate-1.0-static-linux-amd64/'
 {{ else if eq .Platform.Arch "arm64" }}
-- 'wget -nv https://github.com/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-arm64v8.tar.xz -O /addon/tmate.xz' 
+- 'wget -nv {{ .GitHub }}/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-arm64v8.tar.xz -O /addon/tmate.xz' 
 - 'tar -xf /addon/tmate.xz -C /addon/'
 - 'chmod 777  /addon/tmate-1.0-static-linux-arm64v8/tmate'
 - 'mv  /addon/tmate-1.0-static-linux-arm64v8/tmate /addon/tmate'
@@ -347,6 +462,15 @@ var ubuntuTemplate = template.Must(template.New(oshelp.OSLinux).Funcs(funcs).Par
 
 const amazonLinuxScript = `
 #cloud-config
+{{- if or .Network.Proxy .Network.CABundle }}
+bootcmd:
+{{- if .Network.Proxy }}
+- [ cloud-init-per, once, drone-yum-proxy, sh, -c, 'echo "proxy={{ .Network.Proxy }}" >> /etc/yum.conf' ]
+{{- end }}
+{{- if .Network.CABundle }}
+- [ cloud-init-per, once, drone-ca-bundle, sh, -c, 'echo {{ .Network.CABundle | base64 }} | base64 -d > /etc/pki/ca-trust/source/anchors/drone-ca-bundle.crt && update-ca-trust extract' ]
+{{- end }}
+{{- end }}
 packages:
 - wget
 - docker
@@ -364,21 +488,45 @@ write_files:
   permissions: '0600'
   encoding: b64
   content: {{ .TLSKey | base64 }}
+{{- with .DockerProxyConfig }}
+- path: /etc/systemd/system/docker.service.d/http-proxy.conf
+  encoding: b64
+  content: {{ base64 . }}
+{{- end }}
+{{- with .DockerDaemonConfig }}
+- path: /etc/docker/daemon.json
+  encoding: b64
+  content: {{ base64 . }}
+{{- end }}
 runcmd:
+{{- range $name, $value := .ProxyEnvironment }}
+- 'export {{ $name }}={{ $value }} {{ lower $name }}={{ $value }}'
+- 'echo "{{ $name }}={{ $value }}" >> /etc/environment'
+- 'echo "{{ lower $name }}={{ $value }}" >> /etc/environment'
+{{- end }}
 - 'sudo service docker start'
 - 'sudo usermod -a -G docker ec2-user'
-- 'wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + liteEngineUsrBinPath + `'
+- '{{ if .Prebaked }}{{ installed .LiteEngineChecksum .LiteEngineVersion "/usr/bin/lite-engine" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + liteEngineUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + liteEngineUsrBinPath + `{{ if .Prebaked }} && echo "{{ .LiteEngineVersion }}" > /usr/bin/lite-engine.version{{ end }}'
+{{ with verify .LiteEngineChecksum "/usr/bin/lite-engine" }}
+- '{{ . }}'
+{{ end }}
 - 'chmod 777 /usr/bin/lite-engine'
 {{ if .HarnessTestBinaryURI }}
 - 'wget -nv "{{ .HarnessTestBinaryURI }}/{{ .Platform.Arch }}/{{ .Platform.OS }}/bin/split_tests-{{ .Platform.OS }}_{{ .Platform.Arch }}" -O /usr/bin/split_tests'
+{{ with verify .SplitTestsChecksum "/usr/bin/split_tests" }}
+- '{{ . }}'
+{{ end }}
 - 'chmod 777 /usr/bin/split_tests'
 {{ end }}
 {{ if .PluginBinaryURI }}
-- 'wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + pluginUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + pluginUsrBinPath + `'
+- '{{ if .Prebaked }}{{ installed .PluginChecksum .PluginVersion "/usr/bin/plugin" }} || {{ end }}wget --retry-connrefused --retry-on-host-error --retry-on-http-error=503,404,429 --tries=10 --waitretry=10 ` + pluginUsrBinPath + ` || wget --retry-connrefused --tries=10 --waitretry=10 ` + pluginUsrBinPath + `{{ if .Prebaked }} && echo "{{ .PluginVersion }}" > /usr/bin/plugin.version{{ end }}'
+{{ with verify .PluginChecksum "/usr/bin/plugin" }}
+- '{{ . }}'
+{{ end }}
 - 'chmod 777 /usr/bin/plugin'
 {{ end }}
 {{ if eq .Platform.Arch "amd64" }}
-- 'curl -fL https://github.com/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64 > /usr/bin/envman'
+- 'curl -fL {{ .GitHub }}/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64 > /usr/bin/envman'
 - 'chmod 777 /usr/bin/envman'
 {{ end }}
 - 'touch /root/.env'
@@ -388,13 +536,13 @@ runcmd:
 {{ if .Tmate.Enabled }}
 - 'mkdir /addon'
 {{ if eq .Platform.Arch "amd64" }}
-- 'wget https://github.com/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-amd64.tar.xz  -O /addon/tmate.xz' 
+- 'wget {{ .GitHub }}/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-amd64.tar.xz  -O /addon/tmate.xz' 
 - 'tar -xf /addon/tmate.xz -C /addon/'
 - 'chmod 777  /addon/tmate-1.0-static-linux-amd64/tmate'
 - 'mv  /addon/tmate-1.0-static-linux-amd64/tmate /addon/tmate'
 - 'rm -rf /addon/tmate-1.0-static-linux-amd64/'
 {{ else if eq .Platform.Arch "arm64" }}
-- 'wget https://github.com/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-arm64v8.tar.xz -O /addon/tmate.xz' 
+- 'wget {{ .GitHub }}/harness/tmate/releases/download/1.0/tmate-1.0-static-linux-arm64v8.tar.xz -O /addon/tmate.xz' 
 - 'tar -xf /addon/tmate.xz -C /addon/'
 - 'chmod 777  /addon/tmate-1.0-static-linux-arm64v8/tmate'
 - 'mv  /addon/tmate-1.0-static-linux-arm64v8/tmate /addon/tmate'
@@ -453,6 +601,24 @@ const windowsScript = `
 <powershell>
 $ProgressPreference = 'SilentlyContinue'
 echo "[DRONE] Initialization Starting"
+{{ if .Network.CABundle }}
+echo "[DRONE] Trusting the CA bundle"
+$bundle = [System.Text.Encoding]::ASCII.GetString([System.Convert]::FromBase64String("{{ .Network.CABundle | base64 }}"))
+$i = 0
+[regex]::Matches($bundle, '-----BEGIN CERTIFICATE-----[\s\S]+?-----END CERTIFICATE-----') | ForEach-Object { $i++; $cert = "$env:TEMP\drone-ca-$i.crt"; Set-Content -Path $cert -Value $_.Value; Import-Certificate -FilePath $cert -CertStoreLocation Cert:\LocalMachine\Root | Out-Null }
+{{ end }}
+{{- if .Network.Proxy }}
+echo "[DRONE] Configuring the proxy"
+{{- range $name, $value := .ProxyEnvironment }}
+[Environment]::SetEnvironmentVariable("{{ $name }}", "{{ $value }}", "Machine")
+$env:{{ $name }} = "{{ $value }}"
+{{- end }}
+$bypass = @()
+{{- range .Network.NoProxy }}
+$bypass += [regex]::Escape("{{ . }}")
+{{- end }}
+[System.Net.WebRequest]::DefaultWebProxy = New-Object System.Net.WebProxy("{{ .Network.Proxy }}", $true, $bypass)
+{{ end }}
 
 echo "[DRONE] Installing Scoop Package Manager"
 iex "& {$(irm https://get.scoop.sh)} -RunAsAdmin"
@@ -489,14 +655,26 @@ if (test-path($profile) -eq "false")
 
 [Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12 -bor [Net.SecurityProtocolType]::Tls11 -bor [Net.SecurityProtocolType]::Tls
 
-Invoke-WebRequest -Uri "{{ .PluginBinaryURI }}/plugin-{{ .Platform.OS }}-{{ .Platform.Arch }}.exe" -OutFile "C:\Program Files\lite-engine\plugin.exe"
+{{ if .Prebaked }}if ({{ installedWindows .PluginChecksum .PluginVersion "C:\\Program Files\\lite-engine\\plugin.exe" }}) { Write-Host "[DRONE] using the prebaked plugin {{ .PluginVersion }}" } else { {{ end }}Invoke-WebRequest -Uri "{{ .PluginBinaryURI }}/plugin-{{ .Platform.OS }}-{{ .Platform.Arch }}.exe" -OutFile "C:\Program Files\lite-engine\plugin.exe"{{ if .Prebaked }}; if ($?) { Set-Content -Path "C:\Program Files\lite-engine\plugin.exe.version" -Value "{{ .PluginVersion }}" } }{{ end }}
+{{ verifyWindows .PluginChecksum "C:\\Program Files\\lite-engine\\plugin.exe" }}
 $env:Path = 'C:\Program Files\lite-engine;' + $env:Path
 
 # Refresh the PSEnviroment
 refreshenv
 
 fsutil file createnew "C:\Program Files\lite-engine\.env" 0
-Invoke-WebRequest -Uri "{{ .LiteEnginePath }}/lite-engine-{{ .Platform.OS }}-{{ .Platform.Arch }}.exe" -OutFile "C:\Program Files\lite-engine\lite-engine.exe"
+{{- range $name, $value := .ProxyEnvironment }}
+Add-Content -Path "C:\Program Files\lite-engine\.env" -Value "{{ $name }}={{ $value }}"
+{{- end }}
+{{- with .DockerDaemonConfig }}
+New-Item -ItemType Directory -Force -Path "C:\ProgramData\docker\config" | Out-Null
+Set-Content -Path "C:\ProgramData\docker\config\daemon.json" -Value ([System.Text.Encoding]::UTF8.GetString([System.Convert]::FromBase64String("{{ base64 . }}")))
+{{- end }}
+{{- if or .Network.Proxy .DockerDaemonConfig }}
+if (Get-Service docker -ErrorAction SilentlyContinue) { Restart-Service docker }
+{{- end }}
+{{ if .Prebaked }}if ({{ installedWindows .LiteEngineChecksum .LiteEngineVersion "C:\\Program Files\\lite-engine\\lite-engine.exe" }}) { Write-Host "[DRONE] using the prebaked lite engine {{ .LiteEngineVersion }}" } else { {{ end }}Invoke-WebRequest -Uri "{{ .LiteEnginePath }}/lite-engine-{{ .Platform.OS }}-{{ .Platform.Arch }}.exe" -OutFile "C:\Program Files\lite-engine\lite-engine.exe"{{ if .Prebaked }}; if ($?) { Set-Content -Path "C:\Program Files\lite-engine\lite-engine.exe.version" -Value "{{ .LiteEngineVersion }}" } }{{ end }}
+{{ verifyWindows .LiteEngineChecksum "C:\\Program Files\\lite-engine\\lite-engine.exe" }}
 New-NetFirewallRule -DisplayName "ALLOW TCP PORT 9079" -Direction inbound -Profile Any -Action Allow -LocalPort 9079 -Protocol TCP
 Start-Process -FilePath "C:\Program Files\lite-engine\lite-engine.exe" -ArgumentList "server --env-file=` + "`" + `"C:\Program Files\lite-engine\.env` + "`" + `"" -RedirectStandardOutput "{{ .LiteEngineLogsPath }}" -RedirectStandardError "C:\Program Files\lite-engine\log.err"
 
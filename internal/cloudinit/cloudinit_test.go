@@ -1,12 +1,29 @@
 package cloudinit_test
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/drone-runners/drone-runner-aws/internal/cloudinit"
 	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -53,3 +70,536 @@ func TestWindows(t *testing.T) {
 		t.Error("windows init script does not contain LE path")
 	}
 }
+
+const (
+	leChecksum     = "0a4c2d8e3f1b5a6c7d8e9f0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e"
+	pluginChecksum = "1111111111111111111111111111111111111111111111111111111111111111"
+	splitChecksum  = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func checksums(os, arch string) map[string]string {
+	exe := ""
+	if os == "windows" {
+		exe = ".exe"
+	}
+	return map[string]string{
+		"lite-engine-" + os + "-" + arch + exe: leChecksum,
+		"plugin-" + os + "-" + arch + exe:      pluginChecksum,
+		"split_tests-" + os + "_" + arch:       splitChecksum,
+	}
+}
+
+// before checks that the script contains both strings, the first one first.
+func before(t *testing.T, script, first, second string) {
+	t.Helper()
+	i, j := strings.Index(script, first), strings.Index(script, second)
+	if i < 0 || j < 0 || i > j {
+		t.Errorf("want %q before %q in\n%s", first, second, script)
+	}
+}
+
+func TestLinux_Checksums(t *testing.T) {
+	for _, osName := range []string{"ubuntu", "amazon-linux"} {
+		params := &cloudinit.Params{
+			LiteEnginePath:       liteEnginePath,
+			PluginBinaryURI:      "https://example.com/plugin",
+			HarnessTestBinaryURI: "https://example.com/split",
+			Platform:             types.Platform{OS: "linux", Arch: "amd64", OSName: osName},
+			Checksums:            checksums("linux", "amd64"),
+		}
+		s := cloudinit.Linux(params)
+		before(t, s, `echo "`+leChecksum+`  /usr/bin/lite-engine" | sha256sum -c -`, "chmod 777 /usr/bin/lite-engine")
+		before(t, s, `echo "`+pluginChecksum+`  /usr/bin/plugin" | sha256sum -c -`, "chmod 777 /usr/bin/plugin")
+		before(t, s, `echo "`+splitChecksum+`  /usr/bin/split_tests" | sha256sum -c -`, "chmod 777 /usr/bin/split_tests")
+		before(t, s, "sha256sum", "lite-engine server")
+
+		var config struct {
+			Runcmd []string `yaml:"runcmd"`
+		}
+		if err := yaml.Unmarshal([]byte(s), &config); err != nil {
+			t.Fatalf("%s: invalid cloud-config: %s", osName, err)
+		}
+		// the command after the download.
+		if !strings.HasPrefix(config.Runcmd[3], `echo "`+leChecksum) {
+			t.Errorf("%s: want the verification to be a separate command, got %q", osName, config.Runcmd)
+		}
+
+		params.Checksums = nil
+		if s := cloudinit.Linux(params); strings.Contains(s, "sha256sum") {
+			t.Errorf("%s: want no verification without checksums", osName)
+		}
+	}
+}
+
+func TestLinuxBash_Checksums(t *testing.T) {
+	params := &cloudinit.Params{
+		LiteEnginePath:  liteEnginePath,
+		PluginBinaryURI: "https://example.com/plugin",
+		Platform:        types.Platform{OS: "linux", Arch: "arm64"},
+		Checksums:       checksums("linux", "arm64"),
+	}
+	s := cloudinit.LinuxBash(params)
+	before(t, s, `echo "`+leChecksum+`  /usr/bin/lite-engine" | sha256sum -c -`, "chmod 777 /usr/bin/lite-engine")
+	before(t, s, `echo "`+pluginChecksum+`  /usr/bin/plugin" | sha256sum -c -`, "chmod 777 /usr/bin/plugin")
+}
+
+func TestMac_Checksums(t *testing.T) {
+	for arch, path := range map[string]string{"amd64": "/usr/local/bin/lite-engine", "arm64": "/opt/homebrew/bin/lite-engine"} {
+		params := &cloudinit.Params{
+			LiteEnginePath:  liteEnginePath,
+			PluginBinaryURI: "https://example.com/plugin",
+			Platform:        types.Platform{OS: "darwin", Arch: arch},
+			Checksums:       checksums("darwin", arch),
+		}
+		s := cloudinit.Mac(params)
+		before(t, s, `echo "`+leChecksum+`  `+path+`" | shasum -a 256 -c -`, "chmod 777 "+path)
+		if !strings.Contains(s, `echo "`+pluginChecksum) {
+			t.Errorf("%s: want the plugin to be verified", arch)
+		}
+	}
+}
+
+func TestWindows_Checksums(t *testing.T) {
+	params := &cloudinit.Params{
+		LiteEnginePath:  liteEnginePath,
+		PluginBinaryURI: "https://example.com/plugin",
+		Platform:        types.Platform{OS: "windows", Arch: "amd64"},
+		Checksums:       checksums("windows", "amd64"),
+	}
+	s := cloudinit.Windows(params)
+	before(t, s, `(Get-FileHash -Algorithm SHA256 -Path "C:\Program Files\lite-engine\lite-engine.exe").Hash -ne "`+leChecksum+`"`, "Start-Process")
+	before(t, s, `(Get-FileHash -Algorithm SHA256 -Path "C:\Program Files\lite-engine\plugin.exe").Hash -ne "`+pluginChecksum+`"`, "Start-Process")
+}
+
+// TestVerify runs the rendered verification against a downloaded file.
+func TestVerify(t *testing.T) {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum not found")
+	}
+	path := filepath.Join(t.TempDir(), "lite-engine")
+	content := []byte("lite engine")
+	sum := sha256.Sum256(content)
+
+	run := func(checksum string) (string, error) {
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		script, err := cloudinit.Custom(`{{ verify .LiteEngineChecksum "`+path+`" }}
+echo started`, &cloudinit.Params{
+			Platform:  types.Platform{OS: "linux", Arch: "amd64"},
+			Checksums: map[string]string{"lite-engine-linux-amd64": checksum},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the console is not writable in tests.
+		script = strings.ReplaceAll(script, "tee /dev/console", "cat")
+		out, err := exec.Command("bash", "-c", script).CombinedOutput()
+		return string(out), err
+	}
+
+	if out, err := run(hex.EncodeToString(sum[:])); err != nil || !strings.Contains(out, "started") {
+		t.Errorf("want the script to continue with a matching checksum, got %q, %v", out, err)
+	}
+	out, err := run(leChecksum)
+	if err == nil || strings.Contains(out, "started") || !strings.Contains(out, "verification failed for "+path) {
+		t.Errorf("want the script to fail with a mismatching checksum, got %q, %v", out, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want the file to be removed after a failed verification")
+	}
+}
+
+func TestLinux_Prebaked(t *testing.T) {
+	for _, osName := range []string{"ubuntu", "amazon-linux"} {
+		params := &cloudinit.Params{
+			LiteEnginePath:  "https://github.com/harness/lite-engine/releases/download/v0.5.68",
+			PluginBinaryURI: "https://github.com/drone/plugin/releases/download/v0.3.8-beta",
+			Platform:        types.Platform{OS: "linux", Arch: "amd64", OSName: osName},
+			Prebaked:        true,
+		}
+		s := cloudinit.Linux(params)
+		before(t, s, `[ "$(cat /usr/bin/lite-engine.version 2>/dev/null)" = "v0.5.68" ]`, "lite-engine-linux-amd64")
+		before(t, s, `echo "v0.5.68" > /usr/bin/lite-engine.version`, "lite-engine server")
+		before(t, s, `echo "v0.3.8-beta" > /usr/bin/plugin.version`, "lite-engine server")
+
+		var config struct {
+			Runcmd []string `yaml:"runcmd"`
+		}
+		if err := yaml.Unmarshal([]byte(s), &config); err != nil {
+			t.Fatalf("%s: invalid cloud-config: %s", osName, err)
+		}
+
+		params.Prebaked = false
+		if s := cloudinit.Linux(params); strings.Contains(s, "prebaked") || strings.Contains(s, ".version") {
+			t.Errorf("%s: want the binaries to be downloaded unconditionally", osName)
+		}
+	}
+}
+
+func TestMac_Prebaked(t *testing.T) {
+	params := &cloudinit.Params{
+		LiteEnginePath: liteEnginePath + "/v0.5.68",
+		Platform:       types.Platform{OS: "darwin", Arch: "arm64"},
+		Checksums:      checksums("darwin", "arm64"),
+		Prebaked:       true,
+	}
+	s := cloudinit.Mac(params)
+	before(t, s, `echo "`+leChecksum+`  /opt/homebrew/bin/lite-engine" | shasum -a 256 -c -s -`, "lite-engine-darwin-arm64")
+}
+
+func TestWindows_Prebaked(t *testing.T) {
+	params := &cloudinit.Params{
+		LiteEnginePath:  liteEnginePath + "/v0.5.68",
+		PluginBinaryURI: "https://example.com/plugin/v0.3.8",
+		Platform:        types.Platform{OS: "windows", Arch: "amd64"},
+		Prebaked:        true,
+	}
+	s := cloudinit.Windows(params)
+	before(t, s, `if ((Test-Path "C:\Program Files\lite-engine\lite-engine.exe") -and ((Get-Content "C:\Program Files\lite-engine\lite-engine.exe.version" -ErrorAction SilentlyContinue) -eq "v0.5.68"))`, "lite-engine-windows-amd64.exe")
+	before(t, s, `Set-Content -Path "C:\Program Files\lite-engine\plugin.exe.version" -Value "v0.3.8" }`, "Start-Process")
+}
+
+// TestLinux_PrebakedMarker runs the rendered download of the lite engine,
+// which must only write the version file of a binary it downloaded.
+func TestLinux_PrebakedMarker(t *testing.T) {
+	for _, osName := range []string{"ubuntu", "amazon-linux"} {
+		s := cloudinit.Linux(&cloudinit.Params{
+			LiteEnginePath: liteEnginePath + "/v0.5.68",
+			Platform:       types.Platform{OS: "linux", Arch: "amd64", OSName: osName},
+			Prebaked:       true,
+		})
+		var download string
+		for _, line := range strings.Split(s, "\n") {
+			if strings.Contains(line, "> /usr/bin/lite-engine.version") {
+				download = strings.TrimSuffix(strings.TrimPrefix(line, "- '"), "'")
+			}
+		}
+		if download == "" {
+			t.Fatalf("%s: want the download of the lite engine to write its version", osName)
+		}
+
+		for _, ok := range []bool{false, true} {
+			path := filepath.Join(t.TempDir(), "lite-engine")
+			script := strings.ReplaceAll(strings.ReplaceAll(download, "/usr/bin/wget", "wget"), "/usr/bin/lite-engine", path)
+			script = fmt.Sprintf("wget() { %t; }\n%s", ok, script)
+			_ = exec.Command("bash", "-c", script).Run()
+			version, err := os.ReadFile(path + ".version")
+			switch {
+			case ok && strings.TrimSpace(string(version)) != "v0.5.68":
+				t.Errorf("%s: want the version written after a download, got %q, %v", osName, version, err)
+			case !ok && err == nil:
+				t.Errorf("%s: want no version written after a failed download", osName)
+			}
+		}
+	}
+}
+
+// TestInstalled runs the rendered check of a prebaked binary.
+func TestInstalled(t *testing.T) {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum not found")
+	}
+	path := filepath.Join(t.TempDir(), "lite-engine")
+	content := []byte("lite engine")
+	sum := sha256.Sum256(content)
+	if err := os.WriteFile(path, content, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(checksum string) string {
+		script, err := cloudinit.Custom(`{{ installed .LiteEngineChecksum .LiteEngineVersion "`+path+`" }} || echo downloading`, &cloudinit.Params{
+			LiteEnginePath: liteEnginePath + "/v0.5.68",
+			Platform:       types.Platform{OS: "linux", Arch: "amd64"},
+			Checksums:      map[string]string{"lite-engine-linux-amd64": checksum},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := exec.Command("bash", "-c", script).CombinedOutput()
+		return string(out)
+	}
+
+	if out := run(hex.EncodeToString(sum[:])); !strings.Contains(out, "using the prebaked") {
+		t.Errorf("want the binary to be used with a matching checksum, got %q", out)
+	}
+	if out := run(leChecksum); !strings.Contains(out, "downloading") {
+		t.Errorf("want the binary to be downloaded with a mismatching checksum, got %q", out)
+	}
+	if out := run(""); !strings.Contains(out, "downloading") {
+		t.Errorf("want the binary to be downloaded without a version file, got %q", out)
+	}
+	if err := os.WriteFile(path+".version", []byte("v0.5.68\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if out := run(""); !strings.Contains(out, "using the prebaked") {
+		t.Errorf("want the binary to be used with a matching version, got %q", out)
+	}
+}
+
+var network = types.Network{
+	Proxy:    "http://proxy.example.com:3128",
+	NoProxy:  []string{"169.254.169.254", ".internal"},
+	CABundle: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+	Mirrors: types.Mirrors{
+		Registries: []string{"https://mirror.example.com"},
+		Apt:        "http://apt.example.com/ubuntu",
+		Docker:     "http://apt.example.com/docker/",
+		GitHub:     "https://github.example.com",
+	},
+}
+
+func TestLinux_Network(t *testing.T) {
+	params := &cloudinit.Params{
+		LiteEnginePath: liteEnginePath,
+		Platform:       types.Platform{OS: "linux", Arch: "amd64", OSName: "ubuntu"},
+		Network:        network,
+	}
+	s := cloudinit.Linux(params)
+	var config struct {
+		CACerts struct {
+			Trusted []string `yaml:"trusted"`
+		} `yaml:"ca_certs"`
+		Apt struct {
+			HTTPProxy string `yaml:"http_proxy"`
+			Primary   []struct {
+				URI string `yaml:"uri"`
+			} `yaml:"primary"`
+			Sources map[string]struct {
+				Source string `yaml:"source"`
+				KeyID  string `yaml:"keyid"`
+			} `yaml:"sources"`
+		} `yaml:"apt"`
+		WriteFiles []struct {
+			Path    string `yaml:"path"`
+			Content string `yaml:"content"`
+		} `yaml:"write_files"`
+		Runcmd []string `yaml:"runcmd"`
+	}
+	if err := yaml.Unmarshal([]byte(s), &config); err != nil {
+		t.Fatalf("invalid cloud-config: %s\n%s", err, s)
+	}
+	if len(config.CACerts.Trusted) != 1 || config.CACerts.Trusted[0] != network.CABundle {
+		t.Errorf("want the CA bundle to be trusted, got %q", config.CACerts.Trusted)
+	}
+	if config.Apt.HTTPProxy != network.Proxy {
+		t.Errorf("want apt to use the proxy, got %q", config.Apt.HTTPProxy)
+	}
+	if len(config.Apt.Primary) != 1 || config.Apt.Primary[0].URI != network.Mirrors.Apt {
+		t.Errorf("want the apt mirror, got %v", config.Apt.Primary)
+	}
+	if docker := config.Apt.Sources["docker.list"]; docker.Source != "deb [arch=amd64] http://apt.example.com/docker $RELEASE stable" || docker.KeyID == "" {
+		t.Errorf("want the docker mirror, got %v", docker)
+	}
+	paths := map[string]string{}
+	for _, f := range config.WriteFiles {
+		paths[f.Path] = f.Content
+	}
+	if _, ok := paths["/etc/systemd/system/docker.service.d/http-proxy.conf"]; !ok {
+		t.Errorf("want the docker daemon to use the proxy")
+	}
+	if _, ok := paths["/etc/docker/daemon.json"]; !ok {
+		t.Errorf("want the docker daemon to use the registry mirror")
+	}
+	before(t, s, "export HTTPS_PROXY=http://proxy.example.com:3128 https_proxy=", "lite-engine-linux-amd64")
+	before(t, s, `echo "NO_PROXY=169.254.169.254,.internal" >> /etc/environment`, `cp "/etc/environment" /root/.env`)
+	before(t, s, "https://github.example.com/bitrise-io/envman", "lite-engine server")
+
+	params.Platform.OSName = "amazon-linux"
+	s = cloudinit.Linux(params)
+	if err := yaml.Unmarshal([]byte(s), &config); err != nil {
+		t.Fatalf("invalid cloud-config: %s\n%s", err, s)
+	}
+	before(t, s, `echo "proxy=http://proxy.example.com:3128" >> /etc/yum.conf`, "packages:")
+	before(t, s, "update-ca-trust extract", "packages:")
+
+	params.Platform.OSName = "ubuntu"
+	params.Network = types.Network{}
+	s = cloudinit.Linux(params)
+	for _, unexpected := range []string{"ca_certs", "proxy", "daemon.json", "primary"} {
+		if strings.Contains(s, unexpected) {
+			t.Errorf("want no %s without a network configuration", unexpected)
+		}
+	}
+	if !strings.Contains(s, "https://download.docker.com/linux/ubuntu") || !strings.Contains(s, "https://github.com/bitrise-io/envman") {
+		t.Errorf("want the public sources without mirrors")
+	}
+}
+
+func TestLinuxBash_Network(t *testing.T) {
+	s := cloudinit.LinuxBash(&cloudinit.Params{
+		LiteEnginePath: liteEnginePath,
+		Platform:       types.Platform{OS: "linux", Arch: "amd64"},
+		Network:        network,
+	})
+	before(t, s, "update-ca-certificates", "/usr/bin/wget")
+	before(t, s, "export HTTP_PROXY=http://proxy.example.com:3128 http_proxy=", "/usr/bin/wget")
+	before(t, s, "/etc/systemd/system/docker.service.d/http-proxy.conf", "service docker start")
+	before(t, s, "/etc/docker/daemon.json", "service docker start")
+}
+
+func TestMac_Network(t *testing.T) {
+	s := cloudinit.Mac(&cloudinit.Params{
+		LiteEnginePath: liteEnginePath,
+		Platform:       types.Platform{OS: "darwin", Arch: "arm64"},
+		Network:        network,
+	})
+	before(t, s, "security add-trusted-cert", "wget")
+	before(t, s, "export HTTPS_PROXY=http://proxy.example.com:3128", "wget")
+	before(t, s, `echo "HTTPS_PROXY=http://proxy.example.com:3128" >> $HOME/.env`, "lite-engine server")
+}
+
+func TestWindows_Network(t *testing.T) {
+	s := cloudinit.Windows(&cloudinit.Params{
+		LiteEnginePath: liteEnginePath,
+		Platform:       types.Platform{OS: "windows", Arch: "amd64"},
+		Network:        network,
+	})
+	before(t, s, `Import-Certificate -FilePath $cert -CertStoreLocation Cert:\LocalMachine\Root`, "Installing Scoop")
+	before(t, s, `[System.Net.WebRequest]::DefaultWebProxy = New-Object System.Net.WebProxy("http://proxy.example.com:3128", $true, $bypass)`, "Installing Scoop")
+	before(t, s, `Add-Content -Path "C:\Program Files\lite-engine\.env" -Value "HTTP_PROXY=http://proxy.example.com:3128"`, "Start-Process")
+	before(t, s, `C:\ProgramData\docker\config\daemon.json`, "Start-Process")
+}
+
+func TestIgnition(t *testing.T) {
+	tests := map[string]*cloudinit.Params{
+		"testdata/ignition.json": {
+			LiteEnginePath:     "https://github.com/harness/lite-engine/releases/download/v0.5.68",
+			LiteEngineLogsPath: "/var/log/lite-engine.log",
+			CACert:             caCertFile + "\n",
+			TLSCert:            certFile + "\n",
+			TLSKey:             keyFile + "\n",
+			PluginBinaryURI:    "https://github.com/drone/plugin/releases/download/v0.3.8-beta",
+			Platform:           types.Platform{OS: "linux", Arch: "amd64"},
+			Checksums:          checksums("linux", "amd64"),
+		},
+		"testdata/ignition_network.json": {
+			LiteEnginePath:       "https://github.com/harness/lite-engine/releases/download/v0.5.68",
+			LiteEngineLogsPath:   "/var/log/lite-engine.log",
+			CACert:               caCertFile + "\n",
+			TLSCert:              certFile + "\n",
+			TLSKey:               keyFile + "\n",
+			HarnessTestBinaryURI: "https://app.harness.io/storage/harness-download/harness-ti/split_tests",
+			Platform:             types.Platform{OS: "linux", Arch: "arm64"},
+			Network:              network,
+		},
+	}
+	for golden, params := range tests {
+		got, err := cloudinit.Ignition(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(strings.TrimSpace(string(want)), got); diff != "" {
+			t.Errorf("%s: unexpected ignition config (-want +got):\n%s", golden, diff)
+		}
+	}
+
+	_, err := cloudinit.Ignition(&cloudinit.Params{LiteEnginePath: liteEnginePath, Platform: types.Platform{OS: "linux", Arch: "amd64"}})
+	if err == nil || !strings.Contains(err.Error(), "absolute url") {
+		t.Errorf("want an error for a relative lite engine path, got %v", err)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	userdata, err := cloudinit.Multipart("#cloud-config\nruncmd: []\n",
+		types.UserDataPart{Content: "#!/bin/bash\necho hello\n"},
+		types.UserDataPart{ContentType: "text/x-include-url", Content: "https://example.com/userdata\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(userdata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("want a multipart/mixed message, got %q: %v", mediaType, err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	want := []struct{ contentType, content string }{
+		{"text/cloud-config", "#cloud-config\nruncmd: []\n"},
+		{"text/x-shellscript", "#!/bin/bash\necho hello\n"},
+		{"text/x-include-url", "https://example.com/userdata\n"},
+	}
+	for _, w := range want {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(part)
+		if got := part.Header.Get("Content-Type"); !strings.HasPrefix(got, w.contentType+";") {
+			t.Errorf("want content type %s, got %s", w.contentType, got)
+		}
+		if string(content) != w.content {
+			t.Errorf("want content %q, got %q", w.content, content)
+		}
+	}
+	if _, err = r.NextPart(); err != io.EOF {
+		t.Errorf("want 3 parts, got more: %v", err)
+	}
+
+	if _, err = cloudinit.Multipart("#cloud-config\n", types.UserDataPart{Content: "plain text"}); err == nil {
+		t.Errorf("want an error for a part of unknown content type")
+	}
+}
+
+func TestGzip(t *testing.T) {
+	userdata := cloudinit.Linux(&cloudinit.Params{LiteEnginePath: liteEnginePath, Platform: types.Platform{OS: "linux", Arch: "amd64"}})
+	compressed, err := cloudinit.Gzip(userdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(userdata) {
+		t.Errorf("want the userdata to be compressed, got %d bytes from %d", len(compressed), len(userdata))
+	}
+	r, err := gzip.NewReader(strings.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != userdata {
+		t.Errorf("want the decompressed userdata to match")
+	}
+}
+
+func TestLoadChecksums(t *testing.T) {
+	file := "# lite engine v0.5.68\n" +
+		strings.ToUpper(leChecksum) + "  lite-engine-linux-amd64\n" +
+		pluginChecksum + " *dist/plugin-linux-amd64\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checksums.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(file))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "checksums.txt")
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range []string{srv.URL + "/checksums.txt", path} {
+		got, err := cloudinit.LoadChecksums(context.Background(), map[string]string{"plugin-linux-amd64": splitChecksum}, location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"lite-engine-linux-amd64": leChecksum, "plugin-linux-amd64": splitChecksum}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %v, got %v", location, want, got)
+		}
+	}
+
+	if _, err := cloudinit.LoadChecksums(context.Background(), nil, srv.URL+"/missing.txt"); err == nil {
+		t.Errorf("want an error for a missing checksums file")
+	}
+	if _, err := cloudinit.LoadChecksums(context.Background(), map[string]string{"plugin-linux-amd64": "abc"}, ""); err == nil {
+		t.Errorf("want an error for an invalid checksum")
+	}
+	if _, err := cloudinit.ParseChecksums([]byte("abc  lite-engine-linux-amd64")); err == nil {
+		t.Errorf("want an error for an invalid checksums file")
+	}
+}
@@ -0,0 +1,236 @@
+package cloudinit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Userdata formats of the built-in templates.
+const (
+	FormatCloudInit = "cloud-init"
+	FormatIgnition  = "ignition"
+)
+
+const (
+	ignitionVersion = "3.3.0"
+	ignitionBinDir  = "/opt/bin"
+	ignitionCertDir = "/etc/drone/certs"
+	ignitionEnvFile = "/etc/drone/lite-engine.env"
+)
+
+// The subset of the Ignition v3.3.0 config used by the runner, see
+// https://coreos.github.io/ignition/configuration-v3_3/
+type (
+	ignitionConfig struct {
+		Ignition ignitionMeta    `json:"ignition"`
+		Storage  ignitionStorage `json:"storage,omitempty"`
+		Systemd  ignitionSystemd `json:"systemd,omitempty"`
+	}
+
+	ignitionMeta struct {
+		Version  string            `json:"version"`
+		Proxy    *ignitionProxy    `json:"proxy,omitempty"`
+		Security *ignitionSecurity `json:"security,omitempty"`
+	}
+
+	ignitionProxy struct {
+		HTTPProxy  string   `json:"httpProxy,omitempty"`
+		HTTPSProxy string   `json:"httpsProxy,omitempty"`
+		NoProxy    []string `json:"noProxy,omitempty"`
+	}
+
+	ignitionSecurity struct {
+		TLS ignitionTLS `json:"tls"`
+	}
+
+	ignitionTLS struct {
+		CertificateAuthorities []ignitionResource `json:"certificateAuthorities"`
+	}
+
+	ignitionStorage struct {
+		Files []ignitionFile `json:"files,omitempty"`
+	}
+
+	ignitionFile struct {
+		Path      string           `json:"path"`
+		Mode      int              `json:"mode"`
+		Overwrite bool             `json:"overwrite"`
+		Contents  ignitionResource `json:"contents"`
+	}
+
+	ignitionResource struct {
+		Source       string                `json:"source"`
+		Verification *ignitionVerification `json:"verification,omitempty"`
+	}
+
+	ignitionVerification struct {
+		Hash string `json:"hash"`
+	}
+
+	ignitionSystemd struct {
+		Units []ignitionUnit `json:"units,omitempty"`
+	}
+
+	ignitionUnit struct {
+		Name     string           `json:"name"`
+		Enabled  *bool            `json:"enabled,omitempty"`
+		Contents string           `json:"contents,omitempty"`
+		Dropins  []ignitionDropin `json:"dropins,omitempty"`
+	}
+
+	ignitionDropin struct {
+		Name     string `json:"name"`
+		Contents string `json:"contents"`
+	}
+)
+
+const liteEngineUnit = `[Unit]
+Description=Drone lite engine
+Wants=network-online.target docker.service
+After=network-online.target docker.service
+
+[Service]
+ExecStart=%s server --env-file %s
+StandardOutput=append:%s
+StandardError=inherit
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Ignition creates an Ignition config for Linux distributions provisioned
+// with Ignition, such as Fedora CoreOS and Flatcar. Their /usr is read-only,
+// so the binaries are installed to /opt/bin, and the certificates are kept
+// in /etc/drone/certs. The lite engine runs as a systemd unit. Binaries are
+// always downloaded, by Ignition itself, which verifies their checksums.
+func Ignition(params *Params) (payload string, err error) {
+	p := *params
+	config := ignitionConfig{Ignition: ignitionMeta{Version: ignitionVersion}}
+
+	if env := p.ProxyEnvironment(); env != nil {
+		config.Ignition.Proxy = &ignitionProxy{
+			HTTPProxy:  env["HTTP_PROXY"],
+			HTTPSProxy: env["HTTPS_PROXY"],
+			NoProxy:    p.Network.NoProxy,
+		}
+	}
+	if p.Network.CABundle != "" {
+		// trusted by Ignition for the downloads, and by the instance.
+		config.Ignition.Security = &ignitionSecurity{TLS: ignitionTLS{
+			CertificateAuthorities: []ignitionResource{{Source: dataURL(p.Network.CABundle)}},
+		}}
+	}
+
+	files := []ignitionFile{
+		ignitionData(path.Join(ignitionCertDir, "ca-cert.pem"), 0600, p.CACert),
+		ignitionData(path.Join(ignitionCertDir, "server-cert.pem"), 0600, p.TLSCert),
+		ignitionData(path.Join(ignitionCertDir, "server-key.pem"), 0600, p.TLSKey),
+		ignitionData(ignitionEnvFile, 0600, p.liteEngineEnv()),
+	}
+
+	type binary struct {
+		name, source, checksum string
+	}
+	binaries := []binary{
+		{"lite-engine", fmt.Sprintf("%s/lite-engine-%s-%s", p.LiteEnginePath, p.Platform.OS, p.Platform.Arch), p.LiteEngineChecksum()},
+	}
+	if p.PluginBinaryURI != "" {
+		binaries = append(binaries, binary{"plugin", fmt.Sprintf("%s/plugin-%s-%s", p.PluginBinaryURI, p.Platform.OS, p.Platform.Arch), p.PluginChecksum()})
+	}
+	if p.HarnessTestBinaryURI != "" {
+		binaries = append(binaries, binary{"split_tests", fmt.Sprintf("%s/%s/%s/bin/split_tests-%s_%s",
+			p.HarnessTestBinaryURI, p.Platform.Arch, p.Platform.OS, p.Platform.OS, p.Platform.Arch), p.SplitTestsChecksum()})
+	}
+	if p.Platform.Arch == "amd64" {
+		binaries = append(binaries, binary{"envman", p.GitHub() + "/bitrise-io/envman/releases/download/2.4.2/envman-Linux-x86_64", ""})
+	}
+	for _, b := range binaries {
+		// Ignition only downloads from absolute URLs.
+		if u, err := url.Parse(b.source); err != nil || u.Scheme == "" {
+			return "", fmt.Errorf("ignition: %s must be downloaded from an absolute url, got %q", b.name, b.source)
+		}
+		file := ignitionFile{
+			Path:      path.Join(ignitionBinDir, b.name),
+			Mode:      0755,
+			Overwrite: true,
+			Contents:  ignitionResource{Source: b.source},
+		}
+		if b.checksum != "" {
+			file.Contents.Verification = &ignitionVerification{Hash: "sha256-" + b.checksum}
+		}
+		files = append(files, file)
+	}
+
+	if p.Network.CABundle != "" {
+		// Fedora CoreOS reads the anchors, Flatcar the certs.
+		files = append(files,
+			ignitionData("/etc/pki/ca-trust/source/anchors/drone-ca-bundle.pem", 0644, p.Network.CABundle),
+			ignitionData("/etc/ssl/certs/drone-ca-bundle.pem", 0644, p.Network.CABundle))
+	}
+	if daemon := p.DockerDaemonConfig(); daemon != "" {
+		files = append(files, ignitionData("/etc/docker/daemon.json", 0644, daemon))
+	}
+	config.Storage.Files = files
+
+	enabled := true
+	docker := ignitionUnit{Name: "docker.service", Enabled: &enabled}
+	if proxy := p.DockerProxyConfig(); proxy != "" {
+		docker.Dropins = []ignitionDropin{{Name: "http-proxy.conf", Contents: proxy}}
+	}
+	config.Systemd.Units = []ignitionUnit{
+		docker,
+		{
+			Name:     "lite-engine.service",
+			Enabled:  &enabled,
+			Contents: fmt.Sprintf(liteEngineUnit, path.Join(ignitionBinDir, "lite-engine"), ignitionEnvFile, p.LiteEngineLogsPath),
+		},
+	}
+
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("ignition: %w", err)
+	}
+	return string(b), nil
+}
+
+// liteEngineEnv returns the env file of the lite engine, which points it
+// to the certificates and passes the proxy.
+func (p Params) liteEngineEnv() string {
+	env := []string{
+		"SKIP_PREPARE_SERVER=true",
+		"SERVER_CERT_FILE=" + path.Join(ignitionCertDir, "server-cert.pem"),
+		"SERVER_KEY_FILE=" + path.Join(ignitionCertDir, "server-key.pem"),
+		"CLIENT_CERT_FILE=" + path.Join(ignitionCertDir, "ca-cert.pem"),
+		"PATH=" + ignitionBinDir + ":/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	}
+	proxy := p.ProxyEnvironment()
+	names := make([]string, 0, len(proxy))
+	for name := range proxy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+proxy[name], strings.ToLower(name)+"="+proxy[name])
+	}
+	return strings.Join(env, "\n") + "\n"
+}
+
+func ignitionData(name string, mode int, contents string) ignitionFile {
+	return ignitionFile{
+		Path:      name,
+		Mode:      mode,
+		Overwrite: true,
+		Contents:  ignitionResource{Source: dataURL(contents)},
+	}
+}
+
+func dataURL(contents string) string {
+	return "data:;base64," + base64.StdEncoding.EncodeToString([]byte(contents))
+}
@@ -0,0 +1,99 @@
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// multipartBoundary separates the parts. It is fixed, so that the userdata
+// of a pool only changes with its contents.
+const multipartBoundary = "==drone-runner-userdata=="
+
+// contentTypes maps the first line of userdata to its cloud-init content
+// type, see https://cloudinit.readthedocs.io/en/latest/explanation/format.html
+var contentTypes = []struct {
+	prefix, contentType string
+}{
+	{"#cloud-config-archive", "text/cloud-config-archive"},
+	{"#cloud-config", "text/cloud-config"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#include", "text/x-include-url"},
+	{"#part-handler", "text/part-handler"},
+	{"## template: jinja", "text/jinja2"},
+	{"#!", "text/x-shellscript"},
+}
+
+// ContentType returns the cloud-init content type of userdata, detected
+// from its first line, or an empty string if it is unknown.
+func ContentType(userdata string) string {
+	userdata = strings.TrimLeft(userdata, " \t\r\n")
+	for _, t := range contentTypes {
+		if strings.HasPrefix(userdata, t.prefix) {
+			return t.contentType
+		}
+	}
+	return ""
+}
+
+// Multipart combines the userdata of the runner with the parts in a
+// multipart MIME message, which cloud-init merges. The userdata of the runner
+// is the first part.
+func Multipart(userdata string, parts ...types.UserDataPart) (string, error) {
+	all := append([]types.UserDataPart{{Content: userdata}}, parts...)
+
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	if err := w.SetBoundary(multipartBoundary); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", multipartBoundary)
+	for i, part := range all {
+		if strings.Contains(part.Content, multipartBoundary) {
+			return "", fmt.Errorf("userdata part %d contains the multipart boundary %s", i, multipartBoundary)
+		}
+		contentType := part.ContentType
+		if contentType == "" {
+			contentType = ContentType(part.Content)
+		}
+		if contentType == "" {
+			return "", fmt.Errorf("cannot detect the content type of userdata part %d, set its content_type", i)
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", contentType))
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"part-%03d\"", i+1))
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err = pw.Write([]byte(part.Content)); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Gzip compresses userdata. cloud-init detects and decompresses it.
+func Gzip(userdata string) (string, error) {
+	buf := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write([]byte(userdata)); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
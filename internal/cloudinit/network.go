@@ -0,0 +1,90 @@
+package cloudinit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	dockerRepository = "https://download.docker.com/linux/ubuntu"
+	dockerKeyID      = "9DC858229FC7DD38854AE2D88D81803C0EBFCD88"
+	githubURL        = "https://github.com"
+)
+
+// ProxyEnvironment returns the proxy environment variables of the instance,
+// keyed by their upper case names. The templates set the lower case ones as
+// well since tools disagree on which they read.
+func (p Params) ProxyEnvironment() map[string]string {
+	if p.Network.Proxy == "" {
+		return nil
+	}
+	env := map[string]string{
+		"HTTP_PROXY":  p.Network.Proxy,
+		"HTTPS_PROXY": p.Network.Proxy,
+	}
+	if len(p.Network.NoProxy) != 0 {
+		env["NO_PROXY"] = strings.Join(p.Network.NoProxy, ",")
+	}
+	return env
+}
+
+// DockerRepository returns the Docker apt repository.
+func (p Params) DockerRepository() string {
+	if p.Network.Mirrors.Docker != "" {
+		return strings.TrimSuffix(p.Network.Mirrors.Docker, "/")
+	}
+	return dockerRepository
+}
+
+// DockerKeyID returns the id of the key the Docker apt repository is signed
+// with.
+func (p Params) DockerKeyID() string {
+	return dockerKeyID
+}
+
+// GitHub returns the URL GitHub releases are downloaded from.
+func (p Params) GitHub() string {
+	if p.Network.Mirrors.GitHub != "" {
+		return strings.TrimSuffix(p.Network.Mirrors.GitHub, "/")
+	}
+	return githubURL
+}
+
+// DockerDaemonConfig returns the daemon.json configuring the registry
+// mirrors, or an empty string if there are none.
+func (p Params) DockerDaemonConfig() string {
+	if len(p.Network.Mirrors.Registries) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(map[string][]string{"registry-mirrors": p.Network.Mirrors.Registries})
+	return string(b) + "\n"
+}
+
+// DockerProxyConfig returns the systemd drop-in passing the proxy to the
+// Docker daemon, or an empty string if there is no proxy.
+func (p Params) DockerProxyConfig() string {
+	env := p.ProxyEnvironment()
+	if env == nil {
+		return ""
+	}
+	sb := &strings.Builder{}
+	sb.WriteString("[Service]\n")
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if value, ok := env[name]; ok {
+			fmt.Fprintf(sb, "Environment=\"%s=%s\"\n", name, value)
+		}
+	}
+	return sb.String()
+}
+
+// indent indents every line of s by the number of spaces, to embed it in a
+// YAML block scalar.
+func indent(spaces int, s string) string {
+	prefix := strings.Repeat(" ", spaces)
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
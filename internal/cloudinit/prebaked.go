@@ -0,0 +1,52 @@
+package cloudinit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LiteEngineVersion returns the version of the lite engine, the last element
+// of LiteEnginePath, e.g. v0.5.68. In prebaked mode it is written next to the
+// downloaded binary, and the binary of the image is used if it matches.
+func (p Params) LiteEngineVersion() string {
+	return lastElement(p.LiteEnginePath)
+}
+
+// PluginVersion returns the version of the plugin binary, the last element
+// of PluginBinaryURI.
+func (p Params) PluginVersion() string {
+	return lastElement(p.PluginBinaryURI)
+}
+
+func lastElement(uri string) string {
+	uri = strings.TrimRight(uri, "/")
+	return uri[strings.LastIndex(uri, "/")+1:]
+}
+
+// installedLinux returns a command that succeeds if the binary at path is
+// the expected one: its checksum matches if known, otherwise the version
+// written next to it does.
+func installedLinux(checksum, version, path string) string {
+	return installedShell("sha256sum -c --status -", checksum, version, path)
+}
+
+// installedMac is installedLinux for macOS.
+func installedMac(checksum, version, path string) string {
+	return installedShell("shasum -a 256 -c -s -", checksum, version, path)
+}
+
+func installedShell(command, checksum, version, path string) string {
+	check := fmt.Sprintf(`[ -x %s ] && [ "$(cat %s.version 2>/dev/null)" = "%s" ]`, path, path, version)
+	if checksum != "" {
+		check = fmt.Sprintf(`[ -x %s ] && echo "%s  %s" | %s 2>/dev/null`, path, checksum, path, command)
+	}
+	return fmt.Sprintf(`{ %s && echo "[DRONE] using the prebaked %s %s"; }`, check, path, version)
+}
+
+// installedWindows is installedLinux for PowerShell, it returns a condition.
+func installedWindows(checksum, version, path string) string {
+	if checksum != "" {
+		return fmt.Sprintf(`(Test-Path "%s") -and ((Get-FileHash -Algorithm SHA256 -Path "%s").Hash -eq "%s")`, path, path, checksum)
+	}
+	return fmt.Sprintf(`(Test-Path "%s") -and ((Get-Content "%s.version" -ErrorAction SilentlyContinue) -eq "%s")`, path, path, version)
+}
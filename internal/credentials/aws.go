@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// AssumeRole returns a provider of temporary AWS credentials for a role,
+// assumed with the default credentials of the runner, e.g. its instance profile.
+func AssumeRole(region, roleARN, externalID, sessionName string) (Provider, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, err
+	}
+	return fromAWS(stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+		if sessionName != "" {
+			p.RoleSessionName = sessionName
+		}
+	})), nil
+}
+
+// WebIdentity returns a provider of temporary AWS credentials for a role,
+// assumed with the web identity token in tokenFile, e.g. a Kubernetes
+// service account token.
+func WebIdentity(region, roleARN, sessionName, tokenFile string) (Provider, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, err
+	}
+	return fromAWS(stscreds.NewWebIdentityCredentials(sess, roleARN, sessionName, tokenFile)), nil
+}
+
+// fromAWS adapts AWS credentials. They are retrieved again on every call,
+// caching is left to Cache.
+func fromAWS(creds *awscredentials.Credentials) Provider {
+	return ProviderFunc(func(ctx context.Context) (*Credentials, error) {
+		creds.Expire()
+		v, err := creds.GetWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("credentials: %w", err)
+		}
+		out := &Credentials{Values: map[string]string{
+			AccessKeyID:     v.AccessKeyID,
+			AccessKeySecret: v.SecretAccessKey,
+			SessionToken:    v.SessionToken,
+		}}
+		if expires, err := creds.ExpiresAt(); err == nil {
+			out.Expires = expires
+		}
+		return out, nil
+	})
+}
@@ -0,0 +1,161 @@
+// Package credentials reads the secret values of driver accounts from
+// sources other than the pool file and refreshes them before they expire,
+// so that short-lived credentials can be used without restarting the runner.
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Keys of the credentials used by the drivers.
+const (
+	AccessKeyID     = "access_key_id"
+	AccessKeySecret = "access_key_secret"
+	SessionToken    = "session_token"
+	ClientSecret    = "client_secret"
+	PAT             = "pat"
+)
+
+// expiryWindow is how long before they expire credentials are refreshed.
+const expiryWindow = 5 * time.Minute
+
+// Credentials is a set of secret values keyed by name.
+type Credentials struct {
+	Values map[string]string
+	// Expires is when the credentials stop being valid, zero if they do not expire.
+	Expires time.Time
+}
+
+// Get returns the value of a credential, or an empty string.
+func (c *Credentials) Get(key string) string {
+	if c == nil {
+		return ""
+	}
+	return c.Values[key]
+}
+
+// Provider retrieves credentials from a source.
+type Provider interface {
+	Retrieve(ctx context.Context) (*Credentials, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ctx context.Context) (*Credentials, error)
+
+// Retrieve calls f(ctx).
+func (f ProviderFunc) Retrieve(ctx context.Context) (*Credentials, error) {
+	return f(ctx)
+}
+
+// Static returns a provider of fixed credentials.
+func Static(values map[string]string) Provider {
+	return ProviderFunc(func(context.Context) (*Credentials, error) {
+		return &Credentials{Values: values}, nil
+	})
+}
+
+// Required returns a provider that fails if any of the keys is missing from
+// the credentials returned by p.
+func Required(p Provider, keys ...string) Provider {
+	return ProviderFunc(func(ctx context.Context) (*Credentials, error) {
+		c, err := p.Retrieve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if c.Get(key) == "" {
+				return nil, fmt.Errorf("credentials: %s not found", key)
+			}
+		}
+		return c, nil
+	})
+}
+
+// Cache is a Provider that keeps the credentials of another provider until
+// they are about to expire. Credentials without an expiry are retrieved again
+// once the refresh interval has passed, so that rotated files and secrets are
+// picked up. If a refresh fails the cached credentials are used until they
+// expire.
+type Cache struct {
+	provider Provider
+	interval time.Duration
+
+	mu      sync.Mutex
+	creds   *Credentials
+	fetched time.Time
+	now     func() time.Time
+}
+
+// NewCache returns a Cache of the credentials of p. An interval of zero
+// retrieves credentials without an expiry only once.
+func NewCache(p Provider, interval time.Duration) *Cache {
+	return &Cache{provider: p, interval: interval, now: time.Now}
+}
+
+// Retrieve returns the cached credentials, refreshing them if needed.
+func (c *Cache) Retrieve(ctx context.Context) (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.creds != nil && !c.stale(now) {
+		return c.creds, nil
+	}
+	creds, err := c.provider.Retrieve(ctx)
+	if err != nil {
+		if c.creds != nil && (c.creds.Expires.IsZero() || now.Before(c.creds.Expires)) {
+			logrus.WithError(err).Warnln("credentials: unable to refresh, using the cached credentials")
+			return c.creds, nil
+		}
+		return nil, err
+	}
+	c.creds, c.fetched = creds, now
+	return creds, nil
+}
+
+// Get returns the current value of a credential.
+func (c *Cache) Get(ctx context.Context, key string) (string, error) {
+	creds, err := c.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return creds.Get(key), nil
+}
+
+// Stale reports whether the next Retrieve is going to refresh the credentials.
+func (c *Cache) Stale() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.creds == nil || c.stale(c.now())
+}
+
+// RefreshAt returns when the cached credentials are going to be refreshed,
+// zero if never.
+func (c *Cache) RefreshAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshAt()
+}
+
+func (c *Cache) stale(now time.Time) bool {
+	at := c.refreshAt()
+	return !at.IsZero() && !now.Before(at)
+}
+
+func (c *Cache) refreshAt() time.Time {
+	if c.creds == nil {
+		return time.Time{}
+	}
+	if !c.creds.Expires.IsZero() {
+		return c.creds.Expires.Add(-expiryWindow)
+	}
+	if c.interval > 0 {
+		return c.fetched.Add(c.interval)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,142 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	var fail bool
+	p := ProviderFunc(func(context.Context) (*Credentials, error) {
+		calls++
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return &Credentials{Values: map[string]string{PAT: "token"}, Expires: now.Add(time.Hour)}, nil
+	})
+	c := NewCache(p, 0)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get(ctx, PAT); err != nil || v != "token" {
+			t.Fatalf("want token, got %q, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("want credentials to be cached, got %d calls", calls)
+	}
+
+	// refreshed within the expiry window
+	now = now.Add(time.Hour - expiryWindow)
+	if !c.Stale() {
+		t.Errorf("want credentials to be stale within the expiry window")
+	}
+	fail = true
+	if _, err := c.Retrieve(ctx); err != nil {
+		t.Errorf("want cached credentials while they are valid, got %v", err)
+	}
+	now = now.Add(expiryWindow)
+	if _, err := c.Retrieve(ctx); err == nil {
+		t.Errorf("want an error once the cached credentials expired")
+	}
+	fail = false
+	if _, err := c.Retrieve(ctx); err != nil || calls != 4 {
+		t.Errorf("want credentials to be refreshed, got %d calls, %v", calls, err)
+	}
+}
+
+func TestCache_Interval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pat")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first\n")
+
+	now := time.Now()
+	c := NewCache(File(path, PAT), time.Minute)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if v, _ := c.Get(ctx, PAT); v != "first" {
+		t.Errorf("want first, got %q", v)
+	}
+	write("second\n")
+	if v, _ := c.Get(ctx, PAT); v != "first" {
+		t.Errorf("want first until the refresh interval passed, got %q", v)
+	}
+	now = now.Add(time.Minute)
+	if v, _ := c.Get(ctx, PAT); v != "second" {
+		t.Errorf("want second, got %q", v)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aws.yml")
+	if err := os.WriteFile(path, []byte("access_key_id: id\naccess_key_secret: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Required(File(path, ""), AccessKeyID, AccessKeySecret).Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Get(AccessKeyID) != "id" || c.Get(AccessKeySecret) != "secret" {
+		t.Errorf("unexpected credentials %v", c.Values)
+	}
+	if _, err := Required(File(path, ""), SessionToken).Retrieve(context.Background()); err == nil {
+		t.Errorf("want an error for a missing required credential")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("TEST_CLIENT_SECRET", "secret")
+	c, err := Env(map[string]string{ClientSecret: "TEST_CLIENT_SECRET", PAT: "TEST_UNSET"}).Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Get(ClientSecret) != "secret" || c.Get(PAT) != "" {
+		t.Errorf("unexpected credentials %v", c.Values)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Path string `json:"path"`
+			Name string `json:"name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Path != "ci/digitalocean" || req.Name != "do_token" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"name": req.Name, "data": "token"})
+	}))
+	defer srv.Close()
+
+	p := HTTP(srv.URL, "plugin-secret", false, "ci/digitalocean", map[string]string{PAT: "do_token"})
+	c, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Get(PAT) != "token" {
+		t.Errorf("want token, got %v", c.Values)
+	}
+
+	p = HTTP(srv.URL, "plugin-secret", false, "ci/other", map[string]string{PAT: "do_token"})
+	if _, err := p.Retrieve(context.Background()); err == nil {
+		t.Errorf("want an error for an unknown secret")
+	}
+}
@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-go/plugin/secret"
+
+	"github.com/ghodss/yaml"
+)
+
+// File returns a provider reading credentials from a file, which is read
+// again on every refresh. If key is set the file holds just the value of that
+// credential, otherwise it is a YAML or JSON object of credentials.
+func File(path, key string) Provider {
+	return ProviderFunc(func(context.Context) (*Credentials, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("credentials: %w", err)
+		}
+		if key != "" {
+			return &Credentials{Values: map[string]string{key: strings.TrimRight(string(b), "\r\n")}}, nil
+		}
+		values := map[string]string{}
+		if err := yaml.Unmarshal(b, &values); err != nil {
+			return nil, fmt.Errorf("credentials: unable to parse %s: %w", path, err)
+		}
+		return &Credentials{Values: values}, nil
+	})
+}
+
+// Env returns a provider reading credentials from environment variables.
+// names maps each credential to the variable holding it.
+func Env(names map[string]string) Provider {
+	return ProviderFunc(func(context.Context) (*Credentials, error) {
+		values := map[string]string{}
+		for key, name := range names {
+			if v, ok := os.LookupEnv(name); ok {
+				values[key] = v
+			}
+		}
+		return &Credentials{Values: values}, nil
+	})
+}
+
+// HTTP returns a provider reading credentials from a secret plugin endpoint,
+// using the same protocol as DRONE_SECRET_PLUGIN_ENDPOINT. names maps each
+// credential to the name of the secret holding it, path is the secret path.
+func HTTP(endpoint, token string, skipVerify bool, path string, names map[string]string) Provider {
+	client := secret.Client(endpoint, token, skipVerify)
+	return ProviderFunc(func(ctx context.Context) (*Credentials, error) {
+		values := map[string]string{}
+		for key, name := range names {
+			res, err := client.Find(ctx, &secret.Request{Path: path, Name: name})
+			if err != nil {
+				return nil, fmt.Errorf("credentials: unable to find secret %s: %w", name, err)
+			}
+			if res != nil && res.Data != "" {
+				values[key] = res.Data
+			}
+		}
+		return &Credentials{Values: values}, nil
+	})
+}
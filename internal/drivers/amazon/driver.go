@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
@@ -33,6 +34,7 @@ type config struct {
 	accessKeyID     string
 	secretAccessKey string
 	sessionToken    string
+	credentials     *icredentials.Cache
 	keyPairName     string
 
 	rootDir string
@@ -59,8 +61,9 @@ type config struct {
 }
 
 const (
-	tagRetries      = 3
-	tagRetrySleepMs = 1000
+	tagRetries       = 3
+	tagRetrySleepMs  = 1000
+	terminateTimeout = time.Minute
 )
 
 func New(opts ...Option) (drivers.Driver, error) {
@@ -74,7 +77,9 @@ func New(opts ...Option) (drivers.Driver, error) {
 			Region:     aws.String(p.region),
 			MaxRetries: aws.Int(p.retries),
 		}
-		if p.accessKeyID != "" && p.secretAccessKey != "" {
+		if p.credentials != nil {
+			config.Credentials = credentials.NewCredentials(&credentialsProvider{cache: p.credentials})
+		} else if p.accessKeyID != "" && p.secretAccessKey != "" {
 			if p.sessionToken != "" {
 				config.Credentials = credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, p.sessionToken)
 			} else {
@@ -103,6 +108,20 @@ func (p *config) CanHibernate() bool {
 	return p.hibernate
 }
 
+// UserdataLimit returns the 16 KB limit of EC2 on the userdata, before
+// it is base64 encoded.
+func (p *config) UserdataLimit() int {
+	return 16 * 1024
+}
+
+// CanRetryCreate reports whether EC2 throttled the launch of the instance,
+// which rejects the call before the instance exists. The only error of the
+// API which Create returns as is comes from RunInstances.
+func (p *config) CanRetryCreate(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && request.IsErrorThrottle(awsErr)
+}
+
 const (
 	defaultSecurityGroupName = "harness-runner"
 )
@@ -198,6 +217,11 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		WithField("image", p.image).
 		WithField("size", p.size).
 		WithField("hibernate", p.CanHibernate())
+	userdata, err := lehelper.GenerateUserdata(p.userData, opts)
+	if err != nil {
+		logr.WithError(err).Errorln("amazon: failed to generate userdata")
+		return nil, err
+	}
 	var name = fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
 	var tags = map[string]string{
 		"Name": name,
@@ -217,14 +241,14 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		// lookup/create group
 		returnedGroupID, lookupErr := lookupCreateSecurityGroupID(ctx, client, p.vpc)
 		if lookupErr != nil {
-			return nil, lookupErr
+			return nil, itypes.NewProvisionError(itypes.ErrorClassConfig, lookupErr)
 		}
 		p.groups = append(p.groups, returnedGroupID)
 	}
 	// check the security group ingress rules
 	rulesErr := checkIngressRules(ctx, client, p.groups[0])
 	if rulesErr != nil {
-		return nil, rulesErr
+		return nil, itypes.NewProvisionError(itypes.ErrorClassConfig, rulesErr)
 	}
 
 	logr.Traceln("amazon: provisioning VM")
@@ -245,7 +269,7 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		IamInstanceProfile: iamProfile,
 		UserData: aws.String(
 			base64.StdEncoding.EncodeToString(
-				[]byte(lehelper.GenerateUserdata(p.userData, opts)),
+				[]byte(userdata),
 			),
 		),
 		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
@@ -304,7 +328,7 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 	if err != nil {
 		logr.WithError(err).
 			Errorln("amazon: [provision] failed to create VMs")
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	if len(runResult.Instances) == 0 {
@@ -323,6 +347,8 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 	var amazonInstance *ec2.Instance
 	amazonInstance, err = p.pollInstanceIPAddr(ctx, *awsInstanceID, logr)
 	if err != nil {
+		// no instance is returned, the one launched would leak if it was kept
+		p.terminate(ctx, *awsInstanceID, logr)
 		return nil, err
 	}
 
@@ -343,7 +369,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Platform:     opts.Platform,
 		Address:      instanceIP,
 		CACert:       opts.CACert,
-		CAKey:        opts.CAKey,
 		TLSCert:      opts.TLSCert,
 		TLSKey:       opts.TLSKey,
 		Started:      launchTime.Unix(),
@@ -503,7 +528,7 @@ func (p *config) Start(ctx context.Context, instanceID, poolName string) (string
 	if err != nil {
 		logr.WithError(err).
 			Errorln("aws: failed to start VMs")
-		return "", err
+		return "", classifyError(err)
 	}
 	logr.Traceln("amazon: VM started")
 
@@ -549,18 +574,28 @@ func (p *config) getLaunchTime(amazonInstance *ec2.Instance) time.Time {
 	return *amazonInstance.LaunchTime
 }
 
+// terminate terminates an instance which failed to provision. The call is
+// not canceled with the context of the creation, which may have ended.
+func (p *config) terminate(ctx context.Context, instanceID string, logr logger.Logger) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), terminateTimeout)
+	defer cancel()
+	input := &ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}
+	if _, err := p.service.TerminateInstancesWithContext(ctx, input); err != nil {
+		logr.WithError(err).Errorln("amazon: [provision] failed to terminate the instance")
+		return
+	}
+	logr.Debugln("amazon: [provision] terminated the instance")
+}
+
 func (p *config) pollInstanceIPAddr(ctx context.Context, instanceID string, logr logger.Logger) (*ec2.Instance, error) {
 	client := p.service
 	b := backoff.NewExponentialBackOff()
 	for {
 		duration := b.NextBackOff()
 		if duration == b.Stop {
-			logr.Errorln("amazon: [provision] failed to obtain IP; terminating it")
-
-			input := &ec2.TerminateInstancesInput{
-				InstanceIds: []*string{aws.String(instanceID)},
-			}
-			_, _ = client.TerminateInstancesWithContext(ctx, input)
+			logr.Errorln("amazon: [provision] failed to obtain IP")
 			return nil, errors.New("failed to obtain IP address")
 		}
 
@@ -0,0 +1,112 @@
+// Copyright 2020 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package amazon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ec2Server fakes the EC2 API calls of Create, the instances it launches
+// never get an address.
+type ec2Server struct {
+	mu         sync.Mutex
+	launched   []string
+	terminated []string
+}
+
+func (s *ec2Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch action := r.Form.Get("Action"); action {
+	case "DescribeSecurityGroups":
+		fmt.Fprintf(w, `<DescribeSecurityGroupsResponse><securityGroupInfo><item><groupId>sg-1</groupId><groupName>runner</groupName>`+
+			`<ipPermissions><item><ipProtocol>tcp</ipProtocol><fromPort>%d</fromPort><toPort>%d</toPort></item></ipPermissions>`+
+			`</item></securityGroupInfo></DescribeSecurityGroupsResponse>`, lehelper.LiteEnginePort, lehelper.LiteEnginePort)
+	case "RunInstances":
+		id := fmt.Sprintf("i-%d", len(s.launched)+1)
+		s.launched = append(s.launched, id)
+		fmt.Fprintf(w, `<RunInstancesResponse><instancesSet><item><instanceId>%s</instanceId></item></instancesSet></RunInstancesResponse>`, id)
+	case "DescribeInstances":
+		fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet/></DescribeInstancesResponse>`)
+	case "TerminateInstances":
+		s.terminated = append(s.terminated, r.Form.Get("InstanceId.1"))
+		fmt.Fprint(w, `<TerminateInstancesResponse/>`)
+	default:
+		http.Error(w, "unexpected action "+action, http.StatusBadRequest)
+	}
+}
+
+func TestCreate_TerminatesOnTimeout(t *testing.T) {
+	server := &ec2Server{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	p := &config{
+		region: "us-east-1",
+		groups: []string{"sg-1"},
+		service: ec2.New(session.Must(session.NewSession()), &aws.Config{
+			Endpoint:    aws.String(ts.URL),
+			Region:      aws.String("us-east-1"),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	opts := &types.InstanceCreateOpts{PoolName: "linux", Platform: types.Platform{OS: oshelp.OSLinux, Arch: oshelp.ArchAMD64}}
+
+	instance, err := p.Create(ctx, opts)
+	if err == nil {
+		t.Fatalf("want the creation to time out, got %v", instance)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.launched) != 1 {
+		t.Fatalf("want 1 instance launched, got %v", server.launched)
+	}
+	if len(server.terminated) != 1 || server.terminated[0] != server.launched[0] {
+		t.Errorf("want the launched instance %s terminated, got %v", server.launched[0], server.terminated)
+	}
+}
+
+func TestCanRetryCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "throttled", err: classifyError(awserr.New("RequestLimitExceeded", "", nil)), want: true},
+		{name: "server error", err: classifyError(awserr.New("InternalError", "", nil))},
+		{name: "capacity", err: classifyError(awserr.New("InsufficientInstanceCapacity", "", nil))},
+		{name: "timed out", err: context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := new(config).CanRetryCreate(test.err); got != test.want {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	"github.com/drone-runners/drone-runner-aws/types"
 
@@ -58,6 +59,14 @@ func WithSessionToken(sessionToken string) Option {
 	}
 }
 
+// WithCredentials sets a provider of the access key, secret and session
+// token, which takes precedence over the static credentials.
+func WithCredentials(cache *icredentials.Cache) Option {
+	return func(p *config) {
+		p.credentials = cache
+	}
+}
+
 // WithRootDirectory sets the root directory for the virtual machine.
 func WithRootDirectory(dir string) Option {
 	return func(p *config) {
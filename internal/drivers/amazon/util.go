@@ -5,9 +5,17 @@
 package amazon
 
 import (
+	"context"
+	"strings"
+
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
@@ -35,3 +43,57 @@ func tempdir(inputOS string) string {
 		return oshelp.JoinPaths(inputOS, "/tmp", dir)
 	}
 }
+
+// helper function annotates an EC2 API error with the class of the failure.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return itypes.NewProvisionError(errorClass(err), err)
+}
+
+func errorClass(err error) itypes.ErrorClass {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return itypes.ErrorClassUnknown
+	}
+	code := awsErr.Code()
+	switch {
+	case strings.HasPrefix(code, "Insufficient"):
+		return itypes.ErrorClassCapacity
+	case code == "InstanceLimitExceeded", code == "VcpuLimitExceeded",
+		code == "MaxSpotInstanceCountExceeded", code == "AddressLimitExceeded":
+		return itypes.ErrorClassQuota
+	case code == "AuthFailure", code == "UnauthorizedOperation", code == "InvalidClientTokenId",
+		code == "SignatureDoesNotMatch", code == "ExpiredToken", code == "RequestExpired", code == "OptInRequired":
+		return itypes.ErrorClassAuth
+	case request.IsErrorThrottle(err), request.IsErrorRetryable(err):
+		return itypes.ErrorClassTransient
+	case strings.HasPrefix(code, "Invalid"), code == "MissingParameter", code == "Unsupported":
+		return itypes.ErrorClassConfig
+	}
+	return itypes.ErrorClassUnknown
+}
+
+// credentialsProvider adapts a credentials cache to the AWS SDK, which asks
+// for new credentials whenever the cache is due for a refresh.
+type credentialsProvider struct {
+	cache *icredentials.Cache
+}
+
+func (p *credentialsProvider) Retrieve() (credentials.Value, error) {
+	c, err := p.cache.Retrieve(context.Background())
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	return credentials.Value{
+		AccessKeyID:     c.Get(icredentials.AccessKeyID),
+		SecretAccessKey: c.Get(icredentials.AccessKeySecret),
+		SessionToken:    c.Get(icredentials.SessionToken),
+		ProviderName:    "drone-runner-aws",
+	}, nil
+}
+
+func (p *credentialsProvider) IsExpired() bool {
+	return p.cache.Stale()
+}
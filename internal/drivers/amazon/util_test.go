@@ -5,9 +5,13 @@
 package amazon
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
 func Test_tempdir(t *testing.T) {
@@ -25,3 +29,23 @@ func Test_tempdir(t *testing.T) {
 		}
 	}
 }
+
+func Test_classifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class itypes.ErrorClass
+	}{
+		{err: awserr.New("InsufficientInstanceCapacity", "", nil), class: itypes.ErrorClassCapacity},
+		{err: awserr.New("VcpuLimitExceeded", "", nil), class: itypes.ErrorClassQuota},
+		{err: awserr.New("UnauthorizedOperation", "", nil), class: itypes.ErrorClassAuth},
+		{err: awserr.New("RequestLimitExceeded", "", nil), class: itypes.ErrorClassTransient},
+		{err: awserr.New("InvalidAMIID.NotFound", "", nil), class: itypes.ErrorClassConfig},
+		{err: errors.New("boom"), class: itypes.ErrorClassUnknown},
+	}
+
+	for _, test := range tests {
+		if got, want := itypes.ClassOf(classifyError(test.err)), test.class; got != want {
+			t.Errorf("Want class %s for %q, got %s", want, test.err, got)
+		}
+	}
+}
@@ -67,7 +67,10 @@ func (p *config) CanHibernate() bool {
 
 func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
 	startTime := time.Now()
-	uData := lehelper.GenerateUserdata(p.userData, opts)
+	uData, err := lehelper.GenerateUserdata(p.userData, opts)
+	if err != nil {
+		return nil, err
+	}
 	machineName := fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
 
 	logr := logger.FromContext(ctx).
@@ -159,7 +162,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Platform: opts.Platform,
 		Address:  ip,
 		CACert:   opts.CACert,
-		CAKey:    opts.CAKey,
 		TLSCert:  opts.TLSCert,
 		TLSKey:   opts.TLSKey,
 		Started:  startTime.Unix(),
@@ -51,7 +51,11 @@ func New(opts ...Option) (drivers.Driver, error) {
 
 func (c *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
 	startTime := time.Now()
-	uData := base64.StdEncoding.EncodeToString([]byte(lehelper.GenerateUserdata(c.userData, opts)))
+	userdata, err := lehelper.GenerateUserdata(c.userData, opts)
+	if err != nil {
+		return nil, err
+	}
+	uData := base64.StdEncoding.EncodeToString([]byte(userdata))
 	machineName := fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
 	logr := logger.FromContext(ctx).
 		WithField("cloud", types.AnkaBuild).
@@ -106,7 +110,6 @@ func (c *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Platform: opts.Platform,
 		Address:  inst.Vminfo.HostIP,
 		CACert:   opts.CACert,
-		CAKey:    opts.CAKey,
 		TLSCert:  opts.TLSCert,
 		TLSKey:   opts.TLSKey,
 		Started:  inst.TS.Unix(),
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
@@ -25,6 +26,7 @@ type config struct {
 	tenantID          string
 	clientID          string
 	clientSecret      string
+	credentials       *icredentials.Cache
 	subscriptionID    string
 	resourceGroupName string
 
@@ -61,17 +63,21 @@ func New(opts ...Option) (drivers.Driver, error) {
 		opt(p)
 	}
 
-	if p.tenantID == "" || p.clientID == "" || p.clientSecret == "" || p.subscriptionID == "" {
+	if p.tenantID == "" || p.clientID == "" || (p.clientSecret == "" && p.credentials == nil) || p.subscriptionID == "" {
 		return nil, errors.New("missing required azure account credentials (tenant_id, client_id, client_secret, subscription_id)")
 	}
 	if p.service == nil {
-		cred, err := azidentity.NewClientSecretCredential(p.tenantID, p.clientID, p.clientSecret, nil)
-		p.cred = cred
-		if err != nil {
-			return nil, err
+		var err error
+		if p.credentials != nil {
+			p.cred = &secretCredential{tenantID: p.tenantID, clientID: p.clientID, cache: p.credentials}
+		} else {
+			p.cred, err = azidentity.NewClientSecretCredential(p.tenantID, p.clientID, p.clientSecret, nil)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		p.service, err = armcompute.NewVirtualMachinesClient(p.subscriptionID, cred, nil)
+		p.service, err = armcompute.NewVirtualMachinesClient(p.subscriptionID, p.cred, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -95,6 +101,12 @@ func (c *config) CanHibernate() bool {
 	return false
 }
 
+// UserdataLimit returns the limit of Azure on the custom data, 87380
+// characters once base64 encoded.
+func (c *config) UserdataLimit() int {
+	return 65535
+}
+
 func (c *config) Zones() string {
 	var z string
 	if len(z) == 1 {
@@ -135,6 +147,12 @@ func (c *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 
 	logr.Info("starting Azure Setup")
 
+	userdata, err := lehelper.GenerateUserdata(c.userData, opts)
+	if err != nil {
+		logr.WithError(err).Errorln("failed to generate userdata")
+		return nil, err
+	}
+
 	_, err = c.createResourceGroup(ctx)
 	if err != nil {
 		logr.WithError(err).Errorln("failed to get/create resource group")
@@ -166,7 +184,7 @@ func (c *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 	// create the instance
 	startTime := time.Now()
 
-	uData := base64.StdEncoding.EncodeToString([]byte(lehelper.GenerateUserdata(c.userData, opts)))
+	uData := base64.StdEncoding.EncodeToString([]byte(userdata))
 
 	logr.Traceln("azure: creating VM")
 
@@ -213,11 +231,11 @@ func (c *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 
 	poller, err := c.service.BeginCreateOrUpdate(ctx, c.resourceGroupName, name, in, nil)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	vm, err := poller.PollUntilDone(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	// if windows add extension to vm
 	if opts.OS == oshelp.OSWindows {
@@ -314,6 +332,10 @@ func (c *config) Start(_ context.Context, _, _ string) (ipAddress string, err er
 }
 
 func (c *config) Ping(ctx context.Context) error {
+	if c.credentials != nil {
+		_, err := c.credentials.Retrieve(ctx)
+		return err
+	}
 	_, err := azidentity.NewClientSecretCredential(c.tenantID, c.clientID, c.clientSecret, nil)
 	if err != nil {
 		return err
@@ -343,7 +365,6 @@ func (c *config) mapToInstance(vm *armcompute.VirtualMachinesClientCreateOrUpdat
 		Platform:     opts.Platform,
 		Address:      c.IPAddress,
 		CACert:       opts.CACert,
-		CAKey:        opts.CAKey,
 		TLSCert:      opts.TLSCert,
 		TLSKey:       opts.TLSKey,
 		Started:      vm.Properties.TimeCreated.Unix(),
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	"github.com/drone-runners/drone-runner-aws/types"
 
@@ -42,6 +43,14 @@ func WithClientSecret(clientSecret string) Option {
 	}
 }
 
+// WithCredentials sets a provider of the client secret, which takes
+// precedence over the static client secret.
+func WithCredentials(cache *icredentials.Cache) Option {
+	return func(p *config) {
+		p.credentials = cache
+	}
+}
+
 func WithSubscriptionID(subscriptionID string) Option {
 	return func(p *config) {
 		p.subscriptionID = subscriptionID
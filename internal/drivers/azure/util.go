@@ -2,12 +2,20 @@ package azure
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"sync"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone/runner-go/logger"
 )
 
@@ -294,3 +302,65 @@ func tempdir(inputOS string) string {
 		return oshelp.JoinPaths(inputOS, "/tmp", dir)
 	}
 }
+
+// helper function annotates an Azure API error with the class of the failure.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return itypes.NewProvisionError(errorClass(err), err)
+}
+
+func errorClass(err error) itypes.ErrorClass {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return itypes.ErrorClassUnknown
+	}
+	switch respErr.ErrorCode {
+	case "SkuNotAvailable", "AllocationFailed", "ZonalAllocationFailed", "OverconstrainedAllocationRequest":
+		return itypes.ErrorClassCapacity
+	case "QuotaExceeded", "OperationNotAllowed":
+		return itypes.ErrorClassQuota
+	case "AuthorizationFailed", "AuthenticationFailed", "InvalidAuthenticationToken":
+		return itypes.ErrorClassAuth
+	}
+	switch code := respErr.StatusCode; {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return itypes.ErrorClassAuth
+	case code == http.StatusTooManyRequests, code >= http.StatusInternalServerError:
+		return itypes.ErrorClassTransient
+	case code == http.StatusBadRequest, code == http.StatusNotFound, code == http.StatusConflict:
+		return itypes.ErrorClassConfig
+	}
+	return itypes.ErrorClassUnknown
+}
+
+// secretCredential is a client secret credential whose secret comes from a
+// credentials cache. It is rebuilt whenever the secret is rotated.
+type secretCredential struct {
+	tenantID string
+	clientID string
+	cache    *icredentials.Cache
+
+	mu     sync.Mutex
+	secret string
+	cred   *azidentity.ClientSecretCredential
+}
+
+func (s *secretCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	secret, err := s.cache.Get(ctx, icredentials.ClientSecret)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	s.mu.Lock()
+	if s.cred == nil || secret != s.secret {
+		s.cred, err = azidentity.NewClientSecretCredential(s.tenantID, s.clientID, secret, nil)
+		s.secret = secret
+	}
+	cred := s.cred
+	s.mu.Unlock()
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	return cred.GetToken(ctx, opts)
+}
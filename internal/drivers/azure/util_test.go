@@ -0,0 +1,40 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func Test_classifyError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class itypes.ErrorClass
+	}{
+		{name: "sku not available", err: &azcore.ResponseError{ErrorCode: "SkuNotAvailable", StatusCode: http.StatusConflict}, class: itypes.ErrorClassCapacity},
+		{name: "allocation failed", err: &azcore.ResponseError{ErrorCode: "ZonalAllocationFailed", StatusCode: http.StatusOK}, class: itypes.ErrorClassCapacity},
+		{name: "quota exceeded", err: &azcore.ResponseError{ErrorCode: "QuotaExceeded", StatusCode: http.StatusConflict}, class: itypes.ErrorClassQuota},
+		{name: "authorization failed", err: &azcore.ResponseError{ErrorCode: "AuthorizationFailed", StatusCode: http.StatusOK}, class: itypes.ErrorClassAuth},
+		{name: "forbidden", err: &azcore.ResponseError{StatusCode: http.StatusForbidden}, class: itypes.ErrorClassAuth},
+		{name: "throttled", err: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, class: itypes.ErrorClassTransient},
+		{name: "server error", err: &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}, class: itypes.ErrorClassTransient},
+		{name: "bad request", err: &azcore.ResponseError{ErrorCode: "InvalidParameter", StatusCode: http.StatusBadRequest}, class: itypes.ErrorClassConfig},
+		{name: "wrapped", err: fmt.Errorf("create: %w", &azcore.ResponseError{StatusCode: http.StatusNotFound}), class: itypes.ErrorClassConfig},
+		{name: "not an api error", err: errors.New("boom"), class: itypes.ErrorClassUnknown},
+	}
+
+	for _, test := range tests {
+		if got, want := itypes.ClassOf(classifyError(test.err)), test.class; got != want {
+			t.Errorf("Want class %s for %s, got %s", want, test.name, got)
+		}
+	}
+	if classifyError(nil) != nil {
+		t.Errorf("Want no error")
+	}
+}
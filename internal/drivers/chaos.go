@@ -0,0 +1,232 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/store"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// errInjectedFailure is the error of the calls failed before they reach the
+// driver.
+var errInjectedFailure = errors.New("chaos: injected failure")
+
+// Faults are the faults injected into the calls of a method of a driver by
+// the chaos middleware. The rates are probabilities between 0 and 1.
+type Faults struct {
+	// FailureRate fails a call with a transient error before it reaches the
+	// driver.
+	FailureRate float64
+	// HangRate blocks a call until its context ends.
+	HangRate float64
+	// NoAddressRate drops the IP address of an instance created or started.
+	NoAddressRate float64
+	// PartialRate fails a call to Create after the driver created the
+	// instance, which is not returned, or hangs it until its context ends, at
+	// random. It fails a call to Destroy after half of the instances are
+	// destroyed.
+	PartialRate float64
+	// Latency delays every call.
+	Latency time.Duration
+}
+
+// ChaosDriver injects faults into the calls of a driver to the cloud API, to
+// test how the runner copes with a misbehaving cloud without a real one. It
+// keeps track of the instances it created which are not destroyed yet, so
+// that leaks can be detected.
+type ChaosDriver struct {
+	Driver
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	faults    map[string]Faults
+	instances map[string]struct{}
+}
+
+// Chaos returns a middleware injecting faults, by method name, e.g. Create,
+// into the calls of a driver. The faults are drawn from the seed, or from the
+// current time if it is zero.
+func Chaos(faults map[string]Faults, seed int64) Middleware {
+	return func(next Driver) Driver {
+		return NewChaosDriver(next, faults, seed)
+	}
+}
+
+// NewChaosDriver wraps the driver with the chaos middleware.
+func NewChaosDriver(driver Driver, faults map[string]Faults, seed int64) *ChaosDriver {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	d := &ChaosDriver{
+		Driver:    driver,
+		rand:      rand.New(rand.NewSource(seed)), //nolint:gosec
+		faults:    map[string]Faults{},
+		instances: map[string]struct{}{},
+	}
+	for method, f := range faults {
+		d.faults[method] = f
+	}
+	return d
+}
+
+// Leaked returns the IDs of the instances created by the driver which are not
+// destroyed yet, and which the store does not know about, so that nothing
+// would ever destroy them.
+func (d *ChaosDriver) Leaked(ctx context.Context, instanceStore store.InstanceStore) []string {
+	var ids []string
+	for _, id := range d.Instances() {
+		if _, err := instanceStore.Find(ctx, id); err != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Instances returns the IDs of the instances created by the driver which are
+// not destroyed yet.
+func (d *ChaosDriver) Instances() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]string, 0, len(d.instances))
+	for id := range d.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Heal stops injecting faults.
+func (d *ChaosDriver) Heal() {
+	d.mu.Lock()
+	d.faults = map[string]Faults{}
+	d.mu.Unlock()
+}
+
+func (d *ChaosDriver) Create(ctx context.Context, opts *types.InstanceCreateOpts) (*types.Instance, error) {
+	f, err := d.inject(ctx, "Create")
+	if err != nil {
+		return nil, err
+	}
+	inst, err := d.Driver.Create(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.instances[inst.ID] = struct{}{}
+	d.mu.Unlock()
+	if d.roll(f.PartialRate) {
+		// the instance exists, but the caller does not know about it
+		if d.roll(0.5) { //nolint:gomnd
+			<-ctx.Done()
+			return nil, itypes.NewProvisionError(itypes.ErrorClassUnknown,
+				fmt.Errorf("chaos: injected Create hang after instance %s was created: %w", inst.ID, ctx.Err()))
+		}
+		return nil, itypes.NewProvisionError(itypes.ErrorClassTransient,
+			fmt.Errorf("chaos: injected Create failure after instance %s was created", inst.ID))
+	}
+	if d.roll(f.NoAddressRate) {
+		inst.Address = ""
+	}
+	return inst, nil
+}
+
+func (d *ChaosDriver) Destroy(ctx context.Context, instances []*types.Instance) error {
+	f, err := d.inject(ctx, "Destroy")
+	if err != nil {
+		return err
+	}
+	partial := len(instances) != 0 && d.roll(f.PartialRate)
+	if partial {
+		instances = instances[:(len(instances)+1)/2]
+	}
+	if err := d.Driver.Destroy(ctx, instances); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	for _, inst := range instances {
+		delete(d.instances, inst.ID)
+	}
+	d.mu.Unlock()
+	if partial {
+		return itypes.NewProvisionError(itypes.ErrorClassTransient,
+			fmt.Errorf("chaos: injected Destroy failure after %d instances were destroyed", len(instances)))
+	}
+	return nil
+}
+
+func (d *ChaosDriver) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	if _, err := d.inject(ctx, "Hibernate"); err != nil {
+		return err
+	}
+	return d.Driver.Hibernate(ctx, instanceID, poolName)
+}
+
+func (d *ChaosDriver) Start(ctx context.Context, instanceID, poolName string) (string, error) {
+	f, err := d.inject(ctx, "Start")
+	if err != nil {
+		return "", err
+	}
+	ipAddress, err := d.Driver.Start(ctx, instanceID, poolName)
+	if err != nil {
+		return "", err
+	}
+	if d.roll(f.NoAddressRate) {
+		ipAddress = ""
+	}
+	return ipAddress, nil
+}
+
+// UserdataLimit returns the limit of the wrapped driver, zero if it has none.
+func (d *ChaosDriver) UserdataLimit() int {
+	return userdataLimit(d.Driver)
+}
+
+// CanRetryCreate reports whether the failed creation may be retried: the
+// injected failures happen before the call reaches the driver, the other
+// errors are left to the wrapped driver.
+func (d *ChaosDriver) CanRetryCreate(err error) bool {
+	return errors.Is(err, errInjectedFailure) || canRetryCreate(d.Driver, err)
+}
+
+// inject delays, hangs or fails a call of the method, as configured, before
+// it reaches the driver. It returns the faults of the method.
+func (d *ChaosDriver) inject(ctx context.Context, method string) (Faults, error) {
+	d.mu.Lock()
+	f := d.faults[method]
+	d.mu.Unlock()
+
+	if f.Latency > 0 {
+		t := time.NewTimer(f.Latency)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return f, itypes.NewProvisionError(itypes.ErrorClassUnknown, ctx.Err())
+		case <-t.C:
+		}
+	}
+	if d.roll(f.HangRate) {
+		<-ctx.Done()
+		return f, itypes.NewProvisionError(itypes.ErrorClassUnknown, fmt.Errorf("chaos: injected %s hang: %w", method, ctx.Err()))
+	}
+	if d.roll(f.FailureRate) {
+		return f, itypes.NewProvisionError(itypes.ErrorClassTransient, fmt.Errorf("%w of %s", errInjectedFailure, method))
+	}
+	return f, nil
+}
+
+// roll reports whether a fault with the rate happens.
+func (d *ChaosDriver) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rand.Float64() < rate
+}
@@ -0,0 +1,307 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/store/database/ldb"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// cloudDriver is an in-memory cloud which creates instances instantly.
+type cloudDriver struct {
+	mu      sync.Mutex
+	created int
+}
+
+func (d *cloudDriver) Create(_ context.Context, opts *types.InstanceCreateOpts) (*types.Instance, error) {
+	d.mu.Lock()
+	d.created++
+	id := fmt.Sprintf("i-%d", d.created)
+	d.mu.Unlock()
+	return &types.Instance{
+		ID:       id,
+		Name:     id,
+		Provider: types.Amazon,
+		State:    types.StateCreated,
+		Pool:     opts.PoolName,
+		Platform: opts.Platform,
+		Address:  "10.0.0.1",
+		CACert:   opts.CACert,
+		TLSCert:  opts.TLSCert,
+		TLSKey:   opts.TLSKey,
+		Started:  time.Now().Unix(),
+	}, nil
+}
+
+func (d *cloudDriver) Destroy(context.Context, []*types.Instance) error                  { return nil }
+func (d *cloudDriver) Hibernate(context.Context, string, string) error                   { return nil }
+func (d *cloudDriver) Start(context.Context, string, string) (string, error)             { return "10.0.0.2", nil }
+func (d *cloudDriver) SetTags(context.Context, *types.Instance, map[string]string) error { return nil }
+func (d *cloudDriver) Ping(context.Context) error                                        { return nil }
+func (d *cloudDriver) Logs(context.Context, string) (string, error)                      { return "", nil }
+func (d *cloudDriver) RootDir() string                                                   { return "" }
+func (d *cloudDriver) DriverName() string                                                { return string(types.Amazon) }
+func (d *cloudDriver) CanHibernate() bool                                                { return false }
+
+func TestChaosDriver(t *testing.T) {
+	ctx := context.Background()
+	opts := &types.InstanceCreateOpts{PoolName: "linux"}
+
+	d := NewChaosDriver(&cloudDriver{}, map[string]Faults{"Create": {FailureRate: 1}}, 1)
+	if _, err := d.Create(ctx, opts); itypes.ClassOf(err) != itypes.ErrorClassTransient {
+		t.Errorf("want a transient error, got %v", err)
+	}
+	if got := d.Instances(); len(got) != 0 {
+		t.Errorf("want no instance created by a failed call, got %v", got)
+	}
+
+	d = NewChaosDriver(&cloudDriver{}, map[string]Faults{"Create": {PartialRate: 1}}, 1)
+	partialCtx, stop := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer stop()
+	for i := 0; i < 4; i++ {
+		if inst, err := d.Create(partialCtx, opts); err == nil {
+			t.Errorf("want the creation to fail after the instance was created, got %v", inst)
+		}
+	}
+	if got := d.Instances(); len(got) != 4 {
+		t.Errorf("want the instances of the failed calls created, got %v", got)
+	}
+
+	d = NewChaosDriver(&cloudDriver{}, map[string]Faults{"Create": {NoAddressRate: 1}, "Start": {NoAddressRate: 1}}, 1)
+	inst, err := d.Create(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Address != "" {
+		t.Errorf("want an instance without an address, got %q", inst.Address)
+	}
+	if ip, err := d.Start(ctx, inst.ID, "linux"); err != nil || ip != "" {
+		t.Errorf("want a start without an address, got %q, %v", ip, err)
+	}
+
+	d = NewChaosDriver(&cloudDriver{}, map[string]Faults{"Destroy": {PartialRate: 1}}, 1)
+	var instances []*types.Instance
+	for i := 0; i < 3; i++ {
+		inst, err := d.Create(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, inst)
+	}
+	if err := d.Destroy(ctx, instances); itypes.ClassOf(err) != itypes.ErrorClassTransient {
+		t.Errorf("want a transient error, got %v", err)
+	}
+	if got := d.Instances(); len(got) != 1 || got[0] != instances[2].ID {
+		t.Errorf("want the last instance left, got %v", got)
+	}
+	d.Heal()
+	if err := d.Destroy(ctx, instances); err != nil {
+		t.Errorf("want no fault after healing, got %v", err)
+	}
+	if got := d.Instances(); len(got) != 0 {
+		t.Errorf("want all instances destroyed, got %v", got)
+	}
+
+	d = NewChaosDriver(&cloudDriver{}, map[string]Faults{"Hibernate": {HangRate: 1}}, 1)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := d.Hibernate(ctx, "i-1", "linux"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want the call to hang until the context ends, got %v", err)
+	}
+}
+
+// newChaosManager returns a manager with a pool of the driver, on an
+// in-memory store, recording the metrics if they are set.
+func newChaosManager(t *testing.T, pool Pool, metrics *metric.Metrics) *Manager {
+	t.Helper()
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	env := &config.EnvConfig{}
+	env.Runner.Name = "runner"
+	m := NewManager(context.Background(), ldb.NewInstanceStore(db), ldb.NewStageOwnerStore(db), env)
+	m.AddMetrics(metrics)
+	if err := m.Add(pool); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestManager_ChaosPurge(t *testing.T) {
+	ctx := context.Background()
+	chaos := NewChaosDriver(&cloudDriver{}, map[string]Faults{"Destroy": {PartialRate: 1}}, 1)
+	m := newChaosManager(t, Pool{
+		Name:     "linux",
+		MinSize:  4,
+		MaxSize:  4,
+		Platform: types.Platform{OS: "linux", Arch: "amd64"},
+		Driver:   chaos,
+	}, nil)
+	pool := m.poolMap["linux"]
+	if err := m.buildPool(ctx, pool, "runner", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(chaos.Instances()); got != 4 {
+		t.Fatalf("want 4 instances, got %d", got)
+	}
+
+	// all instances are stale, and the pool is not rebuilt
+	pool.MinSize = 0
+	list, err := m.instanceStore.List(ctx, "linux", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, inst := range list {
+		inst.Started = time.Now().Add(-time.Hour).Unix()
+		if err := m.Update(ctx, inst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.purge(ctx, pool, "runner", 10*time.Minute, 20*time.Minute); err == nil {
+		t.Errorf("want the partial destroy to fail the purge")
+	}
+	if got := len(chaos.Instances()); got != 2 {
+		t.Errorf("want 2 instances left, got %d", got)
+	}
+	if ids := chaos.Leaked(ctx, m.instanceStore); len(ids) != 0 {
+		t.Errorf("want no leaked instances, got %v", ids)
+	}
+
+	chaos.Heal()
+	if err := m.purge(ctx, pool, "runner", 10*time.Minute, 20*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := chaos.Instances(); len(got) != 0 {
+		t.Errorf("want all instances destroyed, got %v", got)
+	}
+	if list, _ := m.instanceStore.List(ctx, "linux", nil); len(list) != 0 {
+		t.Errorf("want no instances in the store, got %d", len(list))
+	}
+}
+
+func TestManager_ChaosPartialCreate(t *testing.T) {
+	defer func(interval time.Duration) { retryInitialInterval = interval }(retryInitialInterval)
+	retryInitialInterval = time.Millisecond
+
+	ctx := context.Background()
+	env := &config.EnvConfig{}
+	chaos := NewChaosDriver(&cloudDriver{}, map[string]Faults{"Create": {FailureRate: 0.2, PartialRate: 0.3}}, 1)
+	m := newChaosManager(t, Pool{
+		Name:       "linux",
+		MaxSize:    100,
+		Platform:   types.Platform{OS: "linux", Arch: "amd64"},
+		RateLimit:  RateLimit{Retries: 3},
+		Middleware: []Middleware{Timeouts(map[string]time.Duration{"Create": 50 * time.Millisecond})},
+		Driver:     chaos,
+	}, nil)
+
+	failed := 0
+	for i := 0; i < 20; i++ {
+		if _, err := m.Provision(ctx, "linux", "runner", "runner", "account", "", env, nil); err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Fatalf("want some of the calls to fail")
+	}
+	// every call which succeeded, retried or not, tracks its instance
+	if list, err := m.instanceStore.List(ctx, "linux", nil); err != nil || len(list) != 20-failed {
+		t.Errorf("want an instance in the store for each of the %d calls which succeeded, got %d", 20-failed, len(list))
+	}
+	// TODO: an instance created by a Create which then fails is leaked, it is
+	// neither tracked nor destroyed, and nothing reconciles the instances of
+	// the cloud with the store yet. Until then only bound the leak.
+	if ids := chaos.Leaked(ctx, m.instanceStore); len(ids) > failed {
+		t.Errorf("want at most an instance leaked by each of the %d failed calls, got %v", failed, ids)
+	}
+}
+
+func TestManager_ObserveAddress(t *testing.T) {
+	ctx := context.Background()
+	env := &config.EnvConfig{}
+	metrics := &metric.Metrics{
+		InstanceCreateDuration:  metric.InstanceCreateDuration(),
+		InstanceAddressDuration: metric.InstanceAddressDuration(),
+	}
+	m := newChaosManager(t, Pool{
+		Name:     "linux",
+		MaxSize:  10,
+		Platform: types.Platform{OS: "linux", Arch: "amd64"},
+		Driver:   NewChaosDriver(&cloudDriver{}, map[string]Faults{"Create": {NoAddressRate: 1}}, 1),
+	}, metrics)
+
+	// an instance created without an address has no time to its address
+	if _, err := m.Provision(ctx, "linux", "runner", "runner", "account", "", env, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.CollectAndCount(metrics.InstanceCreateDuration); got != 1 {
+		t.Errorf("want the creation observed, got %d series", got)
+	}
+	if got := testutil.CollectAndCount(metrics.InstanceAddressDuration); got != 0 {
+		t.Errorf("want no time to the address observed, got %d series", got)
+	}
+
+	m.poolMap["linux"].Driver = NewChaosDriver(&cloudDriver{}, nil, 1)
+	if _, err := m.Provision(ctx, "linux", "runner", "runner", "account", "", env, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.CollectAndCount(metrics.InstanceAddressDuration); got != 1 {
+		t.Errorf("want the time to the address observed, got %d series", got)
+	}
+}
+
+func TestManager_ChaosProvision(t *testing.T) {
+	ctx := context.Background()
+	env := &config.EnvConfig{}
+	chaos := NewChaosDriver(&cloudDriver{}, map[string]Faults{"Create": {FailureRate: 0.5}}, 1)
+	m := newChaosManager(t, Pool{
+		Name:     "linux",
+		MaxSize:  100,
+		Platform: types.Platform{OS: "linux", Arch: "amd64"},
+		Driver:   chaos,
+	}, nil)
+
+	failed := 0
+	for i := 0; i < 20; i++ {
+		inst, err := m.Provision(ctx, "linux", "runner", "runner", "account", "", env, nil)
+		if err != nil {
+			failed++
+			continue
+		}
+		if inst.State != types.StateInUse {
+			t.Errorf("want the instance in use, got %s", inst.State)
+		}
+	}
+	if failed == 0 || failed == 20 {
+		t.Errorf("want some of the calls to fail, %d failed", failed)
+	}
+	if got := len(chaos.Instances()); got != 20-failed {
+		t.Errorf("want an instance for each successful call, got %d", got)
+	}
+	if ids := chaos.Leaked(ctx, m.instanceStore); len(ids) != 0 {
+		t.Errorf("want no leaked instances, got %v", ids)
+	}
+
+	if err := m.CleanPools(ctx, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := chaos.Instances(); len(got) != 0 {
+		t.Errorf("want all instances destroyed, got %v", got)
+	}
+}
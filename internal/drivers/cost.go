@@ -0,0 +1,50 @@
+package drivers
+
+import (
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// hourlyCost returns the estimated cost per hour of a running instance of the
+// pool, zero if it is unknown.
+func (p *Pool) hourlyCost(inst *types.Instance) float64 {
+	if p.HourlyCost > 0 {
+		return p.HourlyCost
+	}
+	return p.HourlyCosts[inst.Size]
+}
+
+// accrue adds the estimated cost of the instance since its last state change
+// to the instance and the metrics, and restarts the clock. The cost of an
+// instance in use is attributed to its owner, the cost of an idle or
+// hibernated instance to the pool. It must be called before the state of the
+// instance changes.
+func (m *Manager) accrue(pool *poolEntry, inst *types.Instance, now time.Time) {
+	since := inst.CostUpdated
+	if since == 0 {
+		since = inst.Started
+	}
+	inst.CostUpdated = now.Unix()
+	if since == 0 || since >= now.Unix() {
+		return
+	}
+
+	// the clock is persisted in seconds
+	hours := (time.Duration(now.Unix()-since) * time.Second).Hours()
+	driver := pool.Driver.DriverName()
+	var cost float64
+	switch {
+	case inst.State == types.StateInUse:
+		cost = hours * pool.hourlyCost(inst)
+		m.metrics.AddBusyCost(pool.Name, driver, inst.OwnerID, cost)
+	case inst.IsHibernated:
+		cost = hours * pool.HibernatedHourlyCost
+		m.metrics.AddIdleCost(pool.Name, driver, metric.StateHibernated, cost)
+	default:
+		cost = hours * pool.hourlyCost(inst)
+		m.metrics.AddIdleCost(pool.Name, driver, metric.StateIdle, cost)
+	}
+	inst.Cost += cost
+}
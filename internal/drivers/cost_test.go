@@ -0,0 +1,67 @@
+package drivers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type namedDriver struct {
+	Driver
+}
+
+func (namedDriver) DriverName() string { return "amazon" }
+
+func TestAccrue(t *testing.T) {
+	m := &Manager{metrics: &metric.Metrics{BusyCost: metric.BusyCost(), IdleCost: metric.IdleCost()}}
+	pool := &poolEntry{Pool: Pool{
+		Name:                 "linux",
+		HourlyCosts:          map[string]float64{"t3.large": 0.1},
+		HibernatedHourlyCost: 0.01,
+		Driver:               namedDriver{},
+	}}
+	now := time.Now()
+	inst := &types.Instance{Size: "t3.large", Started: now.Add(-3 * time.Hour).Unix()}
+
+	// idle for an hour after it was started, then hibernated for an hour
+	m.accrue(pool, inst, now.Add(-2*time.Hour))
+	inst.IsHibernated = true
+	m.accrue(pool, inst, now.Add(-time.Hour))
+
+	// in use by an account for an hour
+	inst.IsHibernated = false
+	inst.State = types.StateInUse
+	inst.OwnerID = "account"
+	m.accrue(pool, inst, now)
+
+	if math.Abs(inst.Cost-0.21) > 1e-9 {
+		t.Errorf("want a cost of 0.21, got %v", inst.Cost)
+	}
+	if inst.CostUpdated != now.Unix() || inst.Updated != 0 {
+		t.Errorf("want the clock restarted")
+	}
+	tests := []struct {
+		got, want float64
+	}{
+		{testutil.ToFloat64(m.metrics.IdleCost.WithLabelValues("linux", "amazon", metric.StateIdle)), 0.1},
+		{testutil.ToFloat64(m.metrics.IdleCost.WithLabelValues("linux", "amazon", metric.StateHibernated)), 0.01},
+		{testutil.ToFloat64(m.metrics.BusyCost.WithLabelValues("linux", "amazon", "account")), 0.1},
+	}
+	for i, test := range tests {
+		if math.Abs(test.got-test.want) > 1e-9 {
+			t.Errorf("%d: want %v, got %v", i, test.want, test.got)
+		}
+	}
+
+	// an explicit hourly cost takes precedence over the price of the size
+	pool.HourlyCost = 1
+	m.accrue(pool, inst, now.Add(time.Hour))
+	if math.Abs(inst.Cost-1.21) > 1e-9 {
+		t.Errorf("want a cost of 1.21, got %v", inst.Cost)
+	}
+}
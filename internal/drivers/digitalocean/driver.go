@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
 	"github.com/drone-runners/drone-runner-aws/types"
@@ -18,14 +19,15 @@ import (
 
 // config is a struct that implements drivers.Pool interface
 type config struct {
-	pat        string
-	region     string
-	size       string
-	tags       []string
-	FirewallID string
-	SSHKeys    []string
-	userData   string
-	rootDir    string
+	pat         string
+	credentials *icredentials.Cache
+	region      string
+	size        string
+	tags        []string
+	FirewallID  string
+	SSHKeys     []string
+	userData    string
+	rootDir     string
 
 	image string
 
@@ -56,8 +58,13 @@ func (p *config) CanHibernate() bool {
 	return p.hibernate
 }
 
+// UserdataLimit returns the 64 KiB limit of DigitalOcean on the user data.
+func (p *config) UserdataLimit() int {
+	return 64 * 1024
+}
+
 func (p *config) Ping(ctx context.Context) error {
-	client := newClient(ctx, p.pat)
+	client := newClient(ctx, p.tokenSource())
 	_, _, err := client.Droplets.List(ctx, &godo.ListOptions{})
 	return err
 }
@@ -73,6 +80,12 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 	var name = fmt.Sprintf("%s-%s-%s", opts.RunnerName, opts.PoolName, uniuri.NewLen(8)) //nolint:gomnd
 	logr.Infof("digitalocean: creating instance %s", name)
 
+	userdata, err := lehelper.GenerateUserdata(p.userData, opts)
+	if err != nil {
+		logr.WithError(err).Errorln("digitalocean: failed to generate userdata")
+		return nil, err
+	}
+
 	// create a new digitalocean request
 	req := &godo.DropletCreateRequest{
 		Name:     name,
@@ -80,7 +93,7 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Size:     p.size,
 		Tags:     p.tags,
 		IPv6:     false,
-		UserData: lehelper.GenerateUserdata(p.userData, opts),
+		UserData: userdata,
 
 		Image: godo.DropletCreateImage{
 			Slug: p.image,
@@ -91,7 +104,7 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		req.SSHKeys = createSSHKeys(p.SSHKeys)
 	}
 	// create droplet
-	client := newClient(ctx, p.pat)
+	client := newClient(ctx, p.tokenSource())
 	droplet, _, err := client.Droplets.Create(ctx, req)
 	if err != nil {
 		logr.WithError(err).
@@ -127,7 +140,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Image:        p.image,
 		Size:         p.size,
 		Platform:     opts.Platform,
-		CAKey:        opts.CAKey,
 		CACert:       opts.CACert,
 		TLSKey:       opts.TLSKey,
 		TLSCert:      opts.TLSCert,
@@ -188,7 +200,7 @@ func (p *config) Destroy(ctx context.Context, instances []*types.Instance) (err
 		WithField("id", instanceIDs).
 		WithField("driver", types.DigitalOcean)
 
-	client := newClient(ctx, p.pat)
+	client := newClient(ctx, p.tokenSource())
 	for _, instanceID := range instanceIDs {
 		id, err := strconv.Atoi(instanceID)
 		if err != nil {
@@ -237,14 +249,30 @@ func (p *config) SetTags(ctx context.Context, instance *types.Instance,
 }
 
 // helper function returns a new digitalocean client.
-func newClient(ctx context.Context, pat string) *godo.Client {
-	return godo.NewClient(
-		oauth2.NewClient(ctx, oauth2.StaticTokenSource(
-			&oauth2.Token{
-				AccessToken: pat,
-			},
-		)),
-	)
+func newClient(ctx context.Context, tokens oauth2.TokenSource) *godo.Client {
+	return godo.NewClient(oauth2.NewClient(ctx, tokens))
+}
+
+// tokenSource returns the source of the personal access token.
+func (p *config) tokenSource() oauth2.TokenSource {
+	if p.credentials != nil {
+		return &tokenSource{cache: p.credentials}
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: p.pat})
+}
+
+// tokenSource reads the personal access token from a credentials cache. The
+// token expires when the cache is due for a refresh.
+type tokenSource struct {
+	cache *icredentials.Cache
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	pat, err := s.cache.Get(context.Background(), icredentials.PAT)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: pat, Expiry: s.cache.RefreshAt()}, nil
 }
 
 // take a slice of ssh keys and return a slice of godo.DropletCreateSSHKey
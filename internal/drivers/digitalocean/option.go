@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	icredentials "github.com/drone-runners/drone-runner-aws/internal/credentials"
 	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/sirupsen/logrus"
@@ -40,6 +41,14 @@ func WithPAT(pat string) Option {
 	}
 }
 
+// WithCredentials sets a provider of the personal access token, which takes
+// precedence over the static token.
+func WithCredentials(cache *icredentials.Cache) Option {
+	return func(p *config) {
+		p.credentials = cache
+	}
+}
+
 func WithRegion(region string) Option {
 	return func(p *config) {
 		if region == "" {
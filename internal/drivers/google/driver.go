@@ -14,6 +14,7 @@ import (
 
 	"github.com/drone-runners/drone-runner-aws/internal/drivers"
 	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/runner-go/logger"
 
@@ -125,6 +126,12 @@ func (p *config) CanHibernate() bool {
 	return p.hibernate
 }
 
+// UserdataLimit returns the 256 KB limit of Compute Engine on a metadata
+// value.
+func (p *config) UserdataLimit() int {
+	return 256 * 1024
+}
+
 func (p *config) Logs(ctx context.Context, instance string) (string, error) {
 	zone, err := p.findInstanceZone(ctx, instance)
 	if err != nil {
@@ -160,8 +167,12 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		_ = p.setup(ctx)
 	})
 
+	userdata, err := lehelper.GenerateUserdata(p.userData, opts)
+	if err != nil {
+		return nil, err
+	}
 	var name = getInstanceName(opts.RunnerName, opts.PoolName)
-	inst, err := p.create(ctx, opts, name)
+	inst, err := p.create(ctx, opts, name, userdata)
 	if err != nil {
 		defer p.Destroy(context.Background(), []*types.Instance{{ID: name}}) //nolint:errcheck
 		return nil, err
@@ -169,7 +180,7 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 	return inst, nil
 }
 
-func (p *config) create(ctx context.Context, opts *types.InstanceCreateOpts, name string) (instance *types.Instance, err error) {
+func (p *config) create(ctx context.Context, opts *types.InstanceCreateOpts, name, userdata string) (instance *types.Instance, err error) {
 	zone := p.RandomZone()
 
 	logr := logger.FromContext(ctx).
@@ -226,7 +237,7 @@ func (p *config) create(ctx context.Context, opts *types.InstanceCreateOpts, nam
 			Items: []*compute.MetadataItems{
 				{
 					Key:   p.userDataKey,
-					Value: googleapi.String(lehelper.GenerateUserdata(p.userData, opts)),
+					Value: googleapi.String(userdata),
 				},
 			},
 		},
@@ -276,7 +287,7 @@ func (p *config) create(ctx context.Context, opts *types.InstanceCreateOpts, nam
 	op, err := p.insertInstance(ctx, p.projectID, zone, requestID, in)
 	if err != nil {
 		logr.WithError(err).Errorln("google: failed to provision VM")
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	err = p.waitZoneOperation(ctx, op.Name, zone)
@@ -430,7 +441,7 @@ func (p *config) Start(ctx context.Context, instanceID, _ string) (string, error
 	op, err := p.resumeInstance(ctx, p.projectID, zone, instanceID)
 	if err != nil {
 		logr.WithError(err).Errorln("google: failed to suspend VM")
-		return "", err
+		return "", classifyError(err)
 	}
 
 	err = p.waitZoneOperation(ctx, op.Name, zone)
@@ -510,7 +521,6 @@ func (p *config) mapToInstance(vm *compute.Instance, zone string, opts *types.In
 		Platform:     opts.Platform,
 		Address:      instanceIP,
 		CACert:       opts.CACert,
-		CAKey:        opts.CAKey,
 		TLSCert:      opts.TLSCert,
 		TLSKey:       opts.TLSKey,
 		Started:      started.Unix(),
@@ -567,7 +577,8 @@ func (p *config) waitZoneOperation(ctx context.Context, name, zone string) error
 			return err
 		}
 		if op.Error != nil {
-			return errors.New(op.Error.Errors[0].Message)
+			opErr := op.Error.Errors[0]
+			return itypes.NewProvisionError(operationErrorClass(opErr.Code), errors.New(opErr.Message))
 		}
 		if op.Status == "DONE" {
 			return nil
@@ -636,7 +647,8 @@ func (p *config) waitGlobalOperation(ctx context.Context, name string) error {
 			return err
 		}
 		if op.Error != nil {
-			return errors.New(op.Error.Errors[0].Message)
+			opErr := op.Error.Errors[0]
+			return itypes.NewProvisionError(operationErrorClass(opErr.Code), errors.New(opErr.Message))
 		}
 		if op.Status == "DONE" {
 			return nil
@@ -3,6 +3,12 @@ package google
 import (
 	"crypto/rand"
 	"math/big"
+	"net/http"
+	"strings"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+
+	"google.golang.org/api/googleapi"
 )
 
 const letters = "0123456789abcdefghijklmnopqrstuvwxyz"
@@ -29,3 +35,53 @@ func substrSuffix(s string, maxLen int) string {
 
 	return s[len(s)-maxLen:]
 }
+
+// classifyError annotates a compute API error with the class of the failure.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return itypes.NewProvisionError(errorClass(err), err)
+}
+
+func errorClass(err error) itypes.ErrorClass {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		if shouldRetry(err) {
+			return itypes.ErrorClassTransient
+		}
+		return itypes.ErrorClassUnknown
+	}
+	for _, item := range gerr.Errors {
+		switch item.Reason {
+		case "quotaExceeded":
+			return itypes.ErrorClassQuota
+		case "rateLimitExceeded", "userRateLimitExceeded":
+			return itypes.ErrorClassTransient
+		}
+	}
+	switch {
+	case gerr.Code == http.StatusUnauthorized, gerr.Code == http.StatusForbidden:
+		return itypes.ErrorClassAuth
+	case shouldRetry(err):
+		return itypes.ErrorClassTransient
+	case gerr.Code == http.StatusBadRequest, gerr.Code == http.StatusNotFound:
+		return itypes.ErrorClassConfig
+	}
+	return itypes.ErrorClassUnknown
+}
+
+// operationErrorClass maps the error code of a failed zone operation to an error class.
+func operationErrorClass(code string) itypes.ErrorClass {
+	switch {
+	case strings.HasPrefix(code, "ZONE_RESOURCE_POOL_EXHAUSTED"), code == "RESOURCE_POOL_EXHAUSTED":
+		return itypes.ErrorClassCapacity
+	case code == "QUOTA_EXCEEDED":
+		return itypes.ErrorClassQuota
+	case code == "PERMISSIONS_ERROR":
+		return itypes.ErrorClassAuth
+	case strings.HasPrefix(code, "INVALID"), code == "RESOURCE_NOT_FOUND":
+		return itypes.ErrorClassConfig
+	}
+	return itypes.ErrorClassUnknown
+}
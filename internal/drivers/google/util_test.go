@@ -1,7 +1,13 @@
 package google
 
 import (
+	"errors"
+	"net/http"
 	"testing"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+
+	"google.golang.org/api/googleapi"
 )
 
 func Test_substrSuffix(t *testing.T) {
@@ -21,3 +27,50 @@ func Test_substrSuffix(t *testing.T) {
 		}
 	}
 }
+
+func Test_classifyError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class itypes.ErrorClass
+	}{
+		{name: "quota exceeded", err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, class: itypes.ErrorClassQuota},
+		{name: "rate limit exceeded", err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, class: itypes.ErrorClassTransient},
+		{name: "unauthorized", err: &googleapi.Error{Code: http.StatusUnauthorized}, class: itypes.ErrorClassAuth},
+		{name: "forbidden", err: &googleapi.Error{Code: http.StatusForbidden}, class: itypes.ErrorClassAuth},
+		{name: "too many requests", err: &googleapi.Error{Code: http.StatusTooManyRequests}, class: itypes.ErrorClassTransient},
+		{name: "server error", err: &googleapi.Error{Code: http.StatusBadGateway}, class: itypes.ErrorClassTransient},
+		{name: "bad request", err: &googleapi.Error{Code: http.StatusBadRequest}, class: itypes.ErrorClassConfig},
+		{name: "not found", err: &googleapi.Error{Code: http.StatusNotFound}, class: itypes.ErrorClassConfig},
+		{name: "conflict", err: &googleapi.Error{Code: http.StatusConflict}, class: itypes.ErrorClassUnknown},
+		{name: "not an api error", err: errors.New("boom"), class: itypes.ErrorClassUnknown},
+	}
+
+	for _, test := range tests {
+		if got, want := itypes.ClassOf(classifyError(test.err)), test.class; got != want {
+			t.Errorf("Want class %s for %s, got %s", want, test.name, got)
+		}
+	}
+}
+
+func Test_operationErrorClass(t *testing.T) {
+	tests := []struct {
+		code  string
+		class itypes.ErrorClass
+	}{
+		{code: "ZONE_RESOURCE_POOL_EXHAUSTED", class: itypes.ErrorClassCapacity},
+		{code: "ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS", class: itypes.ErrorClassCapacity},
+		{code: "RESOURCE_POOL_EXHAUSTED", class: itypes.ErrorClassCapacity},
+		{code: "QUOTA_EXCEEDED", class: itypes.ErrorClassQuota},
+		{code: "PERMISSIONS_ERROR", class: itypes.ErrorClassAuth},
+		{code: "INVALID_FIELD_VALUE", class: itypes.ErrorClassConfig},
+		{code: "RESOURCE_NOT_FOUND", class: itypes.ErrorClassConfig},
+		{code: "INTERNAL_ERROR", class: itypes.ErrorClassUnknown},
+	}
+
+	for _, test := range tests {
+		if got, want := operationErrorClass(test.code), test.class; got != want {
+			t.Errorf("Want class %s for %s, got %s", want, test.code, got)
+		}
+	}
+}
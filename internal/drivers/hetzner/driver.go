@@ -124,7 +124,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Image:        p.image,
 		Size:         p.size,
 		Platform:     opts.Platform,
-		CAKey:        opts.CAKey,
 		CACert:       opts.CACert,
 		TLSKey:       opts.TLSKey,
 		TLSCert:      opts.TLSCert,
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/metric"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/types"
 )
@@ -16,7 +17,12 @@ type IManager interface {
 	GetInstanceByStageID(ctx context.Context, poolName, stage string) (*types.Instance, error)
 	Update(ctx context.Context, instance *types.Instance) error
 	AddTmate(env *config.EnvConfig) error
+	AddCertificateAuthority(env *config.EnvConfig) error
+	AddChecksums(env *config.EnvConfig) error
+	AddMetrics(metrics *metric.Metrics)
 	Add(pools ...Pool) error
+	AddVirtualPools(pools map[string][]WeightedPool)
+	VirtualPool(name string) ([]WeightedPool, bool)
 	StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFree time.Duration, purgerTime time.Duration) error
 	Provision(ctx context.Context, poolName, runnerName, serverName, ownerID, resourceClass string, env *config.EnvConfig, query *types.QueryParams) (*types.Instance, error)
 	Destroy(ctx context.Context, poolName, instanceID string) error
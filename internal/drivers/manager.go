@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"runtime/debug"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/drone-runners/drone-runner-aws/command/config"
 	"github.com/drone-runners/drone-runner-aws/internal/certs"
+	"github.com/drone-runners/drone-runner-aws/internal/cloudinit"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
 	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/metric"
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/types"
 	"github.com/drone/runner-go/logger"
@@ -19,6 +24,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type (
@@ -34,6 +40,10 @@ type (
 		harnessTestBinaryURI string
 		pluginBinaryURI      string
 		tmate                types.Tmate
+		ca                   *certs.Authority
+		checksums            map[string]string
+		metrics              *metric.Metrics
+		virtualPools         map[string][]WeightedPool
 	}
 
 	poolEntry struct {
@@ -174,6 +184,69 @@ func (m *Manager) AddTmate(env *config.EnvConfig) error {
 	return nil
 }
 
+// AddCertificateAuthority sets up the runner-wide certificate authority, if
+// enabled, used to sign the certificates of new instances.
+func (m *Manager) AddCertificateAuthority(env *config.EnvConfig) error {
+	if !env.CA.Enabled {
+		return nil
+	}
+	keyType, err := certs.ParseKeyType(env.CA.KeyType)
+	if err != nil {
+		return err
+	}
+	const day = 24 * time.Hour
+	ca, err := certs.NewAuthority(certs.AuthorityOptions{
+		CertFile:       env.CA.CertFile,
+		KeyFile:        env.CA.KeyFile,
+		KeyType:        keyType,
+		Validity:       time.Duration(env.CA.ValidityDays) * day,
+		CertValidity:   time.Duration(env.CA.CertValidityDays) * day,
+		RotateBefore:   time.Duration(env.CA.RotateBeforeDays) * day,
+		ReloadInterval: time.Duration(env.CA.ReloadSecs) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	logrus.WithField("cert_file", env.CA.CertFile).
+		WithField("expires", ca.Certificate().NotAfter).
+		Infoln("manager: using the runner certificate authority")
+	m.ca = ca
+	return nil
+}
+
+// AddChecksums loads the checksums of the binaries downloaded by the
+// userdata of new instances.
+func (m *Manager) AddChecksums(env *config.EnvConfig) error {
+	checksums, err := cloudinit.LoadChecksums(m.globalCtx, env.Settings.BinaryChecksums, env.Settings.BinaryChecksumsURL)
+	if err != nil {
+		return err
+	}
+	if len(checksums) > 0 {
+		logrus.WithField("binaries", len(checksums)).
+			Infoln("manager: verifying the checksums of downloaded binaries")
+	}
+	m.checksums = checksums
+	return nil
+}
+
+// AddMetrics records the durations of the lifecycle of the instances of the
+// pools in the metrics. It must be called before the pools are added.
+func (m *Manager) AddMetrics(metrics *metric.Metrics) {
+	m.metrics = metrics
+}
+
+// AddVirtualPools registers the virtual pools by name, with the weighted pools
+// they resolve to. Like Add, it must be called before the manager is used.
+func (m *Manager) AddVirtualPools(pools map[string][]WeightedPool) {
+	m.virtualPools = pools
+}
+
+// VirtualPool returns the weighted pools a virtual pool resolves to.
+func (m *Manager) VirtualPool(name string) ([]WeightedPool, bool) {
+	targets, ok := m.virtualPools[name]
+	return targets, ok
+}
+
 func (m *Manager) Add(pools ...Pool) error {
 	if len(pools) == 0 {
 		return nil
@@ -193,9 +266,13 @@ func (m *Manager) Add(pools ...Pool) error {
 			return fmt.Errorf("pool %q already defined", name)
 		}
 
+		pool := pools[i]
+		// the middleware of the runner wraps the middleware of the pool
+		middleware := []Middleware{Tracing(name), Timing(name, m.metrics), RateLimiting(name, pool.RateLimit, m.metrics)}
+		pool.Driver = Chain(pool.Driver, append(middleware, pool.Middleware...)...)
 		m.poolMap[name] = &poolEntry{
 			Mutex: sync.Mutex{},
-			Pool:  pools[i],
+			Pool:  pool,
 		}
 	}
 
@@ -240,57 +317,8 @@ func (m *Manager) StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFre
 					err := m.forEach(ctx,
 						m.GetTLSServerName(),
 						nil,
-						func(ctx context.Context, pool *poolEntry, serverName string, query *types.QueryParams) error {
-							logr := logger.FromContext(ctx).
-								WithField("driver", pool.Driver.DriverName()).
-								WithField("pool", pool.Name)
-
-							pool.Lock()
-							defer pool.Unlock()
-
-							busy, free, hibernating, err := m.List(ctx, pool, nil)
-							if err != nil {
-								return fmt.Errorf("failed to list instances of pool=%q error: %w", pool.Name, err)
-							}
-							free = append(free, hibernating...)
-
-							var instances []*types.Instance
-							for _, inst := range busy {
-								startedAt := time.Unix(inst.Started, 0)
-								if time.Since(startedAt) > maxAgeBusy {
-									instances = append(instances, inst)
-								}
-							}
-							for _, inst := range free {
-								startedAt := time.Unix(inst.Started, 0)
-								if time.Since(startedAt) > maxAgeFree {
-									instances = append(instances, inst)
-								}
-							}
-
-							if len(instances) == 0 {
-								return nil
-							}
-
-							logr.Infof("purger: Terminating %d stale instances\n", len(instances))
-
-							err = pool.Driver.Destroy(ctx, instances)
-							if err != nil {
-								return fmt.Errorf("failed to delete instances of pool=%q error: %w", pool.Name, err)
-							}
-							for _, instance := range instances {
-								derr := m.Delete(ctx, instance.ID)
-								if derr != nil {
-									return fmt.Errorf("failed to delete %s from instance store with err: %s", instance.ID, derr)
-								}
-							}
-
-							err = m.buildPool(ctx, pool, serverName, nil)
-							if err != nil {
-								return fmt.Errorf("failed to rebuld pool=%q error: %w", pool.Name, err)
-							}
-
-							return nil
+						func(ctx context.Context, pool *poolEntry, serverName string, _ *types.QueryParams) error {
+							return m.purge(ctx, pool, serverName, maxAgeBusy, maxAgeFree)
 						})
 					if err != nil {
 						logger.FromContext(ctx).WithError(err).
@@ -304,16 +332,74 @@ func (m *Manager) StartInstancePurger(ctx context.Context, maxAgeBusy, maxAgeFre
 	return nil
 }
 
+// purge destroys the instances of the pool which are older than the max age,
+// and rebuilds the pool.
+func (m *Manager) purge(ctx context.Context, pool *poolEntry, serverName string, maxAgeBusy, maxAgeFree time.Duration) error {
+	logr := logger.FromContext(ctx).
+		WithField("driver", pool.Driver.DriverName()).
+		WithField("pool", pool.Name)
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	busy, free, hibernating, err := m.List(ctx, pool, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list instances of pool=%q error: %w", pool.Name, err)
+	}
+	free = append(free, hibernating...)
+
+	var instances []*types.Instance
+	for _, inst := range busy {
+		startedAt := time.Unix(inst.Started, 0)
+		if time.Since(startedAt) > maxAgeBusy {
+			instances = append(instances, inst)
+		}
+	}
+	for _, inst := range free {
+		startedAt := time.Unix(inst.Started, 0)
+		if time.Since(startedAt) > maxAgeFree {
+			instances = append(instances, inst)
+		}
+	}
+
+	if len(instances) == 0 {
+		return nil
+	}
+
+	logr.Infof("purger: Terminating %d stale instances\n", len(instances))
+
+	err = m.destroy(ctx, pool, instances)
+	if err != nil {
+		return fmt.Errorf("failed to delete instances of pool=%q error: %w", pool.Name, err)
+	}
+	for _, instance := range instances {
+		derr := m.Delete(ctx, instance.ID)
+		if derr != nil {
+			return fmt.Errorf("failed to delete %s from instance store with err: %s", instance.ID, derr)
+		}
+	}
+
+	err = m.buildPool(ctx, pool, serverName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to rebuld pool=%q error: %w", pool.Name, err)
+	}
+
+	return nil
+}
+
 // Provision returns an instance for a job execution and tags it as in use.
 // This method and BuildPool method contain logic for maintaining pool size.
-func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverName, ownerID, resourceClass string, env *config.EnvConfig, query *types.QueryParams) (*types.Instance, error) {
+func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverName, ownerID, resourceClass string, env *config.EnvConfig, query *types.QueryParams) (_ *types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "Manager.Provision", tracing.KeyPool.String(poolName))
+	defer func() { tracing.End(span, err) }()
+
 	m.runnerName = runnerName
 	m.liteEnginePath = env.LiteEngine.Path
 	m.tmate = types.Tmate(env.Tmate)
 
 	pool := m.poolMap[poolName]
 	if pool == nil {
-		return nil, fmt.Errorf("provision: pool name %q not found", poolName)
+		return nil, itypes.NewProvisionError(itypes.ErrorClassConfig, fmt.Errorf("provision: pool name %q not found", poolName))
 	}
 
 	strategy := m.strategy
@@ -332,13 +418,14 @@ func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverNam
 	if len(free) == 0 {
 		pool.Unlock()
 		if canCreate := strategy.CanCreate(pool.MinSize, pool.MaxSize, len(busy), len(free)); !canCreate {
-			return nil, ErrorNoInstanceAvailable
+			return nil, itypes.NewProvisionError(itypes.ErrorClassCapacity, ErrorNoInstanceAvailable)
 		}
 		var inst *types.Instance
 		inst, err = m.setupInstance(ctx, pool, serverName, ownerID, resourceClass, true)
 		if err != nil {
 			return nil, fmt.Errorf("provision: failed to create instance: %w", err)
 		}
+		m.metrics.CountProvision(metric.SourceCold, pool.Name, pool.Driver.DriverName(), inst.Zone)
 		return inst, nil
 	}
 
@@ -349,12 +436,16 @@ func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverNam
 	})
 
 	inst := free[0]
+	span.SetAttributes(tracing.KeyInstance.String(inst.ID))
+	m.accrue(pool, inst, time.Now())
 	inst.State = types.StateInUse
 	inst.OwnerID = ownerID
+	source := metric.SourceRunning
 	if inst.IsHibernated {
 		// update started time after bringing instance from hibernate
 		// this will make sure that purger only picks it when it is actually used for max age
 		inst.Started = time.Now().Unix()
+		source = metric.SourceHibernated
 	}
 	err = m.instanceStore.Update(ctx, inst)
 	if err != nil {
@@ -362,6 +453,7 @@ func (m *Manager) Provision(ctx context.Context, poolName, runnerName, serverNam
 		return nil, fmt.Errorf("provision: failed to tag an instance in %q pool: %w", poolName, err)
 	}
 	pool.Unlock()
+	m.metrics.CountProvision(source, pool.Name, pool.Driver.DriverName(), inst.Zone)
 
 	// the go routine here uses the global context because this function is called
 	// from setup API call (and we can't use HTTP request context for async tasks)
@@ -384,7 +476,7 @@ func (m *Manager) Destroy(ctx context.Context, poolName, instanceID string) erro
 		return err
 	}
 
-	err = pool.Driver.Destroy(ctx, []*types.Instance{instance})
+	err = m.destroy(ctx, pool, []*types.Instance{instance})
 	if err != nil {
 		return fmt.Errorf("provision: failed to destroy an instance of %q pool: %w", poolName, err)
 	}
@@ -422,7 +514,7 @@ func (m *Manager) cleanPool(ctx context.Context, pool *poolEntry, query *types.Q
 		return nil
 	}
 
-	err = pool.Driver.Destroy(ctx, instances)
+	err = m.destroy(ctx, pool, instances)
 	if err != nil {
 		return err
 	}
@@ -509,7 +601,7 @@ func (m *Manager) buildPool(ctx context.Context, pool *poolEntry, tlsServerName
 			instances[i] = instFree[i]
 		}
 
-		err := pool.Driver.Destroy(ctx, instances)
+		err := m.destroy(ctx, pool, instances)
 		if err != nil {
 			logr.WithError(err).Errorln("build pool: failed to destroy excess instances")
 		}
@@ -553,34 +645,31 @@ func (m *Manager) buildPoolWithMutex(ctx context.Context, pool *poolEntry, tlsSe
 	return m.buildPool(ctx, pool, tlsServerName, query)
 }
 
-func (m *Manager) setupInstance(ctx context.Context, pool *poolEntry, tlsServerName, ownerID, resourceClass string, inuse bool) (*types.Instance, error) {
-	var inst *types.Instance
+func (m *Manager) setupInstance(ctx context.Context, pool *poolEntry, tlsServerName, ownerID, resourceClass string, inuse bool) (inst *types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "Manager.setupInstance", tracing.KeyPool.String(pool.Name), attribute.Bool("runner.instance.inuse", inuse))
+	defer func() { tracing.End(span, err) }()
 
-	// generate certs
-	createOptions, err := certs.Generate(m.runnerName, tlsServerName)
-	createOptions.IsHosted = IsHosted(ctx)
-	createOptions.LiteEnginePath = m.liteEnginePath
-	createOptions.Platform = pool.Platform
-	createOptions.PoolName = pool.Name
-	createOptions.Limit = pool.MaxSize
-	createOptions.Pool = pool.MinSize
-	createOptions.HarnessTestBinaryURI = m.harnessTestBinaryURI
-	createOptions.PluginBinaryURI = m.pluginBinaryURI
-	createOptions.Tmate = m.tmate
-	createOptions.AccountID = ownerID
-	createOptions.ResourceClass = resourceClass
+	createOptions, err := m.createOptions(ctx, &pool.Pool, tlsServerName, ownerID, resourceClass)
 	if err != nil {
+		return nil, err
+	}
+	if err = checkUserdata(&pool.Pool, createOptions); err != nil {
 		logrus.WithError(err).
-			Errorln("manager: failed to generate certificates")
+			Errorln("manager: invalid userdata")
 		return nil, err
 	}
 	// create instance
+	created := time.Now()
 	inst, err = pool.Driver.Create(ctx, createOptions)
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("manager: failed to create instance")
 		return nil, err
 	}
+	m.metrics.ObserveInstance(metric.PhaseCreate, pool.Name, pool.Driver.DriverName(), inst.Zone, time.Since(created))
+	if inst.Address != "" {
+		m.metrics.ObserveInstance(metric.PhaseAddress, pool.Name, pool.Driver.DriverName(), inst.Zone, time.Since(created))
+	}
 
 	if inuse {
 		inst.State = types.StateInUse
@@ -593,7 +682,7 @@ func (m *Manager) setupInstance(ctx context.Context, pool *poolEntry, tlsServerN
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("manager: failed to store instance")
-		_ = pool.Driver.Destroy(ctx, []*types.Instance{inst})
+		_ = m.destroy(ctx, pool, []*types.Instance{inst})
 		return nil, err
 	}
 
@@ -608,6 +697,87 @@ func (m *Manager) setupInstance(ctx context.Context, pool *poolEntry, tlsServerN
 	return inst, nil
 }
 
+// createOptions returns the options a new instance of the pool is created
+// with, including freshly generated certificates.
+func (m *Manager) createOptions(ctx context.Context, pool *Pool, tlsServerName, ownerID, resourceClass string) (*types.InstanceCreateOpts, error) {
+	// generate certs
+	var createOptions *types.InstanceCreateOpts
+	var err error
+	if m.ca != nil {
+		createOptions, err = m.ca.Generate(m.runnerName, tlsServerName)
+	} else {
+		createOptions, err = certs.Generate(m.runnerName, tlsServerName)
+	}
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("manager: failed to generate certificates")
+		return nil, itypes.NewProvisionError(itypes.ErrorClassCertificate, err)
+	}
+	createOptions.IsHosted = IsHosted(ctx)
+	createOptions.LiteEnginePath = liteEnginePath(m.liteEnginePath, pool.LiteEngineVersion)
+	createOptions.Prebaked = pool.Prebaked
+	createOptions.UserDataFormat = pool.UserDataFormat
+	createOptions.UserDataParts = pool.UserDataParts
+	createOptions.UserDataGzip = pool.UserDataGzip
+	createOptions.Network = pool.Network
+	createOptions.Platform = pool.Platform
+	createOptions.PoolName = pool.Name
+	createOptions.Limit = pool.MaxSize
+	createOptions.Pool = pool.MinSize
+	createOptions.HarnessTestBinaryURI = m.harnessTestBinaryURI
+	createOptions.PluginBinaryURI = m.pluginBinaryURI
+	createOptions.Checksums = m.checksums
+	createOptions.Tmate = m.tmate
+	createOptions.AccountID = ownerID
+	createOptions.ResourceClass = resourceClass
+	return createOptions, nil
+}
+
+// checkUserdata renders the userdata of a new instance of the pool and
+// checks it against the limit of the provider, which otherwise rejects it
+// with a less helpful error, or truncates it.
+func checkUserdata(pool *Pool, createOptions *types.InstanceCreateOpts) error {
+	limiter, ok := pool.Driver.(UserdataLimiter)
+	if !ok {
+		return nil
+	}
+	userdata, err := lehelper.GenerateUserdata(pool.UserData, createOptions)
+	if err != nil {
+		return itypes.NewProvisionError(itypes.ErrorClassConfig, err)
+	}
+	if limit := limiter.UserdataLimit(); limit > 0 && len(userdata) > limit {
+		return itypes.NewProvisionError(itypes.ErrorClassConfig, fmt.Errorf(
+			"userdata of pool %q is %d bytes, larger than the %d bytes allowed by %s: enable userdata_gzip or shorten the custom userdata",
+			pool.Name, len(userdata), limit, pool.Driver.DriverName()))
+	}
+	return nil
+}
+
+// Userdata returns the userdata a new instance of the pool is created with.
+// If masked, the private key of the instance, the tmate keys and the
+// password of the proxy are replaced.
+func (m *Manager) Userdata(ctx context.Context, poolName, tlsServerName string, masked bool) (string, error) {
+	pool := m.poolMap[poolName]
+	if pool == nil {
+		return "", fmt.Errorf("pool %q not found", poolName)
+	}
+	createOptions, err := m.createOptions(ctx, &pool.Pool, tlsServerName, "", "")
+	if err != nil {
+		return "", err
+	}
+	// shown uncompressed, to be readable.
+	createOptions.UserDataGzip = false
+	if !masked {
+		return lehelper.GenerateUserdata(pool.UserData, createOptions)
+	}
+	createOptions.Network.Proxy = lehelper.RedactURL(createOptions.Network.Proxy)
+	userdata, err := lehelper.GenerateUserdata(pool.UserData, createOptions)
+	if err != nil {
+		return "", err
+	}
+	return lehelper.Mask(userdata, string(createOptions.TLSKey), createOptions.Tmate.RSA, createOptions.Tmate.ED25519), nil
+}
+
 func (m *Manager) StartInstance(ctx context.Context, poolName, instanceID string) (*types.Instance, error) {
 	pool := m.poolMap[poolName]
 	if pool == nil {
@@ -624,10 +794,12 @@ func (m *Manager) StartInstance(ctx context.Context, poolName, instanceID string
 	}
 
 	logrus.WithField("instanceID", instanceID).Infoln("Starting vm from hibernate state")
+	started := time.Now()
 	ipAddress, err := pool.Driver.Start(ctx, instanceID, poolName)
 	if err != nil {
 		return nil, fmt.Errorf("start_instance: failed to start the instance %s of %q pool: %w", instanceID, poolName, err)
 	}
+	m.metrics.ObserveInstance(metric.PhaseStart, pool.Name, pool.Driver.DriverName(), inst.Zone, time.Since(started))
 
 	inst.IsHibernated = false
 	inst.Address = ipAddress
@@ -664,7 +836,10 @@ func (m *Manager) hibernateWithRetries(ctx context.Context, poolName, tlsServerN
 		return nil
 	}
 
-	m.waitForInstanceConnectivity(ctx, tlsServerName, instanceID)
+	waited := time.Now()
+	if inst := m.waitForInstanceConnectivity(ctx, tlsServerName, instanceID); inst != nil {
+		m.metrics.ObserveInstance(metric.PhaseHealthy, pool.Name, pool.Driver.DriverName(), inst.Zone, time.Since(waited))
+	}
 
 	retryCount := 1
 	const maxRetries = 3
@@ -710,18 +885,21 @@ func (m *Manager) hibernate(ctx context.Context, instanceID, poolName string, po
 	pool.Unlock()
 
 	logrus.WithField("instanceID", instanceID).Infoln("Hibernating vm")
+	hibernated := time.Now()
 	if err = pool.Driver.Hibernate(ctx, instanceID, poolName); err != nil {
 		if uerr := m.updateInstState(ctx, pool, instanceID, types.StateCreated); uerr != nil {
 			logrus.WithError(err).WithField("instanceID", instanceID).Errorln("failed to update state for failed hibernation")
 		}
 		return fmt.Errorf("hibernate: failed to hibernated an instance %s of %q pool: %w", instanceID, poolName, err)
 	}
+	m.metrics.ObserveInstance(metric.PhaseHibernate, pool.Name, pool.Driver.DriverName(), inst.Zone, time.Since(hibernated))
 
 	pool.Lock()
 	if inst, err = m.Find(ctx, instanceID); err != nil {
 		pool.Unlock()
 		return fmt.Errorf("hibernate: failed to find the instance in db %s of %q pool: %w", instanceID, poolName, err)
 	}
+	m.accrue(pool, inst, time.Now())
 
 	inst.IsHibernated = true
 	inst.State = types.StateCreated
@@ -763,53 +941,85 @@ func (m *Manager) forEach(ctx context.Context,
 	return nil
 }
 
-func (m *Manager) waitForInstanceConnectivity(ctx context.Context, tlsServerName, instanceID string) {
+// waitForInstanceConnectivity waits until the lite engine of the instance is
+// healthy. It returns the instance, or nil if it never became healthy.
+func (m *Manager) waitForInstanceConnectivity(ctx context.Context, tlsServerName, instanceID string) *types.Instance {
+	ctx, span := tracing.Start(ctx, "Manager.waitForInstanceConnectivity", tracing.KeyInstance.String(instanceID))
+	defer span.End()
+
 	bf := backoff.NewExponentialBackOff()
 	for {
 		duration := bf.NextBackOff()
 		if duration == bf.Stop {
-			return
+			return nil
 		}
 
 		select {
 		case <-ctx.Done():
 			logrus.WithField("instanceID", instanceID).Warnln("hibernate: connectivity check deadline exceeded")
-			return
+			return nil
 		case <-time.After(duration):
-			err := m.checkInstanceConnectivity(ctx, tlsServerName, instanceID)
+			inst, err := m.checkInstanceConnectivity(ctx, tlsServerName, instanceID)
 			if err == nil {
-				return
+				return inst
 			}
 			logrus.WithError(err).WithField("instanceID", instanceID).Traceln("hibernate: instance connectivity check failed")
 		}
 	}
 }
 
-func (m *Manager) checkInstanceConnectivity(ctx context.Context, tlsServerName, instanceID string) error {
+func (m *Manager) checkInstanceConnectivity(ctx context.Context, tlsServerName, instanceID string) (*types.Instance, error) {
 	instance, err := m.Find(ctx, instanceID)
 	if err != nil {
-		return errors.Wrap(err, "failed to find the instance in db")
+		return nil, errors.Wrap(err, "failed to find the instance in db")
 	}
 
 	if instance.Address == "" {
-		return errors.New("instance has not received IP address")
+		return nil, errors.New("instance has not received IP address")
 	}
 
 	endpoint := fmt.Sprintf("https://%s:9079/", instance.Address)
 	client, err := lehttp.NewHTTPClient(endpoint, tlsServerName, string(instance.CACert), string(instance.TLSCert), string(instance.TLSKey))
 	if err != nil {
-		return errors.Wrap(err, "failed to create client")
+		return nil, errors.Wrap(err, "failed to create client")
 	}
 
 	response, err := client.Health(ctx, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !response.OK {
-		return errors.New("health check call failed")
+		return nil, errors.New("health check call failed")
 	}
 
+	return instance, nil
+}
+
+// destroy destroys instances of the pool and records how long it took, how
+// old the instances were and what they cost.
+func (m *Manager) destroy(ctx context.Context, pool *poolEntry, instances []*types.Instance) error {
+	start := time.Now()
+	if err := pool.Driver.Destroy(ctx, instances); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	for _, inst := range instances {
+		m.metrics.ObserveInstance(metric.PhaseDestroy, pool.Name, pool.Driver.DriverName(), inst.Zone, elapsed)
+		if inst.Started != 0 {
+			m.metrics.ObserveInstance(metric.PhaseLifetime, pool.Name, pool.Driver.DriverName(), inst.Zone, start.Sub(time.Unix(inst.Started, 0)))
+		}
+		m.accrue(pool, inst, start)
+		// the runner keeps no history of instance events, the row is deleted
+		// with the instance, so the final cost is only left in the log.
+		if inst.Cost > 0 {
+			logrus.WithField("instance", inst.ID).
+				WithField("pool", pool.Name).
+				WithField("owner", inst.OwnerID).
+				WithField("cost", fmt.Sprintf("%.4f", inst.Cost)).
+				Infoln("manager: estimated cost of the destroyed instance")
+		}
+	}
 	return nil
 }
 
@@ -820,3 +1030,24 @@ func (m *Manager) GetTLSServerName() string {
 func (m *Manager) IsDistributed() bool {
 	return false
 }
+
+// liteEnginePath returns the path to download the lite engine from. A
+// version replaces the last element of the path if that is a version, e.g.
+// v0.5.68, and is appended to the path otherwise. A URL replaces the path.
+func liteEnginePath(path, version string) string {
+	switch {
+	case version == "":
+		return path
+	case strings.Contains(version, "://"):
+		return version
+	}
+	base := strings.TrimSuffix(path, "/")
+	if i := strings.LastIndex(base, "/"); i >= 0 && isVersion(base[i+1:]) {
+		base = base[:i]
+	}
+	return base + "/" + version
+}
+
+func isVersion(s string) bool {
+	return len(s) > 1 && s[0] == 'v' && s[1] >= '0' && s[1] <= '9'
+}
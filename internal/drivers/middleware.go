@@ -0,0 +1,195 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/drone/runner-go/logger"
+)
+
+// Middleware wraps a driver to add a capability, e.g. logging or retries, to
+// all of its calls to the cloud API, whatever the provider.
+type Middleware func(next Driver) Driver
+
+// Chain wraps the driver with the middleware, the first being the outermost.
+func Chain(driver Driver, middleware ...Middleware) Driver {
+	if driver == nil {
+		return nil
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		driver = middleware[i](driver)
+	}
+	return driver
+}
+
+// Interceptor is called around every call of a driver to the cloud API with
+// the name of the method, e.g. Create. It calls the method with call, any
+// number of times, and returns its error.
+type Interceptor func(ctx context.Context, method string, call func(ctx context.Context) error) error
+
+// Intercept returns a middleware calling the interceptor around every call of
+// the driver to the cloud API.
+func Intercept(interceptor Interceptor) Middleware {
+	return func(next Driver) Driver {
+		return &interceptedDriver{Driver: next, intercept: interceptor}
+	}
+}
+
+type interceptedDriver struct {
+	Driver
+	intercept Interceptor
+}
+
+func (d *interceptedDriver) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	err = d.intercept(ctx, "Create", func(ctx context.Context) (err error) {
+		instance, err = d.Driver.Create(ctx, opts)
+		return err
+	})
+	return instance, err
+}
+
+func (d *interceptedDriver) Destroy(ctx context.Context, instances []*types.Instance) error {
+	return d.intercept(ctx, "Destroy", func(ctx context.Context) error {
+		return d.Driver.Destroy(ctx, instances)
+	})
+}
+
+func (d *interceptedDriver) Hibernate(ctx context.Context, instanceID, poolName string) error {
+	return d.intercept(ctx, "Hibernate", func(ctx context.Context) error {
+		return d.Driver.Hibernate(ctx, instanceID, poolName)
+	})
+}
+
+func (d *interceptedDriver) Start(ctx context.Context, instanceID, poolName string) (ipAddress string, err error) {
+	err = d.intercept(ctx, "Start", func(ctx context.Context) (err error) {
+		ipAddress, err = d.Driver.Start(ctx, instanceID, poolName)
+		return err
+	})
+	return ipAddress, err
+}
+
+func (d *interceptedDriver) SetTags(ctx context.Context, instance *types.Instance, tags map[string]string) error {
+	return d.intercept(ctx, "SetTags", func(ctx context.Context) error {
+		return d.Driver.SetTags(ctx, instance, tags)
+	})
+}
+
+func (d *interceptedDriver) Ping(ctx context.Context) error {
+	return d.intercept(ctx, "Ping", func(ctx context.Context) error {
+		return d.Driver.Ping(ctx)
+	})
+}
+
+func (d *interceptedDriver) Logs(ctx context.Context, instanceID string) (logs string, err error) {
+	err = d.intercept(ctx, "Logs", func(ctx context.Context) (err error) {
+		logs, err = d.Driver.Logs(ctx, instanceID)
+		return err
+	})
+	return logs, err
+}
+
+// UserdataLimit returns the limit of the wrapped driver, zero if it has none.
+func (d *interceptedDriver) UserdataLimit() int {
+	return userdataLimit(d.Driver)
+}
+
+func userdataLimit(driver Driver) int {
+	if limiter, ok := driver.(UserdataLimiter); ok {
+		return limiter.UserdataLimit()
+	}
+	return 0
+}
+
+// CanRetryCreate reports whether the wrapped driver may retry the failed
+// creation, false if it does not tell.
+func (d *interceptedDriver) CanRetryCreate(err error) bool {
+	return canRetryCreate(d.Driver, err)
+}
+
+func canRetryCreate(driver Driver, err error) bool {
+	if retrier, ok := driver.(CreateRetrier); ok {
+		return retrier.CanRetryCreate(err)
+	}
+	return false
+}
+
+// Tracing records a span for every call of the driver of the pool.
+func Tracing(pool string) Middleware {
+	return func(next Driver) Driver {
+		return traced(pool, next)
+	}
+}
+
+// Timing records the duration of every call of the driver of the pool in the
+// metrics. It does nothing if the metrics are not registered.
+func Timing(pool string, metrics *metric.Metrics) Middleware {
+	return func(next Driver) Driver {
+		if metrics == nil {
+			return next
+		}
+		driver := next.DriverName()
+		return Intercept(func(ctx context.Context, method string, call func(context.Context) error) error {
+			start := time.Now()
+			err := call(ctx)
+			metrics.ObserveDriverCall(pool, driver, method, err == nil, time.Since(start))
+			return err
+		})(next)
+	}
+}
+
+// Logging logs every call of the driver of the pool with its duration, and
+// its error if it failed.
+func Logging(pool string) Middleware {
+	return func(next Driver) Driver {
+		driver := next.DriverName()
+		return Intercept(func(ctx context.Context, method string, call func(context.Context) error) error {
+			start := time.Now()
+			err := call(ctx)
+			logr := logger.FromContext(ctx).
+				WithField("driver", driver).
+				WithField("pool", pool).
+				WithField("method", method).
+				WithField("duration", time.Since(start).String())
+			if err != nil {
+				logr.WithError(err).Warnln("driver: call failed")
+			} else {
+				logr.Debugln("driver: call complete")
+			}
+			return err
+		})(next)
+	}
+}
+
+// Timeouts limits the duration of the calls of a driver by method, e.g.
+// Create. A call which times out fails with a transient error, so that it
+// can be retried, except Create: the instance may exist by the time it times
+// out, and a retry would create another one.
+func Timeouts(timeouts map[string]time.Duration) Middleware {
+	return func(next Driver) Driver {
+		if len(timeouts) == 0 {
+			return next
+		}
+		return Intercept(func(ctx context.Context, method string, call func(context.Context) error) error {
+			timeout, ok := timeouts[method]
+			if !ok || timeout <= 0 {
+				return call(ctx)
+			}
+			callCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := call(callCtx)
+			if err != nil && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+				// the error of the driver may be classified already, e.g. as unknown
+				class := itypes.ErrorClassTransient
+				if method == "Create" {
+					class = itypes.ErrorClassUnknown
+				}
+				return &itypes.ProvisionError{Class: class, Err: fmt.Errorf("driver: %s timed out after %s: %w", method, timeout, err)}
+			}
+			return err
+		})(next)
+	}
+}
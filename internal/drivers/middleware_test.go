@@ -0,0 +1,129 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// hangingDriver blocks in Ping until the context ends, like a call to an
+// unresponsive cloud API.
+type hangingDriver struct {
+	namedDriver
+}
+
+func (hangingDriver) Ping(ctx context.Context) error {
+	<-ctx.Done()
+	return itypes.NewProvisionError(itypes.ErrorClassUnknown, ctx.Err())
+}
+
+func (hangingDriver) UserdataLimit() int { return 16384 }
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return Intercept(func(ctx context.Context, method string, call func(context.Context) error) error {
+			calls = append(calls, name+" "+method)
+			return call(ctx)
+		})
+	}
+	flaky := &flakyDriver{}
+	d := Chain(flaky, record("outer"), record("inner"))
+
+	inst, err := d.Create(context.Background(), &types.InstanceCreateOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst == nil || inst.ID != "i-1" {
+		t.Errorf("want the instance of the driver, got %v", inst)
+	}
+	if want := []string{"outer Create", "inner Create"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("want calls %v, got %v", want, calls)
+	}
+	if got := d.DriverName(); got != "amazon" {
+		t.Errorf("want the name of the driver, got %q", got)
+	}
+
+	if got := Chain(nil, record("outer")); got != nil {
+		t.Errorf("want no driver, got %v", got)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	d := Chain(hangingDriver{}, Timeouts(map[string]time.Duration{"Ping": 10 * time.Millisecond}))
+
+	err := d.Ping(context.Background())
+	if itypes.ClassOf(err) != itypes.ErrorClassTransient {
+		t.Errorf("want a transient error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want the error of the driver, got %v", err)
+	}
+	if got := d.(UserdataLimiter).UserdataLimit(); got != 16384 {
+		t.Errorf("want the userdata limit of the driver, got %d", got)
+	}
+
+	// a canceled call is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.Ping(ctx); itypes.ClassOf(err) == itypes.ErrorClassTransient {
+		t.Errorf("want the error of the driver, got %v", err)
+	}
+}
+
+// launchingDriver launches an instance in Create, then hangs until the
+// context ends before it has an address, like a slow cloud.
+type launchingDriver struct {
+	namedDriver
+	launched int
+}
+
+func (d *launchingDriver) Create(ctx context.Context, _ *types.InstanceCreateOpts) (*types.Instance, error) {
+	d.launched++
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTimeouts_Create(t *testing.T) {
+	defer func(interval time.Duration) { retryInitialInterval = interval }(retryInitialInterval)
+	retryInitialInterval = time.Millisecond
+
+	launching := &launchingDriver{}
+	metrics := &metric.Metrics{ThrottledCount: metric.ThrottledCount()}
+	d := Chain(launching,
+		RateLimiting("linux", RateLimit{Retries: 3}, metrics),
+		Timeouts(map[string]time.Duration{"Create": 10 * time.Millisecond}))
+
+	_, err := d.Create(context.Background(), &types.InstanceCreateOpts{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want the creation to time out, got %v", err)
+	}
+	if itypes.ClassOf(err) == itypes.ErrorClassTransient {
+		t.Errorf("want a timed out creation not to be transient, got %v", err)
+	}
+	// a retry would launch another instance while the first may exist
+	if launching.launched != 1 {
+		t.Errorf("want 1 instance launched, got %d", launching.launched)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	metrics := &metric.Metrics{DriverCallDuration: metric.DriverCallDuration()}
+	d := Chain(&flakyDriver{failures: 1, err: errors.New("boom")}, Timing("linux", metrics))
+
+	for i := 0; i < 2; i++ {
+		_, _ = d.Create(context.Background(), &types.InstanceCreateOpts{})
+	}
+	// a series for the failed call and one for the successful call
+	if got := testutil.CollectAndCount(metrics.DriverCallDuration); got != 2 {
+		t.Errorf("want 2 series observed, got %d", got)
+	}
+}
@@ -203,7 +203,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (*t
 		Platform: opts.Platform,
 		State:    types.StateCreated,
 		CACert:   opts.CACert,
-		CAKey:    opts.CAKey,
 		TLSCert:  opts.TLSCert,
 		TLSKey:   opts.TLSKey,
 		Provider: types.Nomad,
@@ -682,7 +681,10 @@ func generateStartupScript(opts *types.InstanceCreateOpts) string {
 		LiteEnginePath:       opts.LiteEnginePath,
 		HarnessTestBinaryURI: opts.HarnessTestBinaryURI,
 		PluginBinaryURI:      opts.PluginBinaryURI,
+		Checksums:            opts.Checksums,
+		Prebaked:             opts.Prebaked,
 		Tmate:                opts.Tmate,
+		Network:              opts.Network,
 	}
 	return cloudinit.LinuxBash(params)
 }
@@ -23,10 +23,6 @@ type config struct {
 
 func New(opts ...Option) (drivers.Driver, error) {
 	p := new(config)
-	for _, opt := range opts {
-		opt(p)
-	}
-
 	p.hibernateWaitSecs = 5
 	p.startWaitSecs = 10
 	p.createWaitSecs = 15
@@ -34,6 +30,9 @@ func New(opts ...Option) (drivers.Driver, error) {
 	p.tagWaitSecs = 1
 	p.leIP = "127.0.0.1"
 
+	for _, opt := range opts {
+		opt(p)
+	}
 	return p, nil
 }
 
@@ -49,7 +48,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Platform:     opts.Platform,
 		Address:      p.leIP,
 		CACert:       opts.CACert,
-		CAKey:        opts.CAKey,
 		TLSCert:      opts.TLSCert,
 		TLSKey:       opts.TLSKey,
 		Started:      time.Now().Unix(),
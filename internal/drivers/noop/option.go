@@ -14,3 +14,15 @@ func WithHibernate(hibernate bool) Option {
 		p.hibernate = hibernate
 	}
 }
+
+// WithoutWaits returns instantly from the calls, which otherwise take as
+// long as those of a cloud.
+func WithoutWaits() Option {
+	return func(p *config) {
+		p.hibernateWaitSecs = 0
+		p.startWaitSecs = 0
+		p.createWaitSecs = 0
+		p.destroyWaitSecs = 0
+		p.tagWaitSecs = 0
+	}
+}
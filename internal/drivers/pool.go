@@ -19,6 +19,31 @@ type Pool struct {
 
 	Platform types.Platform
 
+	// Prebaked skips downloading binaries already in the image.
+	Prebaked bool
+	// LiteEngineVersion overrides the version of the lite engine.
+	LiteEngineVersion string
+	// Network configures the proxy, trusted certificates and mirrors.
+	Network types.Network
+	// UserData is the custom userdata template, empty for the built-in ones.
+	UserData string
+	// UserDataFormat selects the built-in userdata, cloud-init or ignition.
+	UserDataFormat string
+	// UserDataParts are added to the cloud-config as multipart MIME.
+	UserDataParts []types.UserDataPart
+	// UserDataGzip compresses the userdata.
+	UserDataGzip bool
+	// HourlyCost is the estimated cost per hour of an instance, HourlyCosts
+	// the cost by instance size used if it is not set.
+	HourlyCost  float64
+	HourlyCosts map[string]float64
+	// HibernatedHourlyCost is the estimated cost per hour of a hibernated instance.
+	HibernatedHourlyCost float64
+	// RateLimit limits and retries the calls to the cloud API.
+	RateLimit RateLimit
+	// Middleware wraps the driver of the pool, the first being the outermost.
+	Middleware []Middleware
+
 	Driver Driver
 }
 
@@ -36,3 +61,27 @@ type Driver interface {
 	DriverName() string
 	CanHibernate() bool
 }
+
+// WeightedPool is one of the pools a virtual pool resolves to, picked at
+// random proportionally to its weight.
+type WeightedPool struct {
+	Pool   string
+	Weight int
+}
+
+// UserdataLimiter is implemented by drivers whose provider limits the size
+// of the userdata.
+type UserdataLimiter interface {
+	// UserdataLimit returns the maximum size of the userdata in bytes.
+	UserdataLimit() int
+}
+
+// CreateRetrier is implemented by drivers whose calls to Create may fail
+// before any resource exists, e.g. when the launch of the instance is
+// throttled. Only those failures of Create are retried, a retry of any other
+// may create a second instance while the first one leaks.
+type CreateRetrier interface {
+	// CanRetryCreate reports whether the error of Create was raised before
+	// any resource was created.
+	CanRetryCreate(err error) bool
+}
@@ -0,0 +1,112 @@
+package drivers
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/metric"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit limits the calls of a pool to the cloud API, so that bursts of
+// instance creations do not trip the throttling of the provider, and retries
+// the calls that failed with a transient error anyway. Create is retried only
+// on the errors the driver reports as raised before any resource existed.
+type RateLimit struct {
+	// Rate is the number of calls per second, Burst the number of calls
+	// which may be made at once. There is no limit if Rate is zero.
+	Rate  float64
+	Burst int
+	// Retries is the number of times a call failing with a transient error,
+	// e.g. throttling, is retried with exponential backoff and jitter.
+	Retries int
+}
+
+// retryInitialInterval is the wait before the first retry, it grows up to
+// retryMaxInterval.
+var (
+	retryInitialInterval = 2 * time.Second
+	retryMaxInterval     = time.Minute
+)
+
+// RateLimiting waits for the rate limit of the pool before every call of the
+// driver, and retries the calls while they fail with a transient error and
+// retries are left. A failed Create may have created an instance already, so
+// it is retried only if the driver, as a CreateRetrier, says it may be. The
+// throttled calls are counted in the metrics.
+func RateLimiting(pool string, limit RateLimit, metrics *metric.Metrics) Middleware {
+	return func(next Driver) Driver {
+		if limit.Rate <= 0 && limit.Retries <= 0 {
+			return next
+		}
+		var limiter *rate.Limiter
+		if limit.Rate > 0 {
+			burst := limit.Burst
+			if burst < 1 {
+				burst = 1
+			}
+			limiter = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+		}
+		driver := next.DriverName()
+
+		// wait waits until the rate limit allows a call.
+		wait := func(ctx context.Context, method string) error {
+			if limiter == nil {
+				return nil
+			}
+			r := limiter.Reserve()
+			delay := r.Delay()
+			if delay == 0 {
+				return nil
+			}
+			metrics.CountThrottled(pool, driver, method, metric.ThrottleRateLimit)
+			t := time.NewTimer(delay)
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				r.Cancel()
+				return ctx.Err()
+			case <-t.C:
+				return nil
+			}
+		}
+
+		return Intercept(func(ctx context.Context, method string, call func(context.Context) error) error {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = retryInitialInterval
+			b.MaxInterval = retryMaxInterval
+			b.MaxElapsedTime = 0
+
+			operation := func() error {
+				if err := wait(ctx, method); err != nil {
+					return backoff.Permanent(err)
+				}
+				err := call(ctx)
+				if err == nil {
+					return nil
+				}
+				retry := itypes.ClassOf(err) == itypes.ErrorClassTransient
+				if method == "Create" {
+					retry = canRetryCreate(next, err)
+				}
+				if !retry {
+					return backoff.Permanent(err)
+				}
+				return err
+			}
+			notify := func(err error, wait time.Duration) {
+				metrics.CountThrottled(pool, driver, method, metric.ThrottleRetry)
+				logrus.WithError(err).
+					WithField("pool", pool).
+					WithField("method", method).
+					WithField("wait", wait).
+					Warnln("driver: retrying the call after a transient error")
+			}
+			return backoff.RetryNotify(operation, backoff.WithContext(backoff.WithMaxRetries(b, uint64(limit.Retries)), ctx), notify)
+		})(next)
+	}
+}
@@ -0,0 +1,127 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+	"github.com/drone-runners/drone-runner-aws/metric"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flakyDriver fails the first calls to Create with the error.
+type flakyDriver struct {
+	namedDriver
+	failures int
+	err      error
+	calls    int
+}
+
+func (d *flakyDriver) Create(context.Context, *types.InstanceCreateOpts) (*types.Instance, error) {
+	d.calls++
+	if d.calls <= d.failures {
+		return nil, d.err
+	}
+	return &types.Instance{ID: "i-1"}, nil
+}
+
+func (d *flakyDriver) Ping(context.Context) error {
+	return nil
+}
+
+// launchThrottledDriver reports the transient errors of the flaky driver as
+// raised before any instance was launched, like a throttled launch.
+type launchThrottledDriver struct {
+	*flakyDriver
+}
+
+func (launchThrottledDriver) CanRetryCreate(err error) bool {
+	return itypes.ClassOf(err) == itypes.ErrorClassTransient
+}
+
+func TestRateLimiting_Retry(t *testing.T) {
+	defer func(interval time.Duration) { retryInitialInterval = interval }(retryInitialInterval)
+	retryInitialInterval = time.Millisecond
+
+	throttled := itypes.NewProvisionError(itypes.ErrorClassTransient, errors.New("RequestLimitExceeded"))
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		retrier   bool
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "retried until it succeeds", failures: 2, err: throttled, retrier: true, wantCalls: 3},
+		{name: "retries exhausted", failures: 5, err: throttled, retrier: true, wantCalls: 4, wantErr: true},
+		{name: "not transient", failures: 1, err: itypes.NewProvisionError(itypes.ErrorClassQuota, errors.New("VcpuLimitExceeded")), retrier: true, wantCalls: 1, wantErr: true},
+		{name: "not retried by the driver", failures: 1, err: throttled, wantCalls: 1, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := &metric.Metrics{ThrottledCount: metric.ThrottledCount()}
+			flaky := &flakyDriver{failures: test.failures, err: test.err}
+			var next Driver = flaky
+			if test.retrier {
+				next = launchThrottledDriver{flaky}
+			}
+			d := RateLimiting("linux", RateLimit{Retries: 3}, metrics)(next)
+
+			inst, err := d.Create(context.Background(), &types.InstanceCreateOpts{})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, test.err) {
+				t.Errorf("want the error of the driver, got %v", err)
+			}
+			if err == nil && inst.ID != "i-1" {
+				t.Errorf("want the instance of the driver, got %v", inst)
+			}
+			if flaky.calls != test.wantCalls {
+				t.Errorf("want %d calls, got %d", test.wantCalls, flaky.calls)
+			}
+			retries := testutil.ToFloat64(metrics.ThrottledCount.WithLabelValues("linux", "amazon", "Create", metric.ThrottleRetry))
+			if int(retries) != test.wantCalls-1 {
+				t.Errorf("want %d retries counted, got %v", test.wantCalls-1, retries)
+			}
+		})
+	}
+}
+
+func TestRateLimiting_RateLimit(t *testing.T) {
+	metrics := &metric.Metrics{ThrottledCount: metric.ThrottledCount()}
+	d := RateLimiting("linux", RateLimit{Rate: 20, Burst: 2}, metrics)(&flakyDriver{})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := d.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst is free, the two calls after it wait 50ms each
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Errorf("want the calls after the burst to be delayed, took %s", elapsed)
+	}
+	if got := testutil.ToFloat64(metrics.ThrottledCount.WithLabelValues("linux", "amazon", "Ping", metric.ThrottleRateLimit)); got != 2 {
+		t.Errorf("want 2 throttled calls, got %v", got)
+	}
+
+	slow := RateLimiting("linux", RateLimit{Rate: 0.001}, metrics)(&flakyDriver{})
+	if err := slow.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := slow.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("want the wait to end with the context, got %v", err)
+	}
+
+	driver := &flakyDriver{}
+	if got := RateLimiting("linux", RateLimit{}, metrics)(driver); got != driver {
+		t.Errorf("want the driver unwrapped without a rate limit")
+	}
+}
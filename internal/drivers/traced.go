@@ -0,0 +1,90 @@
+package drivers
+
+import (
+	"context"
+
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDriver records a span for every call to the cloud API of a driver.
+type tracedDriver struct {
+	Driver
+	pool string
+}
+
+// traced wraps the driver of a pool with tracing, once.
+func traced(pool string, driver Driver) Driver {
+	if driver == nil {
+		return nil
+	}
+	if _, ok := driver.(*tracedDriver); ok {
+		return driver
+	}
+	return &tracedDriver{Driver: driver, pool: pool}
+}
+
+func (d *tracedDriver) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, tracing.KeyPool.String(d.pool), tracing.KeyDriver.String(d.DriverName()))
+	return tracing.Start(ctx, "Driver."+method, attrs...)
+}
+
+func (d *tracedDriver) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
+	ctx, span := d.start(ctx, "Create")
+	defer func() { tracing.End(span, err) }()
+	instance, err = d.Driver.Create(ctx, opts)
+	if instance != nil {
+		span.SetAttributes(tracing.KeyInstance.String(instance.ID), attribute.String("runner.instance.zone", instance.Zone))
+	}
+	return instance, err
+}
+
+func (d *tracedDriver) Destroy(ctx context.Context, instances []*types.Instance) (err error) {
+	ctx, span := d.start(ctx, "Destroy", attribute.Int("runner.instances", len(instances)))
+	defer func() { tracing.End(span, err) }()
+	return d.Driver.Destroy(ctx, instances)
+}
+
+func (d *tracedDriver) Hibernate(ctx context.Context, instanceID, poolName string) (err error) {
+	ctx, span := d.start(ctx, "Hibernate", tracing.KeyInstance.String(instanceID))
+	defer func() { tracing.End(span, err) }()
+	return d.Driver.Hibernate(ctx, instanceID, poolName)
+}
+
+func (d *tracedDriver) Start(ctx context.Context, instanceID, poolName string) (ipAddress string, err error) {
+	ctx, span := d.start(ctx, "Start", tracing.KeyInstance.String(instanceID))
+	defer func() { tracing.End(span, err) }()
+	return d.Driver.Start(ctx, instanceID, poolName)
+}
+
+func (d *tracedDriver) SetTags(ctx context.Context, instance *types.Instance, tags map[string]string) (err error) {
+	ctx, span := d.start(ctx, "SetTags", tracing.KeyInstance.String(instance.ID))
+	defer func() { tracing.End(span, err) }()
+	return d.Driver.SetTags(ctx, instance, tags)
+}
+
+func (d *tracedDriver) Ping(ctx context.Context) (err error) {
+	ctx, span := d.start(ctx, "Ping")
+	defer func() { tracing.End(span, err) }()
+	return d.Driver.Ping(ctx)
+}
+
+func (d *tracedDriver) Logs(ctx context.Context, instanceID string) (logs string, err error) {
+	ctx, span := d.start(ctx, "Logs", tracing.KeyInstance.String(instanceID))
+	defer func() { tracing.End(span, err) }()
+	return d.Driver.Logs(ctx, instanceID)
+}
+
+// UserdataLimit returns the limit of the wrapped driver, zero if it has none.
+func (d *tracedDriver) UserdataLimit() int {
+	return userdataLimit(d.Driver)
+}
+
+// CanRetryCreate reports whether the wrapped driver may retry the failed
+// creation, false if it does not tell.
+func (d *tracedDriver) CanRetryCreate(err error) bool {
+	return canRetryCreate(d.Driver, err)
+}
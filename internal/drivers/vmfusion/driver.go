@@ -88,7 +88,10 @@ func (p *config) Logs(ctx context.Context, instance string) (string, error) {
 }
 
 func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (instance *types.Instance, err error) {
-	uData := lehelper.GenerateUserdata(p.userData, opts)
+	uData, err := lehelper.GenerateUserdata(p.userData, opts)
+	if err != nil {
+		return nil, err
+	}
 	machineName := fmt.Sprintf(opts.RunnerName+"-"+"-%d", time.Now().Unix())
 
 	p.MachineName = machineName
@@ -200,7 +203,6 @@ func (p *config) Create(ctx context.Context, opts *types.InstanceCreateOpts) (in
 		Platform: opts.Platform,
 		Address:  instanceIP,
 		CACert:   opts.CACert,
-		CAKey:    opts.CAKey,
 		TLSCert:  opts.TLSCert,
 		TLSKey:   opts.TLSKey,
 		Started:  startTime.Unix(),
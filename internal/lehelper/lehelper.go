@@ -1,7 +1,11 @@
 package lehelper
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/drone-runners/drone-runner-aws/internal/cloudinit"
@@ -15,7 +19,11 @@ const (
 	LiteEnginePort = 9079
 )
 
-func GenerateUserdata(userdata string, opts *types.InstanceCreateOpts) string {
+// GenerateUserdata renders the userdata of an instance, from the custom
+// template if set and from the built-in template of its platform otherwise.
+// The parts of the pool are added as multipart MIME, and the result is
+// gzip compressed if enabled.
+func GenerateUserdata(userdata string, opts *types.InstanceCreateOpts) (string, error) {
 	var params = cloudinit.Params{
 		Platform:             opts.Platform,
 		CACert:               string(opts.CACert),
@@ -25,30 +33,84 @@ func GenerateUserdata(userdata string, opts *types.InstanceCreateOpts) string {
 		LiteEngineLogsPath:   oshelp.GetLiteEngineLogsPath(opts.Platform.OS),
 		HarnessTestBinaryURI: opts.HarnessTestBinaryURI,
 		PluginBinaryURI:      opts.PluginBinaryURI,
+		Checksums:            opts.Checksums,
+		Prebaked:             opts.Prebaked,
 		Tmate:                opts.Tmate,
+		Network:              opts.Network,
 		IsHosted:             opts.IsHosted,
 	}
 
-	if userdata == "" {
-		if opts.Platform.OS == oshelp.OSWindows {
-			userdata = cloudinit.Windows(&params)
-		} else if opts.Platform.OS == oshelp.OSMac {
-			userdata = cloudinit.Mac(&params)
-		} else {
-			userdata = cloudinit.Linux(&params)
+	if len(opts.UserDataParts) == 0 && !opts.UserDataGzip {
+		return render(userdata, &params, opts)
+	}
+	if opts.Platform.OS == oshelp.OSWindows || opts.Platform.OS == oshelp.OSMac || opts.UserDataFormat == cloudinit.FormatIgnition {
+		return "", errors.New("userdata parts and gzip compression are only supported by cloud-init on linux")
+	}
+	userdata, err := render(userdata, &params, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(opts.UserDataParts) != 0 {
+		if userdata, err = cloudinit.Multipart(userdata, opts.UserDataParts...); err != nil {
+			return "", err
 		}
-	} else {
-		userdata, _ = cloudinit.Custom(userdata, &params)
+	}
+	if opts.UserDataGzip {
+		return cloudinit.Gzip(userdata)
+	}
+	return userdata, nil
+}
+
+func render(userdata string, params *cloudinit.Params, opts *types.InstanceCreateOpts) (string, error) {
+	if userdata != "" {
+		return cloudinit.Custom(userdata, params)
+	}
+	switch {
+	case opts.UserDataFormat == cloudinit.FormatIgnition:
+		return cloudinit.Ignition(params)
+	case opts.Platform.OS == oshelp.OSWindows:
+		return cloudinit.Windows(params), nil
+	case opts.Platform.OS == oshelp.OSMac:
+		return cloudinit.Mac(params), nil
+	default:
+		return cloudinit.Linux(params), nil
+	}
+}
+
+// masked replaces secrets in userdata shown to users.
+const masked = "********"
+
+// Mask replaces the secrets in the userdata, as is and base64 encoded.
+func Mask(userdata string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		userdata = strings.ReplaceAll(userdata, secret, masked)
+		userdata = strings.ReplaceAll(userdata, base64.StdEncoding.EncodeToString([]byte(secret)), masked)
 	}
 	return userdata
 }
 
+// RedactURL replaces the password of a URL.
+func RedactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
+
 func GetClient(instance *types.Instance, serverName string, liteEnginePort int64, mock bool, mockTimeoutSecs int) (lehttp.Client, error) {
 	leURL := fmt.Sprintf("https://%s:%d/", instance.Address, liteEnginePort)
 	if mock {
-		return lehttp.NewNoopClient(&api.PollStepResponse{}, nil, time.Duration(mockTimeoutSecs)*time.Second, 0, 0), nil
+		return &tracedClient{client: lehttp.NewNoopClient(&api.PollStepResponse{}, nil, time.Duration(mockTimeoutSecs)*time.Second, 0, 0), instanceID: instance.ID}, nil
 	}
-	return lehttp.NewHTTPClient(leURL,
+	client, err := lehttp.NewHTTPClient(leURL,
 		serverName, string(instance.CACert),
 		string(instance.TLSCert), string(instance.TLSKey))
+	if err != nil {
+		return nil, err
+	}
+	return &tracedClient{client: client, instanceID: instance.ID}, nil
 }
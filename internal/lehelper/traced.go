@@ -0,0 +1,83 @@
+package lehelper
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
+	"github.com/harness/lite-engine/api"
+	lehttp "github.com/harness/lite-engine/cli/client"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient records a span for every call to the lite engine.
+type tracedClient struct {
+	client     lehttp.Client
+	instanceID string
+}
+
+func (c *tracedClient) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, tracing.KeyInstance.String(c.instanceID))
+	return tracing.Start(ctx, "LiteEngine."+method, attrs...)
+}
+
+func (c *tracedClient) Setup(ctx context.Context, in *api.SetupRequest) (resp *api.SetupResponse, err error) {
+	ctx, span := c.start(ctx, "Setup")
+	defer func() { tracing.End(span, err) }()
+	return c.client.Setup(ctx, in)
+}
+
+func (c *tracedClient) Destroy(ctx context.Context, in *api.DestroyRequest) (resp *api.DestroyResponse, err error) {
+	ctx, span := c.start(ctx, "Destroy")
+	defer func() { tracing.End(span, err) }()
+	return c.client.Destroy(ctx, in)
+}
+
+func (c *tracedClient) RetryStartStep(ctx context.Context, in *api.StartStepRequest) (resp *api.StartStepResponse, err error) {
+	ctx, span := c.start(ctx, "RetryStartStep", tracing.KeyStep.String(in.ID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.RetryStartStep(ctx, in)
+}
+
+func (c *tracedClient) StartStep(ctx context.Context, in *api.StartStepRequest) (resp *api.StartStepResponse, err error) {
+	ctx, span := c.start(ctx, "StartStep", tracing.KeyStep.String(in.ID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.StartStep(ctx, in)
+}
+
+func (c *tracedClient) PollStep(ctx context.Context, in *api.PollStepRequest) (resp *api.PollStepResponse, err error) {
+	ctx, span := c.start(ctx, "PollStep", tracing.KeyStep.String(in.ID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.PollStep(ctx, in)
+}
+
+func (c *tracedClient) RetryPollStep(ctx context.Context, in *api.PollStepRequest, timeout time.Duration) (resp *api.PollStepResponse, err error) {
+	ctx, span := c.start(ctx, "RetryPollStep", tracing.KeyStep.String(in.ID))
+	defer func() { tracing.End(span, err) }()
+	resp, err = c.client.RetryPollStep(ctx, in, timeout)
+	if resp != nil {
+		span.SetAttributes(attribute.Int("runner.step.exit_code", resp.ExitCode))
+	}
+	return resp, err
+}
+
+func (c *tracedClient) GetStepLogOutput(ctx context.Context, in *api.StreamOutputRequest, w io.Writer) (err error) {
+	ctx, span := c.start(ctx, "GetStepLogOutput", tracing.KeyStep.String(in.ID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.GetStepLogOutput(ctx, in, w)
+}
+
+func (c *tracedClient) Health(ctx context.Context, performDNSLookup bool) (resp *api.HealthResponse, err error) {
+	ctx, span := c.start(ctx, "Health")
+	defer func() { tracing.End(span, err) }()
+	return c.client.Health(ctx, performDNSLookup)
+}
+
+func (c *tracedClient) RetryHealth(ctx context.Context, timeout time.Duration, performDNSLookup bool) (resp *api.HealthResponse, err error) {
+	ctx, span := c.start(ctx, "RetryHealth")
+	defer func() { tracing.End(span, err) }()
+	return c.client.RetryHealth(ctx, timeout, performDNSLookup)
+}
@@ -31,10 +31,16 @@ const (
 
 func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool, error) { //nolint
 	var pools = []drivers.Pool{}
+	var middleware = map[string][]drivers.Middleware{}
 
 	for i := range poolFile.Instances {
 		instance := poolFile.Instances[i]
 		logrus.Infoln(fmt.Sprintf("Parsing pool '%s', of type '%s'", instance.Name, instance.Type))
+		chain, err := mapMiddleware(&instance)
+		if err != nil {
+			return nil, fmt.Errorf("%s pool parsing failed: %w", instance.Name, err)
+		}
+		middleware[instance.Name] = chain
 		switch instance.Type {
 		case string(types.VMFusion):
 			var v, ok = instance.Spec.(*config.VMFusion)
@@ -77,10 +83,15 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				return nil, platformErr
 			}
 			instance.Platform = *platform
-			var driver, err = amazon.New(
+			creds, err := newCredentials(a.Account.Credentials, instance.Type, a.Account.Region)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			driver, err := amazon.New(
 				amazon.WithAccessKeyID(a.Account.AccessKeyID),
 				amazon.WithSecretAccessKey(a.Account.AccessKeySecret),
 				amazon.WithSessionToken(a.Account.SessionToken),
+				amazon.WithCredentials(creds),
 				amazon.WithZone(a.Account.AvailabilityZone),
 				amazon.WithKeyPair(a.Account.KeyPairName),
 				amazon.WithDeviceName(a.DeviceName, instance.Platform.OSName),
@@ -114,18 +125,23 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 		case string(types.Azure):
 			var az, ok = instance.Spec.(*config.Azure)
 			if !ok {
-				logrus.Errorln("unable to parse pool file")
+				return nil, fmt.Errorf("%s pool parsing failed", instance.Name)
 			}
 			// set platform defaults
 			platform, platformErr := azure.SetPlatformDefaults(&instance.Platform)
 			if platformErr != nil {
-				logrus.WithError(platformErr).WithField("driver", instance.Type)
+				return nil, platformErr
 			}
 			instance.Platform = *platform
-			var driver, err = azure.New(
+			creds, err := newCredentials(az.Account.Credentials, instance.Type, az.Location)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
+			driver, err := azure.New(
 				azure.WithSubscriptionID(az.Account.SubscriptionID),
 				azure.WithClientID(az.Account.ClientID),
 				azure.WithClientSecret(az.Account.ClientSecret),
+				azure.WithCredentials(creds),
 				azure.WithTenantID(az.Account.TenantID),
 				azure.WithResourceGroupName(az.ResourceGroup),
 				azure.WithUserDataKey(az.UserDataKey, instance.Platform.OS),
@@ -220,8 +236,13 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 				return nil, platformErr
 			}
 			instance.Platform = *platform
+			creds, err := newCredentials(do.Account.Credentials, instance.Type, do.Account.Region)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create %s pool '%s': %v", instance.Type, instance.Name, err)
+			}
 			driver, err := digitalocean.New(
 				digitalocean.WithPAT(do.Account.PAT),
+				digitalocean.WithCredentials(creds),
 				digitalocean.WithRegion(do.Account.Region),
 				digitalocean.WithSize(do.Size),
 				digitalocean.WithFirewallID(do.FirewallID),
@@ -339,6 +360,13 @@ func ProcessPool(poolFile *config.PoolFile, runnerName string) ([]drivers.Pool,
 			return nil, fmt.Errorf("unknown instance tip %s", instance.Type)
 		}
 	}
+	for i := range pools {
+		pools[i].HourlyCosts = poolFile.HourlyCosts
+		pools[i].Middleware = middleware[pools[i].Name]
+	}
+	if err := prerender(poolFile, pools); err != nil {
+		return nil, err
+	}
 	return pools, nil
 }
 
@@ -360,6 +388,26 @@ func mapPool(instance *config.Instance, runnerName string) (pool drivers.Pool) {
 		MaxSize:    instance.Limit,
 		MinSize:    instance.Pool,
 		Platform:   instance.Platform,
+
+		Prebaked:          instance.Prebaked,
+		LiteEngineVersion: instance.LiteEngineVersion,
+		UserDataFormat:    instance.UserDataFormat,
+		UserDataParts:     instance.UserDataParts,
+		UserDataGzip:      instance.UserDataGzip,
+
+		HourlyCost:           instance.HourlyCost,
+		HibernatedHourlyCost: instance.HibernatedHourlyCost,
+		RateLimit: drivers.RateLimit{
+			Rate:    instance.RateLimit.Rate,
+			Burst:   instance.RateLimit.Burst,
+			Retries: instance.RateLimit.Retries,
+		},
+		Network: types.Network{
+			Proxy:    instance.Proxy,
+			NoProxy:  instance.NoProxy,
+			CABundle: instance.CABundle,
+			Mirrors:  instance.Mirrors,
+		},
 	}
 	return pool
 }
@@ -402,8 +450,17 @@ func ConfigPoolFile(path string, conf *config.EnvConfig) (pool *config.PoolFile,
 					"for digitalocean DIGITALOCEAN_PAT")
 		}
 	}
-	pool, err = config.ParseFile(path)
+	pool, err = LoadFiles(path)
 	if err != nil {
+		var verrs ValidationErrors
+		if errors.As(err, &verrs) {
+			for _, verr := range verrs {
+				logrus.WithField("path", verr.File).
+					WithField("line", verr.Line).
+					Errorln(verr.Message)
+			}
+			return nil, fmt.Errorf("invalid pool file %s: %w", path, err)
+		}
 		logrus.WithError(err).
 			WithField("path", path).
 			Errorln("exec: unable to parse pool file")
@@ -452,7 +509,7 @@ func createAmazonPool(accessKeyID, accessKeySecret, region string, minPoolSize,
 		},
 	}
 	poolfile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
@@ -477,7 +534,7 @@ func createDigitalOceanPool(pat string, minPoolSize, maxPoolSize int) *config.Po
 		},
 	}
 	poolfile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
@@ -502,7 +559,7 @@ func createHetznerPool(token string, minPoolSize, maxPoolSize int) *config.PoolF
 		},
 	}
 	poolfile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
@@ -531,7 +588,7 @@ func createGooglePool(projectID, path, zone string, minPoolSize, maxPoolSize int
 		},
 	}
 	poolfile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
@@ -554,7 +611,7 @@ func createAnkaPool(vmName string, minPoolSize, maxPoolSize int) *config.PoolFil
 		},
 	}
 	poolfile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
@@ -579,7 +636,7 @@ func createAnkaBuildPool(vmName, url, token string, minPoolSize, maxPoolSize int
 		},
 	}
 	poolfile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
@@ -615,7 +672,7 @@ func createAzurePool(clientID, clientSecret, subscriptionID, tenantID string, mi
 		},
 	}
 	poolFile := config.PoolFile{
-		Version:   "1",
+		Version:   config.LatestVersion,
 		Instances: []config.Instance{instance},
 	}
 
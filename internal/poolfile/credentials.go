@@ -0,0 +1,123 @@
+package poolfile
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/credentials"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// credential providers configurable in the pool file.
+const (
+	providerFile        = "file"
+	providerEnv         = "env"
+	providerHTTP        = "http"
+	providerAssumeRole  = "assume_role"
+	providerWebIdentity = "web_identity"
+)
+
+const defaultCredentialsRefresh = 5 * time.Minute
+
+// credentialKeys lists, per instance type, the credentials read from a
+// provider. The first ones are required. The other instance types, e.g.
+// Hetzner and Nomad, only take the credentials set in the pool file.
+var credentialKeys = map[string]struct {
+	required []string
+	optional []string
+}{
+	string(types.Amazon):       {required: []string{credentials.AccessKeyID, credentials.AccessKeySecret}, optional: []string{credentials.SessionToken}},
+	string(types.Azure):        {required: []string{credentials.ClientSecret}},
+	string(types.DigitalOcean): {required: []string{credentials.PAT}},
+}
+
+// validateCredentials checks the credentials configuration of an instance type.
+func validateCredentials(c *config.Credentials, instanceType string) error {
+	if _, ok := credentialKeys[instanceType]; !ok {
+		return fmt.Errorf("credential providers are not supported by %s", instanceType)
+	}
+	missing := func(field string) error {
+		return fmt.Errorf("credential provider %s requires %s", c.Provider, field)
+	}
+	switch c.Provider {
+	case providerFile:
+		if c.Path == "" {
+			return missing("path")
+		}
+	case providerEnv:
+	case providerHTTP:
+		if c.Endpoint == "" {
+			return missing("endpoint")
+		}
+	case providerAssumeRole, providerWebIdentity:
+		if instanceType != string(types.Amazon) {
+			return fmt.Errorf("credential provider %s is only supported by %s", c.Provider, types.Amazon)
+		}
+		if c.RoleARN == "" {
+			return missing("role_arn")
+		}
+		if c.Provider == providerWebIdentity && c.WebIdentityTokenFile == "" {
+			return missing("web_identity_token_file")
+		}
+	default:
+		return fmt.Errorf("unknown credential provider %q, has to be one of %s", c.Provider,
+			strings.Join([]string{providerFile, providerEnv, providerHTTP, providerAssumeRole, providerWebIdentity}, ", "))
+	}
+	return nil
+}
+
+// newCredentials returns the credentials cache of an account, or nil if the
+// account does not configure a provider.
+func newCredentials(c *config.Credentials, instanceType, region string) (*credentials.Cache, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := validateCredentials(c, instanceType); err != nil {
+		return nil, err
+	}
+	keys := credentialKeys[instanceType]
+	names := func(upper bool) map[string]string {
+		out := map[string]string{}
+		for _, key := range append(keys.required, keys.optional...) {
+			switch {
+			case c.Names[key] != "":
+				out[key] = c.Names[key]
+			case upper:
+				out[key] = strings.ToUpper(key)
+			default:
+				out[key] = key
+			}
+		}
+		return out
+	}
+
+	var provider credentials.Provider
+	switch c.Provider {
+	case providerFile:
+		provider = credentials.File(c.Path, c.Key)
+	case providerEnv:
+		provider = credentials.Env(names(true))
+	case providerHTTP:
+		provider = credentials.HTTP(c.Endpoint, c.Token, c.SkipVerify, c.SecretPath, names(false))
+	case providerAssumeRole:
+		p, err := credentials.AssumeRole(region, c.RoleARN, c.ExternalID, c.SessionName)
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	case providerWebIdentity:
+		p, err := credentials.WebIdentity(region, c.RoleARN, c.SessionName, c.WebIdentityTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	}
+
+	refresh := defaultCredentialsRefresh
+	if c.RefreshInterval > 0 {
+		refresh = time.Duration(c.RefreshInterval) * time.Second
+	}
+	return credentials.NewCache(credentials.Required(provider, keys.required...), refresh), nil
+}
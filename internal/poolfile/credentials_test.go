@@ -0,0 +1,75 @@
+package poolfile
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/credentials"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		creds        config.Credentials
+		instanceType types.DriverType
+		err          string
+	}{
+		{name: "env", creds: config.Credentials{Provider: providerEnv}, instanceType: types.DigitalOcean},
+		{name: "file", creds: config.Credentials{Provider: providerFile, Path: "/etc/drone/azure.json"}, instanceType: types.Azure},
+		{name: "assume role", creds: config.Credentials{Provider: providerAssumeRole, RoleARN: "arn:aws:iam::1:role/ci"}, instanceType: types.Amazon},
+		{name: "file without a path", creds: config.Credentials{Provider: providerFile}, instanceType: types.Amazon, err: "requires path"},
+		{name: "http without an endpoint", creds: config.Credentials{Provider: providerHTTP}, instanceType: types.Amazon, err: "requires endpoint"},
+		{name: "assume role outside amazon", creds: config.Credentials{Provider: providerAssumeRole, RoleARN: "arn"}, instanceType: types.Azure, err: "only supported by amazon"},
+		{name: "web identity without a token", creds: config.Credentials{Provider: providerWebIdentity, RoleARN: "arn"}, instanceType: types.Amazon, err: "requires web_identity_token_file"},
+		{name: "unknown provider", creds: config.Credentials{Provider: "vault"}, instanceType: types.Amazon, err: "unknown credential provider"},
+		{name: "hetzner", creds: config.Credentials{Provider: providerEnv}, instanceType: types.Hetzner, err: "not supported by hetzner"},
+		{name: "nomad", creds: config.Credentials{Provider: providerEnv}, instanceType: types.Nomad, err: "not supported by nomad"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateCredentials(&test.creds, string(test.instanceType))
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("want no error, got %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("want error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestNewCredentials(t *testing.T) {
+	if creds, err := newCredentials(nil, string(types.Amazon), ""); creds != nil || err != nil {
+		t.Errorf("want no credentials without a provider, got %v, %v", creds, err)
+	}
+
+	t.Setenv("ACCESS_KEY_ID", "id")
+	t.Setenv("CI_SECRET", "secret")
+	c := &config.Credentials{Provider: providerEnv, Names: map[string]string{credentials.AccessKeySecret: "CI_SECRET"}}
+	creds, err := newCredentials(c, string(types.Amazon), "us-east-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := creds.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get(credentials.AccessKeyID) != "id" || got.Get(credentials.AccessKeySecret) != "secret" {
+		t.Errorf("want the credentials from the environment, got %+v", got)
+	}
+
+	t.Setenv("PAT", "")
+	creds, err = newCredentials(&config.Credentials{Provider: providerEnv}, string(types.DigitalOcean), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := creds.Retrieve(context.Background()); err == nil {
+		t.Errorf("want an error for a missing required credential")
+	}
+}
@@ -0,0 +1,183 @@
+package poolfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/sirupsen/logrus"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Files returns the pool files at path, followed by the files they include.
+// The path, like every entry of include, is a file, a directory, whose *.yml
+// and *.yaml files are loaded in lexical order, or a glob pattern. Included
+// paths are relative to the file including them. Each file is loaded once.
+func Files(path string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	var visit func(pattern string) error
+	visit = func(pattern string) error {
+		matches, err := expand(pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range matches {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			if seen[abs] {
+				continue
+			}
+			seen[abs] = true
+			files = append(files, file)
+
+			includes, err := includesOf(file)
+			if err != nil {
+				return err
+			}
+			for _, include := range includes {
+				if !filepath.IsAbs(include) {
+					include = filepath.Join(filepath.Dir(file), include)
+				}
+				if err := visit(include); err != nil {
+					return fmt.Errorf("%s: %w", file, err)
+				}
+			}
+		}
+		return nil
+	}
+	if err := visit(path); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// expand returns the files matched by a file, directory or glob pattern.
+func expand(pattern string) ([]string, error) {
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no pool files match %s", pattern)
+		}
+		sort.Strings(matches)
+		return matches, nil
+	}
+
+	info, err := os.Stat(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{pattern}, nil
+	}
+	entries, err := os.ReadDir(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			files = append(files, filepath.Join(pattern, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no pool files found in %s", pattern)
+	}
+	return files, nil
+}
+
+// includesOf returns the include entries of a pool file. Syntax errors are
+// left to the validation of the file.
+func includesOf(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Include []string `yaml:"include"`
+	}
+	_ = yamlv3.Unmarshal(data, &doc)
+	return doc.Include, nil
+}
+
+// ParseFiles parses the pool files at path, see Files, and merges their
+// instances, virtual pools and hourly costs into a single pool file. Files of an older
+// version are upgraded in memory. Defaults and extends are resolved within
+// each file.
+func ParseFiles(path string) (*config.PoolFile, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	out := new(config.PoolFile)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pf, err := config.Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if err := merge(out, pf, file, data); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// LoadFiles validates the pool files at path, see ValidateFile, and merges
+// them like ParseFiles. Each file is read, and its references resolved, once.
+func LoadFiles(path string) (*config.PoolFile, error) {
+	files, err := validateFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	out := new(config.PoolFile)
+	for _, file := range files {
+		pf, err := config.Decode(file.doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.path, err)
+		}
+		if err := merge(out, pf, file.path, file.data); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// merge merges the pool file parsed from the data of the file into out. The
+// files may price the same size only if they agree on its cost.
+func merge(out, pf *config.PoolFile, file string, data []byte) error {
+	if version := config.VersionOf(data); version != config.LatestVersion {
+		logrus.WithField("path", file).
+			WithField("version", version).
+			Warnf("pool file upgraded in memory to version %s, run `poolfile migrate` to update it", config.LatestVersion)
+	}
+	if out.Version == "" {
+		out.Version = pf.Version
+	}
+	out.Instances = append(out.Instances, pf.Instances...)
+	out.VirtualPools = append(out.VirtualPools, pf.VirtualPools...)
+	for size, cost := range pf.HourlyCosts {
+		if prev, ok := out.HourlyCosts[size]; ok && prev != cost {
+			return fmt.Errorf("%s: hourly cost of size %q is %v, another pool file sets %v", file, size, cost, prev)
+		}
+		if out.HourlyCosts == nil {
+			out.HourlyCosts = map[string]float64{}
+		}
+		out.HourlyCosts[size] = cost
+	}
+	return nil
+}
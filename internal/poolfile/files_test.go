@@ -0,0 +1,153 @@
+package poolfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+func writePoolFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const teamPool = `instances:
+  - name: %s
+    type: digitalocean
+    pool: 1
+    limit: 2
+    spec:
+      account:
+        pat: XXXXXXXX
+`
+
+func pool(name string) string {
+	return fmt.Sprintf(teamPool, name)
+}
+
+func TestParseFiles(t *testing.T) {
+	dir := writePoolFiles(t, map[string]string{
+		"a.yml":          pool("team-a"),
+		"b.yaml":         "include: [shared/*.yml]\n" + pool("team-b"),
+		"notes.txt":      "not a pool file",
+		"shared/c.yml":   pool("team-c") + "virtual_pools:\n  - name: any\n    pools:\n      - pool: team-a\n",
+		"shared/ignored": pool("ignored"),
+	})
+
+	for _, path := range []string{dir, filepath.Join(dir, "*.y*ml")} {
+		pf, err := ParseFiles(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for i := range pf.Instances {
+			names = append(names, pf.Instances[i].Name)
+		}
+		if got, want := strings.Join(names, ","), "team-a,team-b,team-c"; got != want {
+			t.Errorf("want instances %s, got %s", want, got)
+		}
+		if len(pf.VirtualPools) != 1 {
+			t.Errorf("want the virtual pool of the included file, got %v", pf.VirtualPools)
+		}
+		if err := ValidateFile(path); err != nil {
+			t.Errorf("want valid pool files, got %s", err)
+		}
+	}
+}
+
+func TestValidateFile_DuplicateAcrossFiles(t *testing.T) {
+	dir := writePoolFiles(t, map[string]string{
+		"a.yml": pool("linux"),
+		"b.yml": "include: [a.yml]\n" + pool("linux") + "virtual_pools:\n  - name: any\n    pools:\n      - pool: missing\n",
+	})
+
+	err := ValidateFile(dir)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("want two validation errors, got %v", err)
+	}
+	if errs[0].File != filepath.Join(dir, "b.yml") || errs[0].Line != 3 ||
+		!strings.Contains(errs[0].Message, `duplicate pool name "linux", first defined in `+filepath.Join(dir, "a.yml")+" on line 2") {
+		t.Errorf("unexpected error %s", errs[0])
+	}
+	if !strings.Contains(errs[1].Message, `unknown pool "missing"`) {
+		t.Errorf("unexpected error %s", errs[1])
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	t.Setenv("TEST_POOL_SIZE", "2")
+	dir := writePoolFiles(t, map[string]string{"pat": "secret-pat"})
+	pat := filepath.Join(dir, "pat")
+	path := filepath.Join(dir, "pool.yml")
+	data := strings.Replace(pool("linux"), "pool: 1", "pool: ${TEST_POOL_SIZE}", 1)
+	data = strings.Replace(data, "XXXXXXXX", "${file:"+pat+"}", 1)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pf, err := LoadFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pf.Instances) != 1 || pf.Instances[0].Pool != 2 {
+		t.Fatalf("want the pool size of the environment, got %+v", pf.Instances)
+	}
+	if spec, ok := pf.Instances[0].Spec.(*config.DigitalOcean); !ok || spec.Account.PAT != "secret-pat" {
+		t.Errorf("want the token of the file, got %+v", pf.Instances[0].Spec)
+	}
+
+	if err := os.WriteFile(path, []byte(pool("linux")+"    unknown: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var errs ValidationErrors
+	if _, err := LoadFiles(path); !errors.As(err, &errs) || len(errs) != 1 {
+		t.Errorf("want a validation error, got %v", err)
+	}
+}
+
+func TestConfigPoolFile_HourlyCosts(t *testing.T) {
+	dir := writePoolFiles(t, map[string]string{
+		"a.yml": "hourly_costs:\n  s-1vcpu-1gb: 0.01\n" + pool("team-a"),
+		"b.yml": "hourly_costs:\n  s-1vcpu-1gb: 0.01\n  s-2vcpu-2gb: 0.02\n" + strings.Replace(pool("team-b"), "    spec:\n", "    spec:\n      size: s-2vcpu-2gb\n", 1),
+	})
+
+	pf, err := ConfigPoolFile(dir, &config.EnvConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools, err := ProcessPool(pf, "runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("want 2 pools, got %d", len(pools))
+	}
+	for _, p := range pools {
+		if p.HourlyCosts["s-1vcpu-1gb"] != 0.01 || p.HourlyCosts["s-2vcpu-2gb"] != 0.02 {
+			t.Errorf("%s: want the hourly costs of both files, got %v", p.Name, p.HourlyCosts)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b.yml"), []byte("hourly_costs:\n  s-1vcpu-1gb: 0.02\n"+pool("team-b")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFiles(dir); err == nil || !strings.Contains(err.Error(), `hourly cost of size "s-1vcpu-1gb"`) {
+		t.Errorf("want an error for conflicting hourly costs, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package poolfile
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+)
+
+// driverMethods maps the names of the driver methods in the pool file to the
+// names of the methods of the driver.
+var driverMethods = map[string]string{
+	"create":    "Create",
+	"destroy":   "Destroy",
+	"hibernate": "Hibernate",
+	"start":     "Start",
+	"set_tags":  "SetTags",
+	"ping":      "Ping",
+	"logs":      "Logs",
+}
+
+// mapMiddleware returns the middleware chain configured for the pool.
+func mapMiddleware(instance *config.Instance) ([]drivers.Middleware, error) {
+	var middleware []drivers.Middleware
+	if instance.Middleware.Logging {
+		middleware = append(middleware, drivers.Logging(instance.Name))
+	}
+	if len(instance.Middleware.Timeouts) != 0 {
+		timeouts := map[string]time.Duration{}
+		for name, value := range instance.Middleware.Timeouts {
+			method, ok := driverMethods[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown driver method %q in middleware timeouts", name)
+			}
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s timeout %q: %w", name, value, err)
+			}
+			timeouts[method] = timeout
+		}
+		middleware = append(middleware, drivers.Timeouts(timeouts))
+	}
+	// the faults are injected closest to the driver, so that the other
+	// middleware copes with them
+	if chaos := instance.Middleware.Chaos; chaos != nil {
+		faults := map[string]drivers.Faults{}
+		for method, f := range map[string]config.ChaosFaults{
+			"Create":    chaos.Create,
+			"Destroy":   chaos.Destroy,
+			"Hibernate": chaos.Hibernate,
+			"Start":     chaos.Start,
+		} {
+			var latency time.Duration
+			if f.Latency != "" {
+				var err error
+				if latency, err = time.ParseDuration(f.Latency); err != nil {
+					return nil, fmt.Errorf("invalid chaos latency %q: %w", f.Latency, err)
+				}
+			}
+			faults[method] = drivers.Faults{
+				FailureRate:   f.FailureRate,
+				HangRate:      f.HangRate,
+				NoAddressRate: f.NoAddressRate,
+				PartialRate:   f.PartialRate,
+				Latency:       latency,
+			}
+		}
+		middleware = append(middleware, drivers.Chaos(faults, chaos.Seed))
+	}
+	return middleware, nil
+}
@@ -0,0 +1,40 @@
+package poolfile
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+)
+
+func TestMapMiddleware(t *testing.T) {
+	instance := &config.Instance{Name: "linux"}
+	instance.Middleware.Logging = true
+	instance.Middleware.Timeouts = map[string]string{"create": "5m"}
+	instance.Middleware.Chaos = &config.Chaos{
+		Seed:    42,
+		Create:  config.ChaosFaults{FailureRate: 0.2, Latency: "2s"},
+		Destroy: config.ChaosFaults{PartialRate: 0.1},
+	}
+	middleware, err := mapMiddleware(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(middleware) != 3 {
+		t.Fatalf("want logging, timeouts and chaos, got %d middleware", len(middleware))
+	}
+	// the faults are injected closest to the driver
+	if _, ok := middleware[2](&drivers.ChaosDriver{}).(*drivers.ChaosDriver); !ok {
+		t.Errorf("want the chaos middleware last")
+	}
+
+	instance.Middleware.Timeouts = map[string]string{"reboot": "5m"}
+	if _, err := mapMiddleware(instance); err == nil {
+		t.Errorf("want an error for an unknown method")
+	}
+	instance.Middleware.Timeouts = nil
+	instance.Middleware.Chaos.Start.Latency = "later"
+	if _, err := mapMiddleware(instance); err == nil {
+		t.Errorf("want an error for an invalid latency")
+	}
+}
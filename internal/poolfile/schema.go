@@ -0,0 +1,130 @@
+package poolfile
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// field describes a struct field as it appears in the pool file.
+type field struct {
+	name     string
+	typ      reflect.Type
+	required bool
+}
+
+// fieldsOf returns the pool file fields of a struct type, in declaration order.
+func fieldsOf(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, field{
+			name:     name,
+			typ:      f.Type,
+			required: f.Tag.Get("jsonschema") == "required",
+		})
+	}
+	return fields
+}
+
+// lookupField finds a field the same way encoding/json does, preferring an
+// exact match over a case-insensitive one.
+func lookupField(fields []field, key string) (field, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// Schema returns the JSON Schema of the pool file, generated from config.PoolFile
+// and the spec structs of every driver.
+func Schema() map[string]interface{} {
+	s := schemaOf(reflect.TypeOf(config.PoolFile{}))
+	s["$schema"] = schemaDraft
+	s["title"] = "drone-runner-aws pool file"
+
+	instance := s["properties"].(map[string]interface{})["instances"].(map[string]interface{})["items"].(map[string]interface{})
+	props := instance["properties"].(map[string]interface{})
+	props["type"] = map[string]interface{}{
+		"type": "string",
+		"enum": config.InstanceTypes(),
+	}
+
+	var conditions []interface{}
+	for _, t := range config.InstanceTypes() {
+		spec, _ := config.NewSpec(t)
+		conditions = append(conditions, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"type": map[string]interface{}{"const": t}},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{"spec": schemaOf(reflect.TypeOf(spec).Elem())},
+			},
+		})
+	}
+	instance["allOf"] = conditions
+	return s
+}
+
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		var required []string
+		for _, f := range fieldsOf(t) {
+			props[f.name] = schemaOf(f.typ)
+			if f.required {
+				required = append(required, f.name)
+			}
+		}
+		s := map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			sort.Strings(required)
+			s["required"] = required
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		// interface{} fields, e.g. the instance spec, accept any value.
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,80 @@
+package poolfile
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/internal/lehelper"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+// prerender sets the custom userdata template of the pools and renders it
+// once with dummy certificates, so that a broken template or userdata part
+// fails the pool file instead of every instance created from it.
+func prerender(poolFile *config.PoolFile, pools []drivers.Pool) error {
+	specs := map[string]interface{}{}
+	for i := range poolFile.Instances {
+		specs[poolFile.Instances[i].Name] = poolFile.Instances[i].Spec
+	}
+	for i := range pools {
+		pool := &pools[i]
+		userdata, err := userData(specs[pool.Name])
+		if err != nil {
+			return fmt.Errorf("pool '%s': %w", pool.Name, err)
+		}
+		pool.UserData = userdata
+		if userdata == "" && len(pool.UserDataParts) == 0 {
+			continue
+		}
+		_, err = lehelper.GenerateUserdata(userdata, &types.InstanceCreateOpts{
+			CACert:         []byte("dummy ca certificate"),
+			TLSCert:        []byte("dummy certificate"),
+			TLSKey:         []byte("dummy key"),
+			LiteEnginePath: "https://example.com/lite-engine/v0.0.0",
+			Prebaked:       pool.Prebaked,
+			UserDataFormat: pool.UserDataFormat,
+			UserDataParts:  pool.UserDataParts,
+			UserDataGzip:   pool.UserDataGzip,
+			Network:        pool.Network,
+			Platform:       pool.Platform,
+			PoolName:       pool.Name,
+			RunnerName:     pool.RunnerName,
+			Limit:          pool.MaxSize,
+			Pool:           pool.MinSize,
+		})
+		if err != nil {
+			return fmt.Errorf("pool '%s': invalid user_data: %w", pool.Name, err)
+		}
+	}
+	return nil
+}
+
+// userData returns the custom userdata template of an instance spec, from
+// its user_data or user_data_path.
+func userData(spec interface{}) (string, error) {
+	v := reflect.ValueOf(spec)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", nil
+	}
+	if text := v.FieldByName("UserData"); text.IsValid() && text.Kind() == reflect.String && text.String() != "" {
+		return text.String(), nil
+	}
+	path := v.FieldByName("UserDataPath")
+	if !path.IsValid() || path.Kind() != reflect.String || path.String() == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to read user_data_path: %w", err)
+	}
+	return string(data), nil
+}
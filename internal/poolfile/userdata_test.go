@@ -0,0 +1,49 @@
+package poolfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+func TestPrerender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user_data.yml")
+	if err := os.WriteFile(path, []byte("#cloud-config\n# {{ .Platform.OS }}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	poolFile := &config.PoolFile{Instances: []config.Instance{
+		{Name: "inline", Spec: &config.Amazon{UserData: "#cloud-config\n{{ .TLSCert | base64 }}"}},
+		{Name: "file", Spec: &config.Google{UserDataPath: path}},
+		{Name: "builtin", Spec: &config.Amazon{}},
+	}}
+	pools := []drivers.Pool{{Name: "inline"}, {Name: "file"}, {Name: "builtin"}}
+	if err := prerender(poolFile, pools); err != nil {
+		t.Fatal(err)
+	}
+	if pools[1].UserData != "#cloud-config\n# {{ .Platform.OS }}\n" || pools[2].UserData != "" {
+		t.Errorf("want the custom templates to be set on the pools, got %q, %q", pools[1].UserData, pools[2].UserData)
+	}
+
+	tests := map[string]string{
+		"#cloud-config\n{{ .Missing }}":     "can't evaluate field Missing",
+		"#cloud-config\n{{ if .IsHosted }}": "unexpected EOF",
+		"{{ base64 .Platform }}":            "wrong type for value",
+	}
+	for userdata, want := range tests {
+		poolFile.Instances[0].Spec = &config.Amazon{UserData: userdata}
+		err := prerender(poolFile, []drivers.Pool{{Name: "inline", Platform: types.Platform{OS: "linux"}}})
+		if err == nil || !strings.Contains(err.Error(), "pool 'inline': invalid user_data") || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: want an error containing %q, got %v", userdata, want, err)
+		}
+	}
+
+	poolFile.Instances[0].Spec = &config.Amazon{UserDataPath: filepath.Join(t.TempDir(), "missing.yml")}
+	if err := prerender(poolFile, []drivers.Pool{{Name: "inline"}}); err == nil {
+		t.Errorf("want an error for a missing user_data_path")
+	}
+}
@@ -0,0 +1,682 @@
+package poolfile
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/drone-runners/drone-runner-aws/internal/cloudinit"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/amazon"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/anka"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/ankabuild"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/azure"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/digitalocean"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/google"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/hetzner"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/nomad"
+	"github.com/drone-runners/drone-runner-aws/internal/drivers/vmfusion"
+	"github.com/drone-runners/drone-runner-aws/internal/oshelp"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// platformDefaults maps an instance type to the function validating its platform.
+var platformDefaults = map[string]func(*types.Platform) (*types.Platform, error){
+	string(types.Amazon):       amazon.SetPlatformDefaults,
+	string(types.Anka):         anka.SetPlatformDefaults,
+	string(types.AnkaBuild):    ankabuild.SetPlatformDefaults,
+	string(types.Azure):        azure.SetPlatformDefaults,
+	string(types.DigitalOcean): digitalocean.SetPlatformDefaults,
+	string(types.Hetzner):      hetzner.SetPlatformDefaults,
+	string(types.Google):       google.SetPlatformDefaults,
+	string(types.Nomad):        nomad.SetPlatformDefaults,
+	string(types.VMFusion):     vmfusion.SetPlatformDefaults,
+}
+
+// ValidationError is a problem found in a pool file.
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ValidationErrors is the list of all problems found in a pool file.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	s := make([]string, len(e))
+	for i := range e {
+		s[i] = e[i].Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(n *yamlv3.Node, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateFile validates the pool files at path, see Files. It returns
+// ValidationErrors holding every problem found, including pool names defined
+// in more than one file, or nil if the files are valid.
+func ValidateFile(path string) error {
+	_, err := validateFiles(path)
+	return err
+}
+
+// validFile is a pool file which is valid, with the YAML node tree it is
+// going to be used as.
+type validFile struct {
+	path string
+	data []byte
+	doc  *yamlv3.Node
+}
+
+// validateFiles reads and validates the pool files at path, see ValidateFile,
+// and returns them if they are valid.
+func validateFiles(path string) ([]validFile, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+
+	type location struct {
+		file string
+		line int
+	}
+	var all ValidationErrors
+	var valid []validFile
+	defined := map[string]location{}
+	refs := map[string][]*yamlv3.Node{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		res := validate(data)
+		valid = append(valid, validFile{path: file, data: data, doc: res.doc})
+		for _, name := range res.names {
+			prev, ok := defined[name.Value]
+			switch {
+			case !ok:
+				defined[name.Value] = location{file: file, line: name.Line}
+			case prev.file != file:
+				res.errs = append(res.errs, &ValidationError{Line: name.Line, Column: name.Column,
+					Message: fmt.Sprintf("duplicate pool name %q, first defined in %s on line %d", name.Value, prev.file, prev.line)})
+			}
+		}
+		for _, e := range res.errs {
+			e.File = file
+		}
+		all = append(all, res.errs...)
+		refs[file] = res.refs
+	}
+	for _, file := range files {
+		for _, ref := range refs[file] {
+			if _, ok := defined[ref.Value]; !ok {
+				e := unknownPool(ref)
+				e.File = file
+				all = append(all, e)
+			}
+		}
+	}
+	if len(all) > 0 {
+		return nil, all
+	}
+	return valid, nil
+}
+
+// Validate validates the contents of a pool file and returns all problems found.
+func Validate(data []byte) ValidationErrors {
+	res := validate(data)
+	defined := map[string]bool{}
+	for _, name := range res.names {
+		defined[name.Value] = true
+	}
+	for _, ref := range res.refs {
+		if !defined[ref.Value] {
+			res.errs = append(res.errs, unknownPool(ref))
+		}
+	}
+	return res.errs
+}
+
+// result is the outcome of validating a single pool file. The pool names
+// referenced by virtual pools are checked once all files are validated. The
+// document is the pool file with its references resolved and its defaults
+// and extends expanded.
+type result struct {
+	errs  ValidationErrors
+	names []*yamlv3.Node
+	refs  []*yamlv3.Node
+	doc   *yamlv3.Node
+}
+
+// validate validates the contents of a pool file.
+func validate(data []byte) result {
+	var res result
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		res.errs = ValidationErrors{yamlError(err)}
+		return res
+	}
+	if len(doc.Content) == 0 {
+		res.errs = ValidationErrors{{Line: 1, Column: 1, Message: "pool file is empty"}}
+		return res
+	}
+
+	v := new(validator)
+	if err := config.MigrateNode(&doc); err != nil {
+		v.add(versionNode(doc.Content[0]), "%s", err)
+		res.errs = v.errs
+		return res
+	}
+	for _, err := range config.InterpolateNode(&doc) {
+		v.errs = append(v.errs, &ValidationError{Line: err.Line, Column: err.Column,
+			Message: fmt.Sprintf("unable to resolve ${%s}: %s", err.Reference, err.Reason)})
+	}
+	for _, err := range config.ExpandNode(&doc) {
+		v.errs = append(v.errs, &ValidationError{Line: err.Line, Column: err.Column, Message: err.Message})
+	}
+	root := doc.Content[0]
+	v.object(root, reflect.TypeOf(config.PoolFile{}), "")
+	if costs := mappingValue(root, "hourly_costs"); costs != nil && costs.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(costs.Content); i += 2 {
+			v.cost(costs.Content[i+1], fmt.Sprintf("hourly_costs: size %q", costs.Content[i].Value))
+		}
+	}
+
+	names := map[string]*yamlv3.Node{}
+	addName := func(n *yamlv3.Node) {
+		if n == nil || n.Value == "" {
+			return
+		}
+		if prev, ok := names[n.Value]; ok {
+			v.add(n, "duplicate pool name %q, first defined on line %d", n.Value, prev.Line)
+			return
+		}
+		names[n.Value] = n
+		res.names = append(res.names, n)
+	}
+
+	if instances := mappingValue(root, "instances"); instances != nil && instances.Kind == yamlv3.SequenceNode {
+		for _, inst := range instances.Content {
+			addName(mappingValue(inst, "name"))
+			v.instance(inst)
+		}
+	}
+	if virtual := mappingValue(root, "virtual_pools"); virtual != nil && virtual.Kind == yamlv3.SequenceNode {
+		for _, vp := range virtual.Content {
+			addName(mappingValue(vp, "name"))
+		}
+		for _, vp := range virtual.Content {
+			pools := mappingValue(vp, "pools")
+			if pools == nil || pools.Kind != yamlv3.SequenceNode {
+				continue
+			}
+			for _, p := range pools.Content {
+				if name := mappingValue(p, "pool"); name != nil && name.Value != "" {
+					res.refs = append(res.refs, name)
+				}
+			}
+		}
+	}
+	res.errs = v.errs
+	res.doc = &doc
+	return res
+}
+
+// versionNode returns the node of the version, or the root if it is not set.
+func versionNode(root *yamlv3.Node) *yamlv3.Node {
+	if n := mappingValue(root, "version"); n != nil {
+		return n
+	}
+	return root
+}
+
+func unknownPool(n *yamlv3.Node) *ValidationError {
+	return &ValidationError{Line: n.Line, Column: n.Column, Message: fmt.Sprintf("virtual pool references unknown pool %q", n.Value)}
+}
+
+// instance validates the fields of a single instance which depend on its type.
+func (v *validator) instance(n *yamlv3.Node) {
+	if n.Kind != yamlv3.MappingNode {
+		return
+	}
+	path := "instance"
+	if name := mappingValue(n, "name"); name != nil {
+		path = fmt.Sprintf("instance %q", name.Value)
+	}
+
+	typ := mappingValue(n, "type")
+	if typ == nil {
+		v.add(n, "%s: missing required key \"type\"", path)
+	} else {
+		spec, err := config.NewSpec(typ.Value)
+		if err != nil {
+			v.add(typ, "%s: %s", path, err)
+		} else if specNode := mappingValue(n, "spec"); specNode != nil {
+			v.object(specNode, reflect.TypeOf(spec).Elem(), path+": spec")
+			if typ.Value == string(types.Amazon) {
+				v.amazonCredentials(specNode, path)
+			}
+			v.accountCredentials(specNode, typ.Value, path)
+		} else {
+			v.required(&yamlv3.Node{Kind: yamlv3.MappingNode, Line: n.Line, Column: n.Column}, reflect.TypeOf(spec).Elem(), path+": spec")
+		}
+		v.platform(n, typ.Value, path)
+	}
+
+	pool, limit := mappingValue(n, "pool"), mappingValue(n, "limit")
+	if pool != nil && limit != nil {
+		p, perr := strconv.Atoi(pool.Value)
+		l, lerr := strconv.Atoi(limit.Value)
+		if perr == nil && lerr == nil && l > 0 && p > l {
+			v.add(pool, "%s: pool size %d is larger than the limit %d", path, p, l)
+		}
+	}
+	v.network(n, path)
+
+	v.userdata(n, typ, path)
+
+	v.cost(mappingValue(n, "hourly_cost"), path+": hourly_cost")
+	v.cost(mappingValue(n, "hibernated_hourly_cost"), path+": hibernated_hourly_cost")
+
+	v.rateLimit(mappingValue(n, "rate_limit"), path)
+	v.middleware(mappingValue(n, "middleware"), path)
+}
+
+// middleware checks the timeouts of the middleware are durations of known
+// driver methods, and the faults of the chaos middleware.
+func (v *validator) middleware(n *yamlv3.Node, path string) {
+	v.chaos(mappingValue(n, "chaos"), path)
+	timeouts := mappingValue(n, "timeouts")
+	if timeouts == nil || timeouts.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(timeouts.Content); i += 2 {
+		key, val := timeouts.Content[i], timeouts.Content[i+1]
+		if _, ok := driverMethods[key.Value]; !ok {
+			v.add(key, "%s: middleware.timeouts: unknown driver method %q", path, key.Value)
+			continue
+		}
+		if d, err := time.ParseDuration(val.Value); err != nil || d <= 0 {
+			v.add(val, "%s: middleware.timeouts.%s: %q is not a valid duration, e.g. 5m", path, key.Value, val.Value)
+		}
+	}
+}
+
+// chaosFaults are the faults of the chaos middleware which only apply to some
+// of the methods.
+var chaosFaults = map[string][]string{
+	"no_address_rate": {"create", "start"},
+	"partial_rate":    {"create", "destroy"},
+}
+
+// chaos checks the faults of the chaos middleware are probabilities and
+// apply to the method they are set for.
+func (v *validator) chaos(n *yamlv3.Node, path string) {
+	for _, method := range []string{"create", "destroy", "hibernate", "start"} {
+		faults := mappingValue(n, method)
+		if faults == nil || faults.Kind != yamlv3.MappingNode {
+			continue
+		}
+		for _, key := range []string{"failure_rate", "hang_rate", "no_address_rate", "partial_rate"} {
+			val := mappingValue(faults, key)
+			if val == nil || isNull(val) {
+				continue
+			}
+			if methods, ok := chaosFaults[key]; ok {
+				applies := false
+				for _, m := range methods {
+					applies = applies || m == method
+				}
+				if !applies {
+					v.add(val, "%s: middleware.chaos.%s.%s does not apply to %s", path, method, key, method)
+					continue
+				}
+			}
+			if f, err := strconv.ParseFloat(val.Value, 64); err != nil || f < 0 || f > 1 {
+				v.add(val, "%s: middleware.chaos.%s.%s: %q is not valid, expected a probability between 0 and 1", path, method, key, val.Value)
+			}
+		}
+		if val := mappingValue(faults, "latency"); val != nil && !isNull(val) {
+			if d, err := time.ParseDuration(val.Value); err != nil || d < 0 {
+				v.add(val, "%s: middleware.chaos.%s.latency: %q is not a valid duration, e.g. 2s", path, method, val.Value)
+			}
+		}
+	}
+}
+
+// rateLimit checks the rate, burst and retries of the rate limit are not
+// negative, and that a burst comes with a rate.
+func (v *validator) rateLimit(n *yamlv3.Node, path string) {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return
+	}
+	if burst, rate := mappingValue(n, "burst"), mappingValue(n, "rate"); burst != nil && (rate == nil || rate.Value == "0") {
+		v.add(burst, "%s: rate_limit.burst requires a rate", path)
+	}
+	for _, key := range []string{"rate", "burst", "retries"} {
+		val := mappingValue(n, key)
+		if val == nil || isNull(val) {
+			continue
+		}
+		if f, err := strconv.ParseFloat(val.Value, 64); err != nil || f < 0 {
+			v.add(val, "%s: rate_limit.%s: %q is not valid, expected a number which is not negative", path, key, val.Value)
+		}
+	}
+}
+
+// cost checks an estimated hourly cost is a number which is not negative.
+func (v *validator) cost(n *yamlv3.Node, path string) {
+	if n == nil || isNull(n) {
+		return
+	}
+	if f, err := strconv.ParseFloat(n.Value, 64); n.Kind != yamlv3.ScalarNode || err != nil || f < 0 {
+		v.add(n, "%s: %q is not a valid cost, expected a number which is not negative", path, n.Value)
+	}
+}
+
+// userdata checks the userdata format, parts and compression are supported
+// by the platform and provider of the instance.
+func (v *validator) userdata(n, typ *yamlv3.Node, path string) {
+	linux := true
+	if osName := mappingValue(mappingValue(n, "platform"), "os"); osName != nil && osName.Value != oshelp.OSLinux {
+		linux = false
+	}
+	ignition := false
+	if format := mappingValue(n, "userdata_format"); format != nil && format.Value != "" {
+		switch format.Value {
+		case cloudinit.FormatCloudInit:
+		case cloudinit.FormatIgnition:
+			ignition = true
+			if !linux {
+				v.add(format, "%s: userdata_format ignition is only supported on linux", path)
+			}
+		default:
+			v.add(format, "%s: unknown userdata_format %q, expected %s or %s", path, format.Value, cloudinit.FormatCloudInit, cloudinit.FormatIgnition)
+		}
+	}
+
+	parts := mappingValue(n, "userdata_parts")
+	if parts != nil && (!linux || ignition) {
+		v.add(parts, "%s: userdata_parts are only supported by cloud-init on linux", path)
+	} else if parts != nil && parts.Kind == yamlv3.SequenceNode {
+		for i, part := range parts.Content {
+			content, contentType := mappingValue(part, "content"), mappingValue(part, "content_type")
+			if content == nil || content.Value == "" {
+				v.add(part, "%s: userdata part %d: missing required key \"content\"", path, i)
+			} else if (contentType == nil || contentType.Value == "") && cloudinit.ContentType(content.Value) == "" {
+				v.add(content, "%s: userdata part %d: cannot detect the content type, set content_type", path, i)
+			}
+		}
+	}
+
+	gzip := mappingValue(n, "userdata_gzip")
+	if gzip == nil || gzip.Value != "true" {
+		return
+	}
+	switch {
+	case !linux || ignition:
+		v.add(gzip, "%s: userdata_gzip is only supported by cloud-init on linux", path)
+	case typ != nil && typ.Value != string(types.Amazon) && typ.Value != string(types.Azure):
+		// the other providers take the userdata as text.
+		v.add(gzip, "%s: userdata_gzip is not supported by %s", path, typ.Value)
+	}
+}
+
+// network checks the proxy and mirrors are URLs and the CA bundle contains
+// certificates.
+func (v *validator) network(n *yamlv3.Node, path string) {
+	urls := []*yamlv3.Node{mappingValue(n, "proxy")}
+	if mirrors := mappingValue(n, "mirrors"); mirrors != nil && mirrors.Kind == yamlv3.MappingNode {
+		urls = append(urls, mappingValue(mirrors, "apt"), mappingValue(mirrors, "docker"), mappingValue(mirrors, "github"))
+		if registries := mappingValue(mirrors, "registries"); registries != nil && registries.Kind == yamlv3.SequenceNode {
+			urls = append(urls, registries.Content...)
+		}
+	}
+	for _, u := range urls {
+		if u == nil || u.Kind != yamlv3.ScalarNode || u.Value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.Value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			v.add(u, "%s: %q is not a URL", path, u.Value)
+		}
+	}
+
+	bundle := mappingValue(n, "ca_bundle")
+	if bundle == nil || bundle.Kind != yamlv3.ScalarNode || bundle.Value == "" {
+		return
+	}
+	rest, certs := []byte(bundle.Value), 0
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); block.Type != "CERTIFICATE" || err != nil {
+			v.add(bundle, "%s: ca_bundle contains an invalid certificate", path)
+			return
+		}
+		certs++
+	}
+	if certs == 0 {
+		v.add(bundle, "%s: ca_bundle contains no PEM encoded certificates", path)
+	}
+}
+
+// platform checks the os and arch combination is supported by the driver.
+func (v *validator) platform(n *yamlv3.Node, typ, path string) {
+	fn, ok := platformDefaults[typ]
+	if !ok {
+		return
+	}
+	platform := new(types.Platform)
+	at := n
+	if p := mappingValue(n, "platform"); p != nil {
+		at = p
+		if os := mappingValue(p, "os"); os != nil {
+			platform.OS = os.Value
+		}
+		if arch := mappingValue(p, "arch"); arch != nil {
+			platform.Arch = arch.Value
+		}
+		if osName := mappingValue(p, "os_name"); osName != nil {
+			platform.OSName = osName.Value
+		}
+	}
+	if _, err := fn(platform); err != nil {
+		v.add(at, "%s: %s", path, err)
+	}
+}
+
+// amazonCredentials checks that static credentials are either fully set or not set at all.
+func (v *validator) amazonCredentials(spec *yamlv3.Node, path string) {
+	account := mappingValue(spec, "account")
+	if account == nil {
+		return
+	}
+	id, secret := mappingValue(account, "access_key_id"), mappingValue(account, "access_key_secret")
+	switch {
+	case id != nil && id.Value != "" && (secret == nil || secret.Value == ""):
+		v.add(id, "%s: access_key_secret is required when access_key_id is set", path)
+	case secret != nil && secret.Value != "" && (id == nil || id.Value == ""):
+		v.add(secret, "%s: access_key_id is required when access_key_secret is set", path)
+	}
+}
+
+// accountSecrets lists, per instance type, the account secret which is
+// required unless the account configures a credential provider.
+var accountSecrets = map[string]string{
+	string(types.Azure):        "client_secret",
+	string(types.DigitalOcean): "pat",
+}
+
+// accountCredentials checks the credential provider of an account, or that
+// the static secret is set if there is none.
+func (v *validator) accountCredentials(spec *yamlv3.Node, typ, path string) {
+	account := mappingValue(spec, "account")
+	creds := mappingValue(account, "credentials")
+	if creds != nil && !isNull(creds) {
+		var c config.Credentials
+		if err := creds.Decode(&c); err != nil {
+			v.add(creds, "%s: %s", path, err)
+		} else if err := validateCredentials(&c, typ); err != nil {
+			v.add(creds, "%s: %s", path, err)
+		}
+		return
+	}
+	key, ok := accountSecrets[typ]
+	if !ok {
+		return
+	}
+	if val := mappingValue(account, key); val == nil || val.Value == "" {
+		at := spec
+		if account != nil {
+			at = account
+		}
+		v.add(at, "%s: spec.account: missing required key %q or credentials", path, key)
+	}
+}
+
+// object validates a mapping node against a struct type, reporting unknown
+// and missing required keys, and recurses into nested structs.
+func (v *validator) object(n *yamlv3.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yamlv3.MappingNode {
+			if !isNull(n) {
+				v.add(n, "%s: expected a mapping", orRoot(path))
+			}
+			return
+		}
+		fields := fieldsOf(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			f, ok := lookupField(fields, key.Value)
+			if !ok {
+				v.add(key, "%s: unknown key %q", orRoot(path), key.Value)
+				continue
+			}
+			v.object(val, f.typ, join(path, f.name))
+		}
+		v.required(n, t, path)
+	case reflect.Slice, reflect.Array:
+		if n.Kind != yamlv3.SequenceNode {
+			return
+		}
+		for i, item := range n.Content {
+			v.object(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		if n.Kind != yamlv3.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.object(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))
+		}
+	}
+}
+
+// required reports required fields of t missing from the mapping node n.
+func (v *validator) required(n *yamlv3.Node, t reflect.Type, path string) {
+	for _, f := range fieldsOf(t) {
+		val := mappingValue(n, f.name)
+		if f.required && (val == nil || isNull(val) || (val.Kind == yamlv3.ScalarNode && val.Value == "")) {
+			v.add(n, "%s: missing required key %q", orRoot(path), f.name)
+			continue
+		}
+		// required fields of nested structs are reported even if the parent is omitted.
+		if val == nil && f.typ.Kind() == reflect.Struct && hasRequired(f.typ) {
+			v.required(&yamlv3.Node{Kind: yamlv3.MappingNode, Line: n.Line, Column: n.Column}, f.typ, join(path, f.name))
+		}
+	}
+}
+
+func hasRequired(t reflect.Type) bool {
+	for _, f := range fieldsOf(t) {
+		if f.required || (f.typ.Kind() == reflect.Struct && hasRequired(f.typ)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mappingValue returns the value of key in a mapping node, matching keys the
+// same way encoding/json does.
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	var folded *yamlv3.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		switch {
+		case n.Content[i].Value == key:
+			return n.Content[i+1]
+		case folded == nil && strings.EqualFold(n.Content[i].Value, key):
+			folded = n.Content[i+1]
+		}
+	}
+	return folded
+}
+
+func isNull(n *yamlv3.Node) bool {
+	return n.Kind == yamlv3.ScalarNode && n.Tag == "!!null"
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func orRoot(path string) string {
+	if path == "" {
+		return "pool file"
+	}
+	return path
+}
+
+// yamlError converts a YAML syntax error to a validation error.
+func yamlError(err error) *ValidationError {
+	var terr *yamlv3.TypeError
+	msg := err.Error()
+	if errors.As(err, &terr) {
+		msg = strings.Join(terr.Errors, "; ")
+	}
+	line := 0
+	// yaml.v3 syntax errors look like "yaml: line 3: mapping values are not allowed".
+	if i := strings.Index(msg, "line "); i >= 0 {
+		rest := msg[i+len("line "):]
+		if j := strings.Index(rest, ":"); j > 0 {
+			line, _ = strconv.Atoi(rest[:j])
+			msg = strings.TrimSpace(rest[j+1:])
+		}
+	}
+	return &ValidationError{Line: line, Message: msg}
+}
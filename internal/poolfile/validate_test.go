@@ -0,0 +1,319 @@
+package poolfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/internal/certs"
+)
+
+const invalidPoolFile = `version: "1"
+instances:
+  - name: linux
+    type: amazon
+    pool: 5
+    limit: 2
+    platform:
+      os: linux
+      arch: mips
+    spec:
+      account:
+        region: us-east-2
+        access_key_id: XXXXX
+      ami: ami-123
+      unknown_key: true
+  - name: linux
+    type: google
+    spec:
+      zone: [us-central1-a]
+  - name: do
+    type: digitalocean
+    spec:
+      account: {}
+`
+
+// wantError is an error expected on a line, by a substring of its message.
+type wantError struct {
+	line int
+	msg  string
+}
+
+// checkErrors checks that errs holds exactly the wanted errors, in any order.
+func checkErrors(t *testing.T, errs ValidationErrors, want []wantError) {
+	t.Helper()
+	for _, w := range want {
+		found := false
+		for _, err := range errs {
+			if err.Line == w.line && strings.Contains(err.Message, w.msg) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("want error %q on line %d, got:\n%s", w.msg, w.line, errs)
+		}
+	}
+	if len(errs) != len(want) {
+		t.Errorf("want %d errors, got %d:\n%s", len(want), len(errs), errs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	checkErrors(t, Validate([]byte(invalidPoolFile)), []wantError{
+		{15, `unknown key "unknown_key"`},
+		{13, "access_key_secret is required"},
+		{5, "pool size 5 is larger than the limit 2"},
+		{8, "invalid arch mips"},
+		{16, `duplicate pool name "linux"`},
+		{19, `missing required key "project_id"`},
+		{23, `missing required key "pat"`},
+	})
+}
+
+func TestValidate_Valid(t *testing.T) {
+	if errs := ValidateFile("../../pool_example.yml"); errs != nil {
+		t.Errorf("want example pool file to be valid, got:\n%s", errs)
+	}
+}
+
+func TestValidate_AmazonRegion(t *testing.T) {
+	// the region may come from AWS_REGION or the shared config of the SDK
+	data := `instances:
+  - name: linux
+    type: amazon
+    spec:
+      account:
+        access_key_id: XXXXX
+        access_key_secret: XXXXX
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(data)), nil)
+}
+
+func TestValidate_Syntax(t *testing.T) {
+	errs := Validate([]byte("instances:\n  - name: a\n    type: b: c\n"))
+	if len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("want a single syntax error on line 3, got %v", errs)
+	}
+}
+
+func TestValidate_Network(t *testing.T) {
+	ca, err := certs.Generate("runner", "drone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := `version: "2"
+instances:
+  - name: linux
+    type: amazon
+    proxy: http://proxy.example.com:3128
+    no_proxy: [169.254.169.254, .internal]
+    ca_bundle: |
+` + indent(string(ca.CACert)) + `
+    mirrors:
+      registries: [https://mirror.example.com]
+      apt: http://apt.example.com/ubuntu
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	if errs := Validate([]byte(valid)); errs != nil {
+		t.Errorf("want a valid pool file, got:\n%s", errs)
+	}
+
+	invalid := `version: "2"
+instances:
+  - name: linux
+    type: amazon
+    proxy: proxy.example.com:3128
+    ca_bundle: not a certificate
+    mirrors:
+      registries: [mirror.example.com]
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(invalid)), []wantError{
+		{5, "is not a URL"},
+		{6, "no PEM encoded certificates"},
+		{8, "is not a URL"},
+	})
+}
+
+func indent(s string) string {
+	return "      " + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n      ")
+}
+
+func TestValidate_UserDataFormat(t *testing.T) {
+	poolFile := `version: "2"
+instances:
+  - name: coreos
+    type: amazon
+    userdata_format: ignition
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+  - name: windows
+    type: amazon
+    userdata_format: ignition
+    platform:
+      os: windows
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+  - name: unknown
+    type: amazon
+    userdata_format: butane
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(poolFile)), []wantError{
+		{12, "only supported on linux"},
+		{21, `unknown userdata_format "butane"`},
+	})
+}
+
+func TestValidate_UserDataParts(t *testing.T) {
+	poolFile := `version: "2"
+instances:
+  - name: linux
+    type: amazon
+    userdata_gzip: true
+    userdata_parts:
+      - content: |
+          #!/bin/sh
+          echo hello
+      - content_type: text/x-include-url
+        content: https://example.com/userdata
+      - content: plain text
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+  - name: google
+    type: google
+    userdata_gzip: true
+    spec:
+      account:
+        project_id: project
+      zone: [us-central1-a]
+  - name: windows
+    type: amazon
+    userdata_parts:
+      - content: "#!/bin/sh"
+    platform:
+      os: windows
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(poolFile)), []wantError{
+		{12, "cannot detect the content type"},
+		{19, "userdata_gzip is not supported by google"},
+		{27, "userdata_parts are only supported by cloud-init on linux"},
+	})
+}
+
+func TestValidate_HourlyCost(t *testing.T) {
+	poolFile := `version: "2"
+hourly_costs:
+  t3.large: 0.0832
+  t3.xlarge: expensive
+instances:
+  - name: linux
+    type: amazon
+    hourly_cost: -1
+    hibernated_hourly_cost: 0.01
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(poolFile)), []wantError{
+		{4, `hourly_costs: size "t3.xlarge": "expensive" is not a valid cost`},
+		{8, `hourly_cost: "-1" is not a valid cost`},
+	})
+}
+
+func TestValidate_RateLimit(t *testing.T) {
+	poolFile := `version: "2"
+instances:
+  - name: linux
+    type: amazon
+    rate_limit:
+      rate: 2.5
+      burst: 5
+      retries: 3
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+  - name: windows
+    type: amazon
+    rate_limit:
+      burst: 5
+      retries: -1
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(poolFile)), []wantError{
+		{16, "rate_limit.burst requires a rate"},
+		{17, `rate_limit.retries: "-1" is not valid`},
+	})
+}
+
+func TestValidate_Middleware(t *testing.T) {
+	poolFile := `version: "2"
+instances:
+  - name: linux
+    type: amazon
+    middleware:
+      logging: true
+      timeouts:
+        create: 5m
+        destroy: soon
+        reboot: 1m
+    spec:
+      account:
+        region: us-east-2
+      ami: ami-123
+`
+	checkErrors(t, Validate([]byte(poolFile)), []wantError{
+		{9, `middleware.timeouts.destroy: "soon" is not a valid duration`},
+		{10, `unknown driver method "reboot"`},
+	})
+}
+
+func TestValidate_Chaos(t *testing.T) {
+	poolFile := `version: "2"
+instances:
+  - name: linux
+    type: noop
+    middleware:
+      chaos:
+        seed: 42
+        create:
+          failure_rate: 0.2
+          no_address_rate: 1.5
+          latency: 2s
+        destroy:
+          partial_rate: 0.1
+          no_address_rate: 0.1
+        start:
+          latency: later
+`
+	checkErrors(t, Validate([]byte(poolFile)), []wantError{
+		{10, `middleware.chaos.create.no_address_rate: "1.5" is not valid`},
+		{14, "middleware.chaos.destroy.no_address_rate does not apply to destroy"},
+		{16, `middleware.chaos.start.latency: "later" is not a valid duration`},
+	})
+}
@@ -0,0 +1,289 @@
+// Package poolmapper remaps the pool requested by a stage to another pool
+// based on a set of rules loaded from a YAML or JSON file.
+package poolmapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// StrategyFirstMatch picks the first target pool of a rule that exists.
+	StrategyFirstMatch = "first-match"
+	// StrategyWeighted picks one of the existing target pools at random,
+	// proportionally to the target weights.
+	StrategyWeighted = "weighted"
+)
+
+// File is the structure of the pool mapper file.
+type File struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule maps a stage matching all of its conditions to one of its targets.
+type Rule struct {
+	Name     string   `json:"name"`
+	Match    Match    `json:"match"`
+	Strategy string   `json:"strategy"`
+	Targets  []Target `json:"targets"`
+}
+
+// Match holds the conditions of a rule. Empty conditions always match and
+// string conditions support shell file name patterns, e.g. "proj-*".
+type Match struct {
+	Pool          []string          `json:"pool"`
+	AccountID     []string          `json:"account_id"`
+	OrgID         []string          `json:"org_id"`
+	ProjectID     []string          `json:"project_id"`
+	PipelineID    []string          `json:"pipeline_id"`
+	ResourceClass []string          `json:"resource_class"`
+	Tags          map[string]string `json:"tags"`
+}
+
+// Target is a pool a rule can map to. A target with a zero weight is
+// excluded, the weight defaults to 1 if it is not set.
+type Target struct {
+	Pool   string `json:"pool"`
+	Weight int    `json:"weight"`
+}
+
+// UnmarshalJSON sets the default weight of a target without one.
+func (t *Target) UnmarshalJSON(data []byte) error {
+	var target struct {
+		Pool   string `json:"pool"`
+		Weight *int   `json:"weight"`
+	}
+	if err := json.Unmarshal(data, &target); err != nil {
+		return err
+	}
+	t.Pool, t.Weight = target.Pool, 1
+	if target.Weight != nil {
+		t.Weight = *target.Weight
+	}
+	return nil
+}
+
+// Input describes the stage which requests an instance.
+type Input struct {
+	Pool          string
+	AccountID     string
+	OrgID         string
+	ProjectID     string
+	PipelineID    string
+	ResourceClass string
+	Tags          map[string]string
+}
+
+// Parse parses and validates the pool mapper file contents.
+func Parse(data []byte) (*File, error) {
+	f := new(File)
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("poolmapper: unable to parse rules: %w", err)
+	}
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		switch r.Strategy {
+		case "":
+			r.Strategy = StrategyFirstMatch
+		case StrategyFirstMatch, StrategyWeighted:
+		default:
+			return nil, fmt.Errorf("poolmapper: rule %q: unknown strategy %q", r.Name, r.Strategy)
+		}
+		if len(r.Targets) == 0 {
+			return nil, fmt.Errorf("poolmapper: rule %q has no targets", r.Name)
+		}
+		total := 0
+		for j := range r.Targets {
+			t := &r.Targets[j]
+			if t.Pool == "" {
+				return nil, fmt.Errorf("poolmapper: rule %q: target %d has no pool", r.Name, j)
+			}
+			if t.Weight < 0 {
+				return nil, fmt.Errorf("poolmapper: rule %q: target %q has a negative weight", r.Name, t.Pool)
+			}
+			total += t.Weight
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("poolmapper: rule %q: all targets are excluded by a zero weight", r.Name)
+		}
+	}
+	return f, nil
+}
+
+// Mapper maps a stage to a pool using the rules loaded from a file.
+// It is safe for concurrent use.
+type Mapper struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []Rule
+	modTime time.Time
+}
+
+// New returns a mapper with the rules loaded from the file at path.
+func New(path string) (*Mapper, error) {
+	m := &Mapper{path: path}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload reads the rules file again. On error the previous rules are kept.
+func (m *Mapper) Reload() error {
+	fi, err := os.Stat(m.path)
+	if err != nil {
+		return fmt.Errorf("poolmapper: unable to stat %s: %w", m.path, err)
+	}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("poolmapper: unable to read %s: %w", m.path, err)
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.rules = f.Rules
+	m.modTime = fi.ModTime()
+	m.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the rules whenever the file modification time changes.
+// It blocks until the context is canceled.
+func (m *Mapper) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fi, err := os.Stat(m.path)
+			if err != nil {
+				logrus.WithError(err).Warnln("poolmapper: unable to stat the rules file")
+				continue
+			}
+			m.mu.RLock()
+			changed := !fi.ModTime().Equal(m.modTime)
+			m.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := m.Reload(); err != nil {
+				logrus.WithError(err).Errorln("poolmapper: unable to reload the rules, keeping the previous ones")
+				continue
+			}
+			logrus.WithField("path", m.path).Infoln("poolmapper: reloaded the rules")
+		}
+	}
+}
+
+// Map returns the pool the input should be mapped to and the name of the rule
+// that matched. exists reports whether a pool is known to the runner, targets
+// for which it returns false are skipped. If no rule matches, ok is false.
+func (m *Mapper) Map(in *Input, exists func(string) bool) (pool, rule string, ok bool) {
+	if m == nil {
+		return "", "", false
+	}
+	m.mu.RLock()
+	rules := m.rules
+	m.mu.RUnlock()
+
+	for i := range rules {
+		r := &rules[i]
+		if !r.Match.matches(in) {
+			continue
+		}
+		if pool, ok := r.pick(exists); ok {
+			return pool, r.Name, true
+		}
+	}
+	return "", "", false
+}
+
+func (r *Rule) pick(exists func(string) bool) (string, bool) {
+	return Pick(r.Targets, r.Strategy == StrategyWeighted, exists)
+}
+
+// Pick returns a pool from targets for which exists returns true, targets with
+// a zero weight are excluded. Unless weighted is set, the first such target is
+// returned, otherwise one of them is picked at random, proportionally to its
+// weight. A nil exists accepts every target.
+func Pick(targets []Target, weighted bool, exists func(string) bool) (string, bool) {
+	var candidates []Target
+	for _, t := range targets {
+		if t.Weight > 0 && (exists == nil || exists(t.Pool)) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	if !weighted {
+		return candidates[0].Pool, true
+	}
+	total := 0
+	for _, t := range candidates {
+		total += t.Weight
+	}
+	if total <= 0 {
+		return "", false
+	}
+	n := rand.Intn(total) //nolint:gosec
+	for _, t := range candidates {
+		if n < t.Weight {
+			return t.Pool, true
+		}
+		n -= t.Weight
+	}
+	return candidates[len(candidates)-1].Pool, true
+}
+
+func (m *Match) matches(in *Input) bool {
+	if !match(in.Pool, m.Pool) ||
+		!match(in.AccountID, m.AccountID) ||
+		!match(in.OrgID, m.OrgID) ||
+		!match(in.ProjectID, m.ProjectID) ||
+		!match(in.PipelineID, m.PipelineID) ||
+		!match(in.ResourceClass, m.ResourceClass) {
+		return false
+	}
+	for k, pattern := range m.Tags {
+		v, ok := in.Tags[k]
+		if !ok {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern, v); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func match(s string, patterns []string) bool {
+	// if no patterns are defined the string is always considered a match.
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, s); matched {
+			return true
+		}
+	}
+	return false
+}
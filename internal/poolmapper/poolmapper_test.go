@@ -0,0 +1,171 @@
+package poolmapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testRules = `
+rules:
+  - name: noisy-project
+    match:
+      account_id: [acct]
+      project_id: [noisy]
+    targets:
+      - pool: missing
+      - pool: dedicated
+  - name: large
+    match:
+      resource_class: [large]
+      tags:
+        team: "ci-*"
+    strategy: weighted
+    targets:
+      - pool: big-a
+        weight: 3
+      - pool: big-b
+        weight: 1
+`
+
+func exists(pool string) bool { return pool != "missing" }
+
+func writeRules(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMap(t *testing.T) {
+	m, err := New(writeRules(t, testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		in   Input
+		want []string
+	}{
+		{
+			name: "first match skips unknown pools",
+			in:   Input{Pool: "linux", AccountID: "acct", ProjectID: "noisy"},
+			want: []string{"dedicated"},
+		},
+		{
+			name: "weighted",
+			in:   Input{Pool: "linux", ResourceClass: "large", Tags: map[string]string{"team": "ci-core"}},
+			want: []string{"big-a", "big-b"},
+		},
+		{
+			name: "tag mismatch",
+			in:   Input{Pool: "linux", ResourceClass: "large", Tags: map[string]string{"team": "web"}},
+		},
+		{
+			name: "no match",
+			in:   Input{Pool: "linux", AccountID: "acct", ProjectID: "quiet"},
+		},
+	}
+
+	for _, test := range tests {
+		got, _, ok := m.Map(&test.in, exists)
+		if ok != (len(test.want) > 0) {
+			t.Errorf("%s: want matched %t, got %t", test.name, len(test.want) > 0, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		found := false
+		for _, w := range test.want {
+			if got == w {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: want one of %v, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestMapNil(t *testing.T) {
+	var m *Mapper
+	if _, _, ok := m.Map(&Input{Pool: "linux"}, exists); ok {
+		t.Error("want no match from a nil mapper")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"rules:\n  - name: a\n",
+		"rules:\n  - name: a\n    strategy: random\n    targets: [{pool: b}]\n",
+		"rules:\n  - name: a\n    targets: [{pool: b, weight: -1}]\n",
+		"rules:\n  - name: a\n    targets: [{weight: 1}]\n",
+		"rules:\n  - name: a\n    targets: [{pool: b, weight: 0}]\n",
+	}
+	for _, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("want error parsing %q", data)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeRules(t, testRules)
+	m, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := "rules:\n  - match: {project_id: [noisy]}\n    targets: [{pool: other}]\n"
+	if err = os.WriteFile(path, []byte(updated), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := m.Map(&Input{Pool: "linux", ProjectID: "noisy"}, exists); got != "other" {
+		t.Errorf("want reloaded pool other, got %s", got)
+	}
+
+	// an invalid file keeps the previous rules
+	if err = os.WriteFile(path, []byte("rules: [{name: broken}]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Reload(); err == nil {
+		t.Error("want error reloading an invalid file")
+	}
+	if got, _, _ := m.Map(&Input{Pool: "linux", ProjectID: "noisy"}, exists); got != "other" {
+		t.Errorf("want previous pool other, got %s", got)
+	}
+}
+
+func TestPickWeights(t *testing.T) {
+	f, err := Parse([]byte("rules:\n  - strategy: weighted\n    targets: [{pool: a, weight: 0}, {pool: b}, {pool: c, weight: 2}]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := f.Rules[0].Targets
+	if targets[0].Weight != 0 || targets[1].Weight != 1 || targets[2].Weight != 2 {
+		t.Fatalf("want weights 0, 1 and 2, got %v", targets)
+	}
+	for i := 0; i < 100; i++ {
+		if pool, ok := Pick(targets, true, nil); !ok || pool == "a" {
+			t.Fatalf("want a pool with a weight, got %q", pool)
+		}
+	}
+	if pool, ok := Pick(targets, false, nil); !ok || pool != "b" {
+		t.Errorf("want the first target with a weight, got %q", pool)
+	}
+	if _, ok := Pick(targets[:1], true, nil); ok {
+		t.Errorf("want no pool when all targets are excluded")
+	}
+}
@@ -0,0 +1,159 @@
+// Package redact masks secrets in the requests and responses exchanged with
+// the lite engine before they are written to the logs.
+package redact
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+	lespec "github.com/harness/lite-engine/engine/spec"
+)
+
+// Mask replaces every redacted value.
+const Mask = "**************"
+
+// minSecretLength is the length below which secret values are not masked
+// wherever they appear, like true or a single character, which would mask
+// unrelated text. The values of sensitive fields are masked regardless.
+const minSecretLength = 5
+
+// sensitiveNames are substrings of field names, map keys and environment
+// variable names whose values are always masked.
+var sensitiveNames = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"api_key",
+	"apikey",
+	"private_key",
+	"credential",
+	"netrc",
+}
+
+// Redactor masks sensitive fields and known secret values.
+type Redactor struct {
+	secrets []string
+}
+
+// New returns a redactor which masks the given secret values.
+func New(secrets ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(secrets...)
+	return r
+}
+
+// Add adds secret values to be masked. Values shorter than minSecretLength
+// are ignored.
+func (r *Redactor) Add(secrets ...string) {
+	for _, s := range secrets {
+		if len(s) >= minSecretLength {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+}
+
+// AddAuth adds the password of a registry auth.
+func (r *Redactor) AddAuth(auth *lespec.Auth) {
+	if auth != nil {
+		r.Add(auth.Password)
+	}
+}
+
+// String masks all known secret values in s.
+func (r *Redactor) String(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	return s
+}
+
+// Value returns the JSON encoding of v with the values of sensitive fields,
+// the data of netrc files and all known secret values masked.
+func (r *Redactor) Value(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Mask
+	}
+	var generic interface{}
+	if err = json.Unmarshal(b, &generic); err != nil {
+		return Mask
+	}
+	b, err = json.Marshal(r.walk(generic, false))
+	if err != nil {
+		return Mask
+	}
+	return string(b)
+}
+
+func (r *Redactor) walk(v interface{}, sensitive bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		netrc := isNetrcFile(t)
+		for k, val := range t {
+			t[k] = r.walk(val, sensitive || isSensitive(k) || (netrc && k == "data"))
+		}
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = r.walk(t[i], sensitive)
+		}
+		return t
+	case string:
+		if sensitive && t != "" {
+			return Mask
+		}
+		return r.String(t)
+	default:
+		return v
+	}
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNetrcFile reports whether a decoded spec.File is a netrc file.
+func isNetrcFile(m map[string]interface{}) bool {
+	p, ok := m["path"].(string)
+	if !ok {
+		return false
+	}
+	base := path.Base(strings.ReplaceAll(p, "\\", "/"))
+	return strings.Contains(strings.ToLower(base), "netrc")
+}
+
+// ForSetupRequest returns a redactor for the secrets of a setup request.
+func ForSetupRequest(req *api.SetupRequest) *Redactor {
+	r := New(req.Secrets...)
+	r.Add(req.LogConfig.Token, req.TIConfig.Token)
+	return r
+}
+
+// ForStartStepRequest returns a redactor for the secrets of a start step request.
+func ForStartStepRequest(req *api.StartStepRequest) *Redactor {
+	r := New(req.Secrets...)
+	r.AddAuth(req.Auth)
+	r.Add(req.LogConfig.Token, req.TIConfig.Token)
+	return r
+}
+
+// ForStep returns a redactor for the secrets of a pipeline step.
+func ForStep(step *lespec.Step) *Redactor {
+	r := New()
+	for _, s := range step.Secrets {
+		if s != nil {
+			r.Add(string(s.Data))
+		}
+	}
+	r.AddAuth(step.Auth)
+	return r
+}
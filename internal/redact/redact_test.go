@@ -0,0 +1,95 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	lespec "github.com/harness/lite-engine/engine/spec"
+)
+
+func assertRedacted(t *testing.T, out string, leaked ...string) {
+	t.Helper()
+	for _, s := range leaked {
+		if strings.Contains(out, s) {
+			t.Errorf("secret %q leaked into %s", s, out)
+		}
+	}
+	if !strings.Contains(out, Mask) {
+		t.Errorf("want masked values in %s", out)
+	}
+}
+
+func TestSetupRequest(t *testing.T) {
+	req := &api.SetupRequest{
+		Envs: map[string]string{
+			"GREETING":             "hello",
+			"DEPLOY_KEY":           "s3cr3t-value",
+			"DRONE_NETRC_PASSWORD": "netrc-pass",
+		},
+		Secrets:   []string{"s3cr3t-value", "another-one"},
+		LogConfig: api.LogConfig{URL: "https://logs", Token: "log-token"},
+		Files: []*lespec.File{
+			{Path: "/root/.netrc", Mode: 0600, Data: "machine github.com login octocat password netrc-file-pass"},
+			{Path: "/tmp/script.sh", Data: "echo another-one"},
+		},
+	}
+
+	out := ForSetupRequest(req).Value(req)
+	assertRedacted(t, out, "s3cr3t-value", "another-one", "netrc-pass", "log-token", "netrc-file-pass")
+	for _, s := range []string{"hello", "https://logs", "/tmp/script.sh", "echo "} {
+		if !strings.Contains(out, s) {
+			t.Errorf("want %q to be kept in %s", s, out)
+		}
+	}
+}
+
+func TestStartStepRequest(t *testing.T) {
+	req := &api.StartStepRequest{
+		ID:      "step",
+		Envs:    map[string]string{"PLUGIN_USERNAME": "octocat", "PLUGIN_PASS": "hunter2"},
+		Secrets: []string{"hunter2"},
+		Run:     api.RunConfig{Command: []string{"docker login -p hunter2"}},
+		Auth:    &lespec.Auth{Address: "index.docker.io", Username: "octocat", Password: "registry-pass"},
+	}
+
+	out := ForStartStepRequest(req).Value(req)
+	assertRedacted(t, out, "hunter2", "registry-pass")
+	if !strings.Contains(out, "index.docker.io") {
+		t.Errorf("want registry address to be kept in %s", out)
+	}
+
+	resp := &api.PollStepResponse{Exited: true, Envs: map[string]string{"EXPORTED": "hunter2"}}
+	assertRedacted(t, ForStartStepRequest(req).Value(resp), "hunter2")
+}
+
+func TestStep(t *testing.T) {
+	step := &lespec.Step{
+		Envs:    map[string]string{"TOKEN_VALUE": "plain"},
+		Secrets: []*lespec.Secret{{Name: "password", Env: "PASSWORD", Data: []byte("pa55word")}},
+		Auth:    &lespec.Auth{Password: "registry-pass"},
+		Command: []string{"echo pa55word"},
+	}
+
+	assertRedacted(t, ForStep(step).Value(step), "pa55word", "registry-pass", "plain")
+}
+
+func TestString(t *testing.T) {
+	r := New("", "abcde")
+	if got, want := r.String("xabcdex"), "x"+Mask+"x"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestString_ShortSecrets(t *testing.T) {
+	r := New("a", "42", "true")
+	if got, want := r.String("a build of 42 steps, cache true"), "a build of 42 steps, cache true"; got != want {
+		t.Errorf("want short secrets ignored, got %s", got)
+	}
+
+	// a short value of a sensitive field is still masked
+	out := r.Value(map[string]string{"password": "true", "enabled": "true"})
+	if want := `{"enabled":"true","password":"` + Mask + `"}`; out != want {
+		t.Errorf("want %s, got %s", want, out)
+	}
+}
@@ -0,0 +1,150 @@
+// Package tracing sets up the OpenTelemetry tracing of the runner and
+// provides helpers for the spans of the setup, step and destroy requests.
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/drone-runners/drone-runner-aws"
+
+// Attributes of the spans of the runner.
+const (
+	KeyPool       = attribute.Key("runner.pool")
+	KeyDriver     = attribute.Key("runner.driver")
+	KeyInstance   = attribute.Key("runner.instance.id")
+	KeyStage      = attribute.Key("runner.stage.id")
+	KeyStep       = attribute.Key("runner.step.id")
+	KeyTask       = attribute.Key("runner.task.id")
+	KeyErrorClass = attribute.Key("runner.error.class")
+)
+
+// Setup installs the global tracer provider, exporting spans to the OTLP/HTTP
+// endpoint of the configuration. It returns a function which flushes the
+// pending spans on shutdown. If tracing is disabled, spans are not recorded
+// and the function does nothing.
+func Setup(ctx context.Context, env *config.EnvConfig) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !env.Tracing.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts, err := exporterOptions(env)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: failed to create the exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", env.Tracing.ServiceName),
+		attribute.String("service.instance.id", env.Runner.Name),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler(env.Tracing.SampleRatio)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// sampler samples the ratio of traces, unless the parent of a span was
+// sampled already. The trace id of the tasks of a stage is derived from the
+// stage, see WithStage, so sampling by trace id keeps or drops whole stages.
+func sampler(ratio float64) sdktrace.Sampler {
+	byTraceID := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(byTraceID, sdktrace.WithRemoteParentNotSampled(byTraceID))
+}
+
+// exporterOptions returns the options of the exporter. The endpoint is either
+// a host:port or a URL, whose scheme decides if TLS is used.
+func exporterOptions(env *config.EnvConfig) ([]otlptracehttp.Option, error) {
+	var opts []otlptracehttp.Option
+	endpoint := env.Tracing.Endpoint
+	insecure := env.Tracing.Insecure
+	if u, err := url.Parse(endpoint); err == nil && u.Scheme != "" && u.Host != "" {
+		endpoint = u.Host
+		insecure = insecure || u.Scheme == "http"
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("tracing: invalid endpoint %q: %w", endpoint, err)
+	}
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+	}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(env.Tracing.Headers) != 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(env.Tracing.Headers))
+	}
+	return opts, nil
+}
+
+// Start starts a span of the runner.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error, if any, and its class on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(KeyErrorClass.String(string(itypes.ClassOf(err))))
+	}
+	span.End()
+}
+
+// WithStage returns a context whose spans belong to the trace of the stage,
+// unless it already carries a span, e.g. extracted from the headers of a
+// request. The setup, step and cleanup tasks of a stage arrive as unrelated
+// dlite tasks, so the trace id is derived from the stage runtime id.
+func WithStage(ctx context.Context, stageRuntimeID string) context.Context {
+	if stageRuntimeID == "" || trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	sum := sha256.Sum256([]byte(stageRuntimeID))
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], sum[:16])
+	copy(spanID[:], sum[16:24])
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Remote:  true,
+	}))
+}
+
+// Middleware continues the trace of the W3C trace context headers of a
+// request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
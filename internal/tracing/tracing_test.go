@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-aws/command/config"
+	itypes "github.com/drone-runners/drone-runner-aws/internal/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithStage(t *testing.T) {
+	a := trace.SpanContextFromContext(WithStage(context.Background(), "stage-1"))
+	b := trace.SpanContextFromContext(WithStage(context.Background(), "stage-1"))
+	c := trace.SpanContextFromContext(WithStage(context.Background(), "stage-2"))
+	if !a.IsValid() || !a.IsRemote() {
+		t.Fatalf("want a valid remote parent, got %v", a)
+	}
+	if a.TraceID() != b.TraceID() {
+		t.Errorf("want the same trace for the tasks of a stage")
+	}
+	if a.TraceID() == c.TraceID() {
+		t.Errorf("want different traces for different stages")
+	}
+
+	if ctx := WithStage(context.Background(), ""); trace.SpanContextFromContext(ctx).IsValid() {
+		t.Errorf("want no parent without a stage")
+	}
+	parent := WithStage(context.Background(), "stage-1")
+	if got := trace.SpanContextFromContext(WithStage(parent, "stage-2")); got.TraceID() != a.TraceID() {
+		t.Errorf("want an existing parent to be kept")
+	}
+}
+
+func TestStartEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler(1)), sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	ctx := WithStage(context.Background(), "stage-1")
+	_, span := Start(ctx, "HandleSetup", KeyPool.String("linux"))
+	End(span, itypes.NewProvisionError(itypes.ErrorClassCapacity, errors.New("no capacity")))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+	got := spans[0]
+	if got.Parent().TraceID() != trace.SpanContextFromContext(ctx).TraceID() || got.SpanContext().TraceID() != got.Parent().TraceID() {
+		t.Errorf("want the span in the trace of the stage")
+	}
+	if got.Status().Code != codes.Error {
+		t.Errorf("want an error status, got %v", got.Status())
+	}
+	attrs := map[string]string{}
+	for _, attr := range got.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["runner.pool"] != "linux" || attrs["runner.error.class"] != "capacity" {
+		t.Errorf("want the pool and error class attributes, got %v", attrs)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	if _, err := Setup(context.Background(), &config.EnvConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	var got trace.SpanContext
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = trace.SpanContextFromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/setup", http.NoBody)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !got.IsSampled() {
+		t.Errorf("want the trace context of the headers, got %v", got)
+	}
+}
+
+func TestExporterOptions(t *testing.T) {
+	tests := map[string]int{
+		"":                             0,
+		"collector:4318":               1,
+		"http://collector:4318":        2,
+		"https://collector/v1/traces":  2,
+		"http://collector:4318/custom": 3,
+	}
+	for endpoint, want := range tests {
+		env := &config.EnvConfig{}
+		env.Tracing.Endpoint = endpoint
+		opts, err := exporterOptions(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(opts) != want {
+			t.Errorf("%q: want %d options, got %d", endpoint, want, len(opts))
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "errors"
+
 type RetryableError struct {
 	Msg string
 }
@@ -35,3 +37,63 @@ func NewNotFoundError(msg string) *NotFoundError {
 }
 
 func (e *NotFoundError) Error() string { return e.Msg }
+
+// ErrorClass categorises a provisioning failure so that callers can decide
+// whether to retry the same pool, fall back to another pool or fail fast.
+type ErrorClass string
+
+const (
+	ErrorClassUnknown     = ErrorClass("unknown")
+	ErrorClassCapacity    = ErrorClass("capacity")
+	ErrorClassQuota       = ErrorClass("quota")
+	ErrorClassAuth        = ErrorClass("auth")
+	ErrorClassTransient   = ErrorClass("transient")
+	ErrorClassHealthCheck = ErrorClass("health_check_timeout")
+	ErrorClassConfig      = ErrorClass("config")
+	ErrorClassBadRequest  = ErrorClass("bad_request")
+	ErrorClassCertificate = ErrorClass("certificate")
+)
+
+// ProvisionError is an error returned by a driver or the pool manager
+// annotated with the class of the failure.
+type ProvisionError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ProvisionError) Error() string { return e.Err.Error() }
+
+func (e *ProvisionError) Unwrap() error { return e.Err }
+
+// NewProvisionError wraps err with the given class. It returns nil if err is nil
+// and leaves err untouched if it has already been classified.
+func NewProvisionError(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *ProvisionError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &ProvisionError{Class: class, Err: err}
+}
+
+// ClassOf returns the class of the first classified error in the chain of err.
+func ClassOf(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+	var pe *ProvisionError
+	if errors.As(err, &pe) {
+		return pe.Class
+	}
+	var br *BadRequestError
+	if errors.As(err, &br) {
+		return ErrorClassBadRequest
+	}
+	var re *RetryableError
+	if errors.As(err, &re) {
+		return ErrorClassTransient
+	}
+	return ErrorClassUnknown
+}
@@ -22,6 +22,19 @@ type Metrics struct {
 	CPUPercentile          *prometheus.HistogramVec
 	MemoryPercentile       *prometheus.HistogramVec
 
+	InstanceCreateDuration    *prometheus.HistogramVec
+	InstanceAddressDuration   *prometheus.HistogramVec
+	InstanceHealthyDuration   *prometheus.HistogramVec
+	InstanceHibernateDuration *prometheus.HistogramVec
+	InstanceStartDuration     *prometheus.HistogramVec
+	InstanceDestroyDuration   *prometheus.HistogramVec
+	InstanceLifetime          *prometheus.HistogramVec
+	ProvisionCount            *prometheus.CounterVec
+	BusyCost                  *prometheus.CounterVec
+	IdleCost                  *prometheus.CounterVec
+	ThrottledCount            *prometheus.CounterVec
+	DriverCallDuration        *prometheus.HistogramVec
+
 	stores []*Store
 }
 
@@ -85,7 +98,7 @@ func FailedBuildCount() *prometheus.CounterVec {
 			Name: "harness_ci_pipeline_execution_errors_total",
 			Help: "Total number of pipeline executions which failed due to system errors",
 		},
-		[]string{"pool_id", "os", "arch", "driver", "distributed", "owner_id"},
+		[]string{"pool_id", "os", "arch", "driver", "distributed", "owner_id", "error_class"},
 	)
 }
 
@@ -207,7 +220,21 @@ func RegisterMetrics() *Metrics {
 	cpuPercentile := CPUPercentile()
 	memoryPercentile := MemoryPercentile()
 	errorCount := ErrorCount()
+	instanceCreateDuration := InstanceCreateDuration()
+	instanceAddressDuration := InstanceAddressDuration()
+	instanceHealthyDuration := InstanceHealthyDuration()
+	instanceHibernateDuration := InstanceHibernateDuration()
+	instanceStartDuration := InstanceStartDuration()
+	instanceDestroyDuration := InstanceDestroyDuration()
+	instanceLifetime := InstanceLifetime()
+	provisionCount := ProvisionCount()
+	busyCost := BusyCost()
+	idleCost := IdleCost()
+	throttledCount := ThrottledCount()
+	driverCallDuration := DriverCallDuration()
 	prometheus.MustRegister(buildCount, failedBuildCount, runningCount, runningPerAccountCount, poolFallbackCount, waitDurationCount, cpuPercentile, memoryPercentile, errorCount)
+	prometheus.MustRegister(instanceCreateDuration, instanceAddressDuration, instanceHealthyDuration, instanceHibernateDuration,
+		instanceStartDuration, instanceDestroyDuration, instanceLifetime, provisionCount, busyCost, idleCost, throttledCount, driverCallDuration)
 	return &Metrics{
 		BuildCount:             buildCount,
 		FailedCount:            failedBuildCount,
@@ -218,5 +245,18 @@ func RegisterMetrics() *Metrics {
 		MemoryPercentile:       memoryPercentile,
 		CPUPercentile:          cpuPercentile,
 		ErrorCount:             errorCount,
+
+		InstanceCreateDuration:    instanceCreateDuration,
+		InstanceAddressDuration:   instanceAddressDuration,
+		InstanceHealthyDuration:   instanceHealthyDuration,
+		InstanceHibernateDuration: instanceHibernateDuration,
+		InstanceStartDuration:     instanceStartDuration,
+		InstanceDestroyDuration:   instanceDestroyDuration,
+		InstanceLifetime:          instanceLifetime,
+		ProvisionCount:            provisionCount,
+		BusyCost:                  busyCost,
+		IdleCost:                  idleCost,
+		ThrottledCount:            throttledCount,
+		DriverCallDuration:        driverCallDuration,
 	}
 }
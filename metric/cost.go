@@ -0,0 +1,51 @@
+package metric
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// States of the idle instances whose cost is attributed to their pool.
+const (
+	StateIdle       = "idle"
+	StateHibernated = "hibernated"
+)
+
+// BusyCost provides metrics for the estimated cost of instances running builds of an account
+func BusyCost() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "harness_ci_runner_instance_busy_cost_total",
+			Help: "Estimated cost of the instances while they run builds, by account",
+		},
+		[]string{"pool_id", "driver", "owner_id"},
+	)
+}
+
+// IdleCost provides metrics for the estimated cost of instances waiting in a pool
+func IdleCost() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "harness_ci_runner_instance_idle_cost_total",
+			Help: "Estimated cost of the instances while they wait in the pool",
+		},
+		[]string{"pool_id", "driver", "state"}, // state can be idle or hibernated
+	)
+}
+
+// AddBusyCost attributes the cost of an instance running a build to the
+// account. It does nothing if the metrics are not registered.
+func (m *Metrics) AddBusyCost(pool, driver, owner string, cost float64) {
+	if m == nil || m.BusyCost == nil || cost <= 0 {
+		return
+	}
+	m.BusyCost.WithLabelValues(pool, driver, owner).Add(cost)
+}
+
+// AddIdleCost attributes the cost of an idle or hibernated instance to its
+// pool. It does nothing if the metrics are not registered.
+func (m *Metrics) AddIdleCost(pool, driver, state string, cost float64) {
+	if m == nil || m.IdleCost == nil || cost <= 0 {
+		return
+	}
+	m.IdleCost.WithLabelValues(pool, driver, state).Add(cost)
+}
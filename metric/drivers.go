@@ -0,0 +1,57 @@
+package metric
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Causes of throttled driver calls.
+const (
+	// ThrottleRateLimit is a call delayed by the rate limit of the pool.
+	ThrottleRateLimit = "rate_limit"
+	// ThrottleRetry is a call retried after a transient error of the provider.
+	ThrottleRetry = "retry"
+)
+
+// ThrottledCount provides metrics for the calls to the cloud API delayed by the rate limit or retried
+func ThrottledCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "harness_ci_runner_driver_throttled_calls_total",
+			Help: "Total number of driver calls delayed by the rate limit of the pool or retried after a transient error",
+		},
+		[]string{"pool_id", "driver", "method", "cause"}, // cause is rate_limit or retry
+	)
+}
+
+// CountThrottled counts a throttled driver call. It does nothing if the
+// metrics are not registered.
+func (m *Metrics) CountThrottled(pool, driver, method, cause string) {
+	if m == nil || m.ThrottledCount == nil {
+		return
+	}
+	m.ThrottledCount.WithLabelValues(pool, driver, method, cause).Inc()
+}
+
+// DriverCallDuration provides metrics for the duration of the calls to the cloud API
+func DriverCallDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "harness_ci_runner_driver_call_duration_seconds",
+			Help:    "Duration of the driver calls to the cloud API",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+		[]string{"pool_id", "driver", "method", "success"},
+	)
+}
+
+// ObserveDriverCall records the duration of a driver call. It does nothing if
+// the metrics are not registered.
+func (m *Metrics) ObserveDriverCall(pool, driver, method string, success bool, d time.Duration) {
+	if m == nil || m.DriverCallDuration == nil {
+		return
+	}
+	m.DriverCallDuration.WithLabelValues(pool, driver, method, strconv.FormatBool(success)).Observe(d.Seconds())
+}
@@ -0,0 +1,145 @@
+package metric
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Phase is a phase of the lifecycle of an instance.
+type Phase int
+
+const (
+	// PhaseCreate is the call to Driver.Create.
+	PhaseCreate Phase = iota
+	// PhaseAddress is the time from the start of the creation of an instance
+	// until it has an IP address. The drivers wait for the address in Create,
+	// so it is observed when Create returns an instance with an address.
+	PhaseAddress
+	// PhaseHealthy is the time spent waiting for the lite engine of an
+	// instance to become healthy, once it was created.
+	PhaseHealthy
+	// PhaseHibernate is the call to Driver.Hibernate.
+	PhaseHibernate
+	// PhaseStart is the call to Driver.Start, which resumes a hibernated instance.
+	PhaseStart
+	// PhaseDestroy is the call to Driver.Destroy.
+	PhaseDestroy
+	// PhaseLifetime is the age of an instance when it is destroyed.
+	PhaseLifetime
+)
+
+// Sources of the instances handed out by the pools.
+const (
+	SourceCold       = "cold"
+	SourceHibernated = "hibernated"
+	SourceRunning    = "running"
+)
+
+var (
+	phaseBuckets    = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+	lifetimeBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 43200, 86400}
+	instanceLabels  = []string{"pool_id", "driver", "zone"}
+)
+
+func instanceHistogram(name, help string, buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    name,
+			Help:    help,
+			Buckets: buckets,
+		},
+		instanceLabels,
+	)
+}
+
+// InstanceCreateDuration provides metrics for the latency of creating an instance
+func InstanceCreateDuration() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_create_duration_seconds",
+		"Time taken by the driver to create an instance", phaseBuckets)
+}
+
+// InstanceAddressDuration provides metrics for the time until a new instance has an IP address
+func InstanceAddressDuration() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_address_duration_seconds",
+		"Time from the start of the creation of an instance until it has an IP address", phaseBuckets)
+}
+
+// InstanceHealthyDuration provides metrics for the time waited until the lite engine of an instance is healthy
+func InstanceHealthyDuration() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_healthy_duration_seconds",
+		"Time waited for the lite engine of a created instance to be healthy", phaseBuckets)
+}
+
+// InstanceHibernateDuration provides metrics for the latency of hibernating an instance
+func InstanceHibernateDuration() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_hibernate_duration_seconds",
+		"Time taken by the driver to hibernate an instance", phaseBuckets)
+}
+
+// InstanceStartDuration provides metrics for the latency of resuming a hibernated instance
+func InstanceStartDuration() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_start_duration_seconds",
+		"Time taken by the driver to resume a hibernated instance", phaseBuckets)
+}
+
+// InstanceDestroyDuration provides metrics for the latency of destroying instances
+func InstanceDestroyDuration() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_destroy_duration_seconds",
+		"Time taken by the driver to destroy an instance", phaseBuckets)
+}
+
+// InstanceLifetime provides metrics for the age of instances when they are destroyed
+func InstanceLifetime() *prometheus.HistogramVec {
+	return instanceHistogram("harness_ci_runner_instance_lifetime_seconds",
+		"Age of an instance when it is destroyed, since it was created or last resumed", lifetimeBuckets)
+}
+
+// ProvisionCount provides metrics for the instances handed out by the pools, by source
+func ProvisionCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "harness_ci_runner_instance_provisions_total",
+			Help: "Total number of instances handed out by the pools",
+		},
+		[]string{"pool_id", "driver", "zone", "source"}, // source is cold, hibernated or running
+	)
+}
+
+// ObserveInstance records the duration of a phase of the lifecycle of an
+// instance. It does nothing if the metrics are not registered.
+func (m *Metrics) ObserveInstance(phase Phase, pool, driver, zone string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	var h *prometheus.HistogramVec
+	switch phase {
+	case PhaseCreate:
+		h = m.InstanceCreateDuration
+	case PhaseAddress:
+		h = m.InstanceAddressDuration
+	case PhaseHealthy:
+		h = m.InstanceHealthyDuration
+	case PhaseHibernate:
+		h = m.InstanceHibernateDuration
+	case PhaseStart:
+		h = m.InstanceStartDuration
+	case PhaseDestroy:
+		h = m.InstanceDestroyDuration
+	case PhaseLifetime:
+		h = m.InstanceLifetime
+	}
+	if h == nil {
+		return
+	}
+	h.WithLabelValues(pool, driver, zone).Observe(d.Seconds())
+}
+
+// CountProvision counts an instance handed out by a pool. It does nothing if
+// the metrics are not registered.
+func (m *Metrics) CountProvision(source, pool, driver, zone string) {
+	if m == nil || m.ProvisionCount == nil {
+		return
+	}
+	m.ProvisionCount.WithLabelValues(pool, driver, zone, source).Inc()
+}
@@ -0,0 +1,42 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveInstance(t *testing.T) {
+	m := &Metrics{
+		InstanceCreateDuration: InstanceCreateDuration(),
+		InstanceLifetime:       InstanceLifetime(),
+		ProvisionCount:         ProvisionCount(),
+	}
+	m.ObserveInstance(PhaseCreate, "linux", "amazon", "us-east-1a", 40*time.Second)
+	m.ObserveInstance(PhaseCreate, "linux", "amazon", "us-east-1b", 20*time.Second)
+	m.ObserveInstance(PhaseLifetime, "linux", "amazon", "us-east-1a", time.Hour)
+	// phases without a histogram are ignored
+	m.ObserveInstance(PhaseStart, "linux", "amazon", "us-east-1a", time.Second)
+
+	if got := testutil.CollectAndCount(m.InstanceCreateDuration); got != 2 {
+		t.Errorf("want create durations for 2 zones, got %d", got)
+	}
+	if got := testutil.CollectAndCount(m.InstanceLifetime); got != 1 {
+		t.Errorf("want 1 lifetime, got %d", got)
+	}
+
+	m.CountProvision(SourceHibernated, "linux", "amazon", "us-east-1a")
+	m.CountProvision(SourceHibernated, "linux", "amazon", "us-east-1a")
+	m.CountProvision(SourceCold, "linux", "amazon", "us-east-1a")
+	if got := testutil.ToFloat64(m.ProvisionCount.WithLabelValues("linux", "amazon", "us-east-1a", SourceHibernated)); got != 2 {
+		t.Errorf("want 2 hibernated hits, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ProvisionCount.WithLabelValues("linux", "amazon", "us-east-1a", SourceCold)); got != 1 {
+		t.Errorf("want 1 cold hit, got %v", got)
+	}
+
+	var none *Metrics
+	none.ObserveInstance(PhaseDestroy, "linux", "amazon", "", time.Second)
+	none.CountProvision(SourceCold, "linux", "amazon", "")
+}
@@ -93,6 +93,12 @@ func (s InstanceStore) Update(_ context.Context, instance *types.Instance) error
 	return s.db.Put([]byte(key), data.Bytes(), nil)
 }
 
+// UpdateCertificates updates the key material of an instance, instances are
+// always written as a whole.
+func (s InstanceStore) UpdateCertificates(ctx context.Context, instance *types.Instance) error {
+	return s.Update(ctx, instance)
+}
+
 func (s InstanceStore) Purge(ctx context.Context) error {
 	panic("implement me")
 }
@@ -0,0 +1,2 @@
+ALTER TABLE instances ADD COLUMN IF NOT EXISTS instance_cost DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE instances ADD COLUMN IF NOT EXISTS instance_cost_updated INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
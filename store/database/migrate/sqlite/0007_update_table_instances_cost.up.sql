@@ -0,0 +1,2 @@
+ALTER TABLE instances ADD COLUMN instance_cost REAL NOT NULL DEFAULT 0;
+ALTER TABLE instances ADD COLUMN instance_cost_updated INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -117,6 +117,16 @@ func (s InstanceStore) Update(_ context.Context, instance *types.Instance) error
 	return err
 }
 
+// UpdateCertificates updates the key material of an instance.
+func (s InstanceStore) UpdateCertificates(_ context.Context, instance *types.Instance) error {
+	query, arg, err := s.db.BindNamed(instanceUpdateCertificates, instance)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, arg...)
+	return err
+}
+
 func (s InstanceStore) Purge(ctx context.Context) error {
 	panic("implement me")
 }
@@ -148,6 +158,8 @@ const instanceColumns = `
 ,is_hibernated
 ,instance_port
 ,instance_owner_id
+,instance_cost
+,instance_cost_updated
 `
 
 const instanceFindByID = `SELECT ` + instanceColumns + `
@@ -184,6 +196,8 @@ INSERT INTO instances (
 ,instance_port
 ,instance_owner_id
 ,runner_name
+,instance_cost
+,instance_cost_updated
 ) values (
  :instance_id
 ,:instance_node_id
@@ -212,6 +226,8 @@ INSERT INTO instances (
 ,:instance_port
 ,:instance_owner_id
 ,:runner_name
+,:instance_cost
+,:instance_cost_updated
 ) RETURNING instance_id
 `
 
@@ -230,5 +246,17 @@ SET
  ,instance_address  = :instance_address
  ,instance_owner_id = :instance_owner_id
  ,instance_started  = :instance_started
+ ,instance_cost     = :instance_cost
+ ,instance_cost_updated = :instance_cost_updated
+WHERE instance_id   = :instance_id
+`
+
+const instanceUpdateCertificates = `
+UPDATE instances
+SET
+  instance_ca_key   = :instance_ca_key
+ ,instance_ca_cert  = :instance_ca_cert
+ ,instance_tls_key  = :instance_tls_key
+ ,instance_tls_cert = :instance_tls_cert
 WHERE instance_id   = :instance_id
 `
@@ -47,6 +47,12 @@ func (i InstanceStoreSync) Update(ctx context.Context, instance *types.Instance)
 	return i.base.Update(ctx, instance)
 }
 
+func (i InstanceStoreSync) UpdateCertificates(ctx context.Context, instance *types.Instance) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return i.base.UpdateCertificates(ctx, instance)
+}
+
 func (i InstanceStoreSync) Purge(ctx context.Context) error {
 	mutex.Lock()
 	defer mutex.Unlock()
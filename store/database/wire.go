@@ -5,14 +5,20 @@
 package database
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/drone-runners/drone-runner-aws/store"
 	"github.com/drone-runners/drone-runner-aws/store/database/ldb"
 	"github.com/drone-runners/drone-runner-aws/store/database/sql"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
 	"github.com/drone-runners/drone-runner-aws/store/singleinstance"
+	"github.com/drone-runners/drone-runner-aws/store/tracing"
 	"github.com/syndtr/goleveldb/leveldb"
 
 	"github.com/google/wire"
 	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
 )
 
 // WireSet provides a wire set for this package
@@ -66,18 +72,36 @@ func ProvideSQLStageOwnerStore(db *sqlx.DB) store.StageOwnerStore {
 	}
 }
 
-func ProvideStore(driver, datasource string) (store.InstanceStore, store.StageOwnerStore, error) {
+// ProvideStore provides the instance and stage owner stores, traced. If keys
+// is not nil, the key material of instances is encrypted with them, and
+// existing instances are encrypted first.
+func ProvideStore(driver, datasource string, keys *encrypt.Keyring) (store.InstanceStore, store.StageOwnerStore, error) {
+	var instanceStore store.InstanceStore
+	var stageOwnerStore store.StageOwnerStore
 	if driver == "leveldb" {
 		db, err := leveldb.OpenFile(datasource, nil)
 		if err != nil {
 			return nil, nil, err
 		}
-		return ldb.NewInstanceStore(db), ldb.NewStageOwnerStore(db), nil
+		instanceStore, stageOwnerStore = ldb.NewInstanceStore(db), ldb.NewStageOwnerStore(db)
+	} else {
+		db, err := ProvideSQLDatabase(driver, datasource)
+		if err != nil {
+			return nil, nil, err
+		}
+		instanceStore, stageOwnerStore = ProvideSQLInstanceStore(db), ProvideSQLStageOwnerStore(db)
+	}
+	if keys == nil {
+		return tracing.NewInstanceStore(instanceStore), tracing.NewStageOwnerStore(stageOwnerStore), nil
 	}
 
-	db, err := ProvideSQLDatabase(driver, datasource)
+	updated, err := encrypt.Migrate(context.Background(), instanceStore, keys, false)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("unable to encrypt existing instances: %w", err)
+	}
+	if updated > 0 {
+		logrus.WithField("instances", updated).
+			Infoln("database: encrypted the key material of existing instances")
 	}
-	return ProvideSQLInstanceStore(db), ProvideSQLStageOwnerStore(db), nil
+	return tracing.NewInstanceStore(encrypt.NewInstanceStore(instanceStore, keys)), tracing.NewStageOwnerStore(stageOwnerStore), nil
 }
@@ -0,0 +1,207 @@
+// Package encrypt encrypts the key material of instances at rest. Each value
+// is encrypted with its own data key, which is encrypted with a key of the
+// keyring. The ID of that key is stored with the value, so that keys can be
+// rotated while values encrypted with older keys can still be read.
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// prefix marks encrypted values, it is followed by the key ID, a colon
+// and the encrypted data key and value.
+const prefix = "enc:v1:"
+
+const (
+	keySize   = 32
+	nonceSize = 12
+	// size of an encrypted data key, with its nonce and tag.
+	wrappedKeySize = nonceSize + keySize + 16
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Keyring holds the keys used to encrypt data keys. New values are encrypted
+// with the primary key, the others are only used to decrypt.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring of AES-256 keys by ID. primary is the ID of
+// the key used to encrypt.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{primary: primary, keys: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("encrypt: invalid key id %q", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt: key %s: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("encrypt: primary key %q not found", primary)
+	}
+	return k, nil
+}
+
+// Load returns the keyring configured by keys and the contents of keyFile,
+// or nil if neither is set. Keys are separated by commas or newlines, each is
+// a base64 encoded 32 byte key prefixed by its ID and a colon, e.g.
+// 2:<key>,1:<key>. The first key is the primary key. A key without an ID has
+// the ID default.
+func Load(keys, keyFile string) (*Keyring, error) {
+	if keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt: %w", err)
+		}
+		keys = strings.Join([]string{keys, string(b)}, ",")
+	}
+	var primary string
+	parsed := map[string][]byte{}
+	for _, entry := range strings.FieldsFunc(keys, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		id, value := "default", entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			id, value = entry[:i], entry[i+1:]
+		}
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt: key %s is not base64 encoded", id)
+		}
+		if _, ok := parsed[id]; ok {
+			return nil, fmt.Errorf("encrypt: key %s is defined more than once", id)
+		}
+		parsed[id] = key
+		if primary == "" {
+			primary = id
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(primary, parsed)
+}
+
+// Primary returns the ID of the key used to encrypt.
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// Encrypt encrypts a value with a new data key. Empty values are returned
+// as is.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := []byte(prefix + k.primary + ":")
+	wrapped, err := seal(k.keys[k.primary], dataKey, header)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(aead, plaintext, header)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(header)+len(wrapped)+len(sealed))
+	out = append(out, header...)
+	out = append(out, wrapped...)
+	return append(out, sealed...), nil
+}
+
+// Decrypt decrypts a value. Values that are not encrypted are returned as is,
+// so that rows written before encryption was enabled can be read.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	id, ok := KeyID(data)
+	if !ok {
+		return data, nil
+	}
+	kek, found := k.keys[id]
+	if !found {
+		return nil, fmt.Errorf("encrypt: key %q not found", id)
+	}
+	header := data[:len(prefix)+len(id)+1]
+	body := data[len(header):]
+	if len(body) < wrappedKeySize+nonceSize {
+		return nil, errors.New("encrypt: invalid encrypted value")
+	}
+	dataKey, err := open(kek, body[:wrappedKeySize], header)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: unable to decrypt the data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(aead, body[wrappedKeySize:], header)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: unable to decrypt the value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// KeyID returns the ID of the key a value is encrypted with, and false if
+// the value is not encrypted.
+func KeyID(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte(prefix)) {
+		return "", false
+	}
+	rest := data[len(prefix):]
+	i := bytes.IndexByte(rest, ':')
+	if i <= 0 {
+		return "", false
+	}
+	return string(rest[:i]), true
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("want a %d byte key, got %d bytes", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns the nonce followed by the sealed plaintext.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	if len(data) < nonceSize {
+		return nil, errors.New("invalid encrypted value")
+	}
+	return aead.Open(nil, data[:nonceSize], data[nonceSize:], additional)
+}
@@ -0,0 +1,155 @@
+package encrypt
+
+import (
+	"context"
+	"errors"
+
+	"github.com/drone-runners/drone-runner-aws/store"
+	"github.com/drone-runners/drone-runner-aws/types"
+)
+
+var _ store.InstanceStore = (*InstanceStore)(nil)
+
+// CertificateStore is implemented by instance stores that can update the key
+// material of an instance, which is needed to encrypt existing instances.
+type CertificateStore interface {
+	store.InstanceStore
+	UpdateCertificates(context.Context, *types.Instance) error
+}
+
+// NewInstanceStore returns an instance store that encrypts the key material
+// of instances written to base, and decrypts it when read.
+func NewInstanceStore(base store.InstanceStore, keys *Keyring) *InstanceStore {
+	return &InstanceStore{base: base, keys: keys}
+}
+
+type InstanceStore struct {
+	base store.InstanceStore
+	keys *Keyring
+}
+
+func (s InstanceStore) Find(ctx context.Context, id string) (*types.Instance, error) {
+	instance, err := s.base.Find(ctx, id)
+	if err != nil {
+		return instance, err
+	}
+	return instance, decrypt(s.keys, instance)
+}
+
+func (s InstanceStore) List(ctx context.Context, pool string, params *types.QueryParams) ([]*types.Instance, error) {
+	instances, err := s.base.List(ctx, pool, params)
+	if err != nil {
+		return instances, err
+	}
+	for _, instance := range instances {
+		if err := decrypt(s.keys, instance); err != nil {
+			return nil, err
+		}
+	}
+	return instances, nil
+}
+
+func (s InstanceStore) Create(ctx context.Context, instance *types.Instance) error {
+	return s.write(instance, func(encrypted *types.Instance) error { return s.base.Create(ctx, encrypted) })
+}
+
+func (s InstanceStore) Update(ctx context.Context, instance *types.Instance) error {
+	return s.write(instance, func(encrypted *types.Instance) error { return s.base.Update(ctx, encrypted) })
+}
+
+func (s InstanceStore) Delete(ctx context.Context, id string) error {
+	return s.base.Delete(ctx, id)
+}
+
+func (s InstanceStore) Purge(ctx context.Context) error {
+	return s.base.Purge(ctx)
+}
+
+func (s InstanceStore) DeleteAndReturn(ctx context.Context, query string, args ...any) ([]*types.Instance, error) {
+	return s.base.DeleteAndReturn(ctx, query, args...)
+}
+
+// write calls fn with a shallow copy of the instance with its key material
+// encrypted, so that callers keep using the plaintext.
+func (s InstanceStore) write(instance *types.Instance, fn func(*types.Instance) error) error {
+	cp := *instance
+	for _, field := range fields(&cp) {
+		encrypted, err := s.keys.Encrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = encrypted
+	}
+	return fn(&cp)
+}
+
+// Migrate encrypts the key material of the instances in base that is not
+// encrypted yet. If rotate is true, key material encrypted with another key
+// than the primary key is encrypted again with the primary key. It returns
+// the number of instances updated.
+func Migrate(ctx context.Context, base store.InstanceStore, keys *Keyring, rotate bool) (int, error) {
+	instances, err := base.List(ctx, "", nil)
+	if err != nil {
+		return 0, err
+	}
+	var cs CertificateStore
+	updated := 0
+	for _, instance := range instances {
+		if !outdated(instance, keys.Primary(), rotate) {
+			continue
+		}
+		if cs == nil {
+			var ok bool
+			if cs, ok = base.(CertificateStore); !ok {
+				return 0, errors.New("encrypt: the instance store does not support encrypting existing instances")
+			}
+		}
+		if err := decrypt(keys, instance); err != nil {
+			return updated, err
+		}
+		for _, field := range fields(instance) {
+			if *field, err = keys.Encrypt(*field); err != nil {
+				return updated, err
+			}
+		}
+		if err := cs.UpdateCertificates(ctx, instance); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// outdated reports whether the key material of an instance has to be
+// encrypted again.
+func outdated(instance *types.Instance, primary string, rotate bool) bool {
+	for _, field := range fields(instance) {
+		if len(*field) == 0 {
+			continue
+		}
+		id, ok := KeyID(*field)
+		if !ok || (rotate && id != primary) {
+			return true
+		}
+	}
+	return false
+}
+
+func decrypt(keys *Keyring, instance *types.Instance) error {
+	if instance == nil {
+		return nil
+	}
+	for _, field := range fields(instance) {
+		plaintext, err := keys.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = plaintext
+	}
+	return nil
+}
+
+// fields returns the key material of an instance.
+func fields(instance *types.Instance) []*[]byte {
+	return []*[]byte{&instance.CAKey, &instance.CACert, &instance.TLSKey, &instance.TLSCert}
+}
@@ -37,6 +37,16 @@ func (s InstanceStore) Update(_ context.Context, instance *types.Instance) error
 	return nil
 }
 
+func (s InstanceStore) UpdateCertificates(_ context.Context, instance *types.Instance) error {
+	if singletonInstance.ID == instance.ID {
+		singletonInstance.CAKey = instance.CAKey
+		singletonInstance.CACert = instance.CACert
+		singletonInstance.TLSKey = instance.TLSKey
+		singletonInstance.TLSCert = instance.TLSCert
+	}
+	return nil
+}
+
 func (s InstanceStore) Delete(_ context.Context, id string) error {
 	return nil
 }
@@ -0,0 +1,112 @@
+// Package tracing provides stores that record a span for every call to the
+// underlying store.
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/drone-runners/drone-runner-aws/internal/tracing"
+	"github.com/drone-runners/drone-runner-aws/store"
+	"github.com/drone-runners/drone-runner-aws/store/encrypt"
+	"github.com/drone-runners/drone-runner-aws/types"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	_ encrypt.CertificateStore = (*InstanceStore)(nil)
+	_ store.StageOwnerStore    = (*StageOwnerStore)(nil)
+)
+
+// NewInstanceStore returns an instance store tracing the calls to base.
+func NewInstanceStore(base store.InstanceStore) *InstanceStore {
+	return &InstanceStore{base: base}
+}
+
+type InstanceStore struct {
+	base store.InstanceStore
+}
+
+func (s InstanceStore) Find(ctx context.Context, id string) (instance *types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.Find", tracing.KeyInstance.String(id))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Find(ctx, id)
+}
+
+func (s InstanceStore) List(ctx context.Context, pool string, params *types.QueryParams) (instances []*types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.List", tracing.KeyPool.String(pool))
+	defer func() { tracing.End(span, err) }()
+	instances, err = s.base.List(ctx, pool, params)
+	span.SetAttributes(attribute.Int("runner.instances", len(instances)))
+	return instances, err
+}
+
+func (s InstanceStore) Create(ctx context.Context, instance *types.Instance) (err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.Create", tracing.KeyInstance.String(instance.ID))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Create(ctx, instance)
+}
+
+func (s InstanceStore) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.Delete", tracing.KeyInstance.String(id))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Delete(ctx, id)
+}
+
+func (s InstanceStore) Update(ctx context.Context, instance *types.Instance) (err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.Update", tracing.KeyInstance.String(instance.ID))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Update(ctx, instance)
+}
+
+func (s InstanceStore) Purge(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.Purge")
+	defer func() { tracing.End(span, err) }()
+	return s.base.Purge(ctx)
+}
+
+func (s InstanceStore) DeleteAndReturn(ctx context.Context, query string, args ...any) (instances []*types.Instance, err error) {
+	ctx, span := tracing.Start(ctx, "InstanceStore.DeleteAndReturn")
+	defer func() { tracing.End(span, err) }()
+	return s.base.DeleteAndReturn(ctx, query, args...)
+}
+
+// UpdateCertificates forwards to the base store, so that the key material of
+// existing instances can be encrypted through a traced store.
+func (s InstanceStore) UpdateCertificates(ctx context.Context, instance *types.Instance) (err error) {
+	cs, ok := s.base.(encrypt.CertificateStore)
+	if !ok {
+		return errors.New("tracing: the instance store does not support updating certificates")
+	}
+	ctx, span := tracing.Start(ctx, "InstanceStore.UpdateCertificates", tracing.KeyInstance.String(instance.ID))
+	defer func() { tracing.End(span, err) }()
+	return cs.UpdateCertificates(ctx, instance)
+}
+
+// NewStageOwnerStore returns a stage owner store tracing the calls to base.
+func NewStageOwnerStore(base store.StageOwnerStore) *StageOwnerStore {
+	return &StageOwnerStore{base: base}
+}
+
+type StageOwnerStore struct {
+	base store.StageOwnerStore
+}
+
+func (s StageOwnerStore) Find(ctx context.Context, id string) (owner *types.StageOwner, err error) {
+	ctx, span := tracing.Start(ctx, "StageOwnerStore.Find", tracing.KeyStage.String(id))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Find(ctx, id)
+}
+
+func (s StageOwnerStore) Create(ctx context.Context, owner *types.StageOwner) (err error) {
+	ctx, span := tracing.Start(ctx, "StageOwnerStore.Create", tracing.KeyStage.String(owner.StageID), tracing.KeyPool.String(owner.PoolName))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Create(ctx, owner)
+}
+
+func (s StageOwnerStore) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "StageOwnerStore.Delete", tracing.KeyStage.String(id))
+	defer func() { tracing.End(span, err) }()
+	return s.base.Delete(ctx, id)
+}
@@ -56,7 +56,7 @@ type Instance struct {
 	Size         string        `db:"instance_size" json:"size"`
 	OwnerID      string        `db:"instance_owner_id" json:"owner_id"`
 	Platform     `json:"platform"`
-	CAKey        []byte `db:"instance_ca_key" json:"ca_key"`
+	CAKey        []byte `db:"instance_ca_key" json:"ca_key"` // only set by older runners, the ca key is no longer stored
 	CACert       []byte `db:"instance_ca_cert" json:"ca_cert"`
 	TLSKey       []byte `db:"instance_tls_key" json:"tls_key"`
 	TLSCert      []byte `db:"instance_tls_cert" json:"tls_cert"`
@@ -66,6 +66,10 @@ type Instance struct {
 	IsHibernated bool   `db:"is_hibernated" json:"is_hibernated"`
 	Port         int64  `db:"instance_port" json:"port"`
 	RunnerName   string `db:"runner_name" json:"runner_name"`
+	// Cost is the estimated cost of the instance so far, accrued whenever its
+	// state changes since CostUpdated.
+	Cost        float64 `db:"instance_cost" json:"cost"`
+	CostUpdated int64   `db:"instance_cost_updated" json:"cost_updated"`
 }
 
 type Tmate struct {
@@ -77,12 +81,48 @@ type Tmate struct {
 	ED25519 string
 }
 
+// Network configures the outbound access of an instance: an HTTP proxy,
+// additional trusted certificates, and package and image mirrors.
+type Network struct {
+	Proxy    string
+	NoProxy  []string
+	CABundle string
+	Mirrors  Mirrors
+}
+
+// Mirrors replaces the public sources an instance downloads from.
+type Mirrors struct {
+	// Registries are Docker registry mirrors, e.g. https://mirror.example.com.
+	Registries []string `json:"registries,omitempty" yaml:"registries,omitempty"`
+	// Apt replaces the primary Ubuntu archive.
+	Apt string `json:"apt,omitempty" yaml:"apt,omitempty"`
+	// Docker replaces the Docker apt repository, https://download.docker.com/linux/ubuntu.
+	Docker string `json:"docker,omitempty" yaml:"docker,omitempty"`
+	// DockerKey is the armored signing key of the Docker repository, it is
+	// fetched from the Ubuntu keyserver otherwise.
+	DockerKey string `json:"docker_key,omitempty" yaml:"docker_key,omitempty"`
+	// GitHub replaces https://github.com for the downloads of envman and tmate.
+	GitHub string `json:"github,omitempty" yaml:"github,omitempty"`
+}
+
+// UserDataPart is a part of multipart userdata, merged by cloud-init with
+// the userdata of the runner.
+type UserDataPart struct {
+	// ContentType is the MIME type of the part, e.g. text/cloud-config or
+	// text/x-shellscript. It is detected from the content if empty.
+	ContentType string `json:"content_type,omitempty" yaml:"content_type,omitempty"`
+	Content     string `json:"content" yaml:"content"`
+}
+
 type InstanceCreateOpts struct {
-	CAKey          []byte
 	CACert         []byte
 	TLSKey         []byte
 	TLSCert        []byte
 	LiteEnginePath string
+	Prebaked       bool
+	UserDataFormat string
+	UserDataParts  []UserDataPart
+	UserDataGzip   bool
 	Platform
 	PoolName             string
 	RunnerName           string
@@ -90,7 +130,9 @@ type InstanceCreateOpts struct {
 	Pool                 int
 	HarnessTestBinaryURI string
 	PluginBinaryURI      string
+	Checksums            map[string]string
 	Tmate                Tmate
+	Network              Network
 	AccountID            string
 	IsHosted             bool
 	ResourceClass        string